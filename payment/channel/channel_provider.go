@@ -0,0 +1,92 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+var (
+	ErrDeclined                   = errors.New("channel: payment declined")
+	ErrAuthorizationNotFound      = errors.New("channel: authorization not found")
+	ErrAuthorizationNotCapturable = errors.New("channel: authorization is not capturable")
+	ErrAuthorizationNotVoidable   = errors.New("channel: authorization is not voidable")
+	ErrCaptureExceedsAuthorized   = errors.New("channel: capture amount exceeds authorized amount")
+	ErrPartialCaptureNotSupported = errors.New("channel: partial capture is not supported")
+)
+
+type RequestAuthorize struct {
+	// Reference identifies the payment on our side, e.g. the order ID.
+	Reference string
+	Amount    money.Amount
+	Currency  money.Currency
+}
+
+type AuthorizationStatus string
+
+const (
+	AuthorizationStatusAuthorized AuthorizationStatus = "authorized"
+	AuthorizationStatusCaptured   AuthorizationStatus = "captured"
+	AuthorizationStatusVoided     AuthorizationStatus = "voided"
+)
+
+type Authorization struct {
+	ID       string
+	Status   AuthorizationStatus
+	Amount   money.Amount
+	Captured money.Amount
+	Currency money.Currency
+}
+
+// ChannelProvider moves money through one payment channel. Authorize reserves
+// the amount, Capture takes some or all of it and Void releases what was not
+// captured.
+type ChannelProvider interface {
+	Authorize(ctx context.Context, r RequestAuthorize) (*Authorization, error)
+	Capture(ctx context.Context, id string, amount money.Amount) (*Authorization, error)
+	Void(ctx context.Context, id string) (*Authorization, error)
+}
+
+type Registry interface {
+	Register(c constant.PaymentChannel, p ChannelProvider)
+	Provider(c constant.PaymentChannel) (ChannelProvider, error)
+}
+
+type ProviderNotFoundError struct {
+	Channel constant.PaymentChannel
+}
+
+func (e *ProviderNotFoundError) Error() string {
+	return fmt.Sprintf("channel: no provider for %s", e.Channel)
+}
+
+type registry struct {
+	mu        sync.RWMutex
+	providers map[constant.PaymentChannel]ChannelProvider
+}
+
+func NewRegistry() Registry {
+	return &registry{
+		providers: map[constant.PaymentChannel]ChannelProvider{},
+	}
+}
+
+func (s *registry) Register(c constant.PaymentChannel, p ChannelProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providers[c] = p
+}
+
+func (s *registry) Provider(c constant.PaymentChannel) (ChannelProvider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.providers[c]
+	if !ok {
+		return nil, &ProviderNotFoundError{Channel: c}
+	}
+	return p, nil
+}
@@ -0,0 +1,124 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+// capabilities describe how a real channel behaves so the simulator refuses
+// what the channel would refuse.
+type capabilities struct {
+	partialCapture bool
+	void           bool
+}
+
+var simulatorCapabilities = map[constant.PaymentChannel]capabilities{
+	constant.PaymentChannelDebit:     {partialCapture: false, void: true},
+	constant.PaymentChannelCredit:    {partialCapture: true, void: true},
+	constant.PaymentChannelPromptPay: {partialCapture: false, void: false},
+	constant.PaymentChannelQRPayment: {partialCapture: false, void: false},
+}
+
+type SimulatorConfig struct {
+	// DeclineOver declines every authorization above this amount; zero never declines.
+	DeclineOver money.Amount
+}
+
+type simulator struct {
+	ch  constant.PaymentChannel
+	cap capabilities
+	cfg SimulatorConfig
+
+	mu    sync.Mutex
+	seq   int
+	auths map[string]*Authorization
+}
+
+// NewSimulator returns an in-memory provider that follows the rules of the
+// given channel, for running and testing the service offline. It answers at
+// once, so it only fails on a context the caller has already given up.
+func NewSimulator(ch constant.PaymentChannel, cfg SimulatorConfig) ChannelProvider {
+	return &simulator{
+		ch:    ch,
+		cap:   simulatorCapabilities[ch],
+		cfg:   cfg,
+		auths: map[string]*Authorization{},
+	}
+}
+
+// NewSimulatorRegistry registers a simulator for every payment channel.
+func NewSimulatorRegistry(cfg SimulatorConfig) Registry {
+	r := NewRegistry()
+	for ch := range simulatorCapabilities {
+		r.Register(ch, NewSimulator(ch, cfg))
+	}
+	return r
+}
+
+func (s *simulator) Authorize(ctx context.Context, r RequestAuthorize) (*Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !s.cfg.DeclineOver.IsZero() && r.Amount.Cmp(s.cfg.DeclineOver) > 0 {
+		return nil, ErrDeclined
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	a := &Authorization{
+		ID:       fmt.Sprintf("sim-%s-%06d", s.ch, s.seq),
+		Status:   AuthorizationStatusAuthorized,
+		Amount:   r.Amount,
+		Currency: r.Currency,
+	}
+	s.auths[a.ID] = a
+	v := *a
+	return &v, nil
+}
+
+func (s *simulator) Capture(ctx context.Context, id string, amount money.Amount) (*Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.auths[id]
+	if !ok {
+		return nil, ErrAuthorizationNotFound
+	}
+	if a.Status != AuthorizationStatusAuthorized {
+		return nil, ErrAuthorizationNotCapturable
+	}
+	if !amount.IsPositive() || amount.Cmp(a.Amount) > 0 {
+		return nil, ErrCaptureExceedsAuthorized
+	}
+	if amount != a.Amount && !s.cap.partialCapture {
+		return nil, ErrPartialCaptureNotSupported
+	}
+	a.Captured = amount
+	a.Status = AuthorizationStatusCaptured
+	v := *a
+	return &v, nil
+}
+
+func (s *simulator) Void(ctx context.Context, id string) (*Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.auths[id]
+	if !ok {
+		return nil, ErrAuthorizationNotFound
+	}
+	if a.Status != AuthorizationStatusAuthorized || !s.cap.void {
+		return nil, ErrAuthorizationNotVoidable
+	}
+	a.Status = AuthorizationStatusVoided
+	v := *a
+	return &v, nil
+}
@@ -0,0 +1,160 @@
+//go:build unit_test
+// +build unit_test
+
+package channel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator(t *testing.T) {
+	var r Registry
+
+	setup := func() {
+		r = NewSimulatorRegistry(SimulatorConfig{DeclineOver: money.MustFromInt(1000)})
+	}
+
+	authorize := func(t *testing.T, ch constant.PaymentChannel, amount money.Amount) (ChannelProvider, *Authorization) {
+		p, err := r.Provider(ch)
+		assert.Nil(t, err)
+		a, err := p.Authorize(context.Background(), RequestAuthorize{Reference: "1", Amount: amount, Currency: money.THB})
+		assert.Nil(t, err)
+		return p, a
+	}
+
+	for _, ch := range []constant.PaymentChannel{constant.PaymentChannelDebit, constant.PaymentChannelCredit, constant.PaymentChannelPromptPay, constant.PaymentChannelQRPayment} {
+		t.Run(string(ch)+" authorize and capture full amount should capture", func(t *testing.T) {
+			//Arrange
+			setup()
+			p, a := authorize(t, ch, money.MustFromInt(100))
+
+			//Action
+			actual, err := p.Capture(context.Background(), a.ID, money.MustFromInt(100))
+
+			//Assert
+			assert.Nil(t, err)
+			assert.Equal(t, AuthorizationStatusCaptured, actual.Status)
+			assert.Equal(t, money.MustFromInt(100), actual.Captured)
+		})
+
+		t.Run(string(ch)+" authorize over limit should decline", func(t *testing.T) {
+			//Arrange
+			setup()
+			p, _ := r.Provider(ch)
+
+			//Action
+			_, err := p.Authorize(context.Background(), RequestAuthorize{Amount: money.MustParse("1000.01"), Currency: money.THB})
+
+			//Assert
+			assert.Equal(t, ErrDeclined, err)
+		})
+	}
+
+	t.Run("credit should allow partial capture", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, a := authorize(t, constant.PaymentChannelCredit, money.MustFromInt(100))
+
+		//Action
+		actual, err := p.Capture(context.Background(), a.ID, money.MustFromInt(40))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(40), actual.Captured)
+	})
+
+	t.Run("debit should refuse partial capture", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, a := authorize(t, constant.PaymentChannelDebit, money.MustFromInt(100))
+
+		//Action
+		_, err := p.Capture(context.Background(), a.ID, money.MustFromInt(40))
+
+		//Assert
+		assert.Equal(t, ErrPartialCaptureNotSupported, err)
+	})
+
+	t.Run("capture over authorized amount should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, a := authorize(t, constant.PaymentChannelCredit, money.MustFromInt(100))
+
+		//Action
+		_, err := p.Capture(context.Background(), a.ID, money.MustFromInt(101))
+
+		//Assert
+		assert.Equal(t, ErrCaptureExceedsAuthorized, err)
+	})
+
+	t.Run("void should release authorization and block capture", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, a := authorize(t, constant.PaymentChannelCredit, money.MustFromInt(100))
+
+		//Action
+		actual, err := p.Void(context.Background(), a.ID)
+		_, captureErr := p.Capture(context.Background(), a.ID, money.MustFromInt(100))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, AuthorizationStatusVoided, actual.Status)
+		assert.Equal(t, ErrAuthorizationNotCapturable, captureErr)
+	})
+
+	t.Run("qr channels should refuse void", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, a := authorize(t, constant.PaymentChannelPromptPay, money.MustFromInt(100))
+
+		//Action
+		_, err := p.Void(context.Background(), a.ID)
+
+		//Assert
+		assert.Equal(t, ErrAuthorizationNotVoidable, err)
+	})
+
+	t.Run("unknown authorization should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, _ := r.Provider(constant.PaymentChannelDebit)
+
+		//Action
+		_, err := p.Capture(context.Background(), "missing", money.MustFromInt(1))
+
+		//Assert
+		assert.Equal(t, ErrAuthorizationNotFound, err)
+	})
+
+	t.Run("given up context should fail without authorizing", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, _ := r.Provider(constant.PaymentChannelCredit)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		//Action
+		_, err := p.Authorize(ctx, RequestAuthorize{Reference: "1", Amount: money.MustFromInt(100), Currency: money.THB})
+
+		//Assert
+		assert.Equal(t, context.Canceled, err)
+		_, a := authorize(t, constant.PaymentChannelCredit, money.MustFromInt(100))
+		assert.Equal(t, "sim-credit-000001", a.ID)
+	})
+
+	t.Run("unregistered channel should return provider not found", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := r.Provider("cash")
+
+		//Assert
+		assert.EqualError(t, err, "channel: no provider for cash")
+	})
+}
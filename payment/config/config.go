@@ -0,0 +1,452 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/messaging"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the payment server needs to start. It is read from a
+// YAML file, then environment variables, then command line flags, each
+// overriding the one before.
+type Config struct {
+	HTTP       HTTPConfig       `yaml:"http"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	Clock      ClockConfig      `yaml:"clock"`
+	Webhook    WebhookConfig    `yaml:"webhook"`
+	Settlement SettlementConfig `yaml:"settlement"`
+	Pending    PendingConfig    `yaml:"pending"`
+	// Fees and Rates are the paths of the fee schedule and exchange rates.
+	Fees  string `yaml:"fees"`
+	Rates string `yaml:"rates"`
+}
+
+type HTTPConfig struct {
+	Addr         string        `yaml:"addr"`
+	ReadTimeout  time.Duration `yaml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+	// RequestTimeout cancels the work of a request. It must be shorter than
+	// WriteTimeout so the client still hears about it.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// ShutdownTimeout bounds draining the requests in flight and stopping
+	// the workers and connections behind them.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+type DatabaseConfig struct {
+	// Driver is sqlserver, postgres or sqlite.
+	Driver string `yaml:"driver"`
+	// Path is the database file of sqlite, which needs none of the others.
+	Path string `yaml:"path"`
+	Host string `yaml:"host"`
+	// Port defaults to the port of the driver when not set.
+	Port     int    `yaml:"port"`
+	Name     string `yaml:"name"`
+	User     string `yaml:"user"`
+	Password Secret `yaml:"password"`
+	// Options are extra connection string parameters on top of the ones the
+	// driver gets by default, e.g. encrypt.
+	Options map[string]string `yaml:"options"`
+}
+
+type KafkaConfig struct {
+	Brokers  []string `yaml:"brokers"`
+	ClientID string   `yaml:"clientID"`
+	// Acks is all, leader or none.
+	Acks    string `yaml:"acks"`
+	Retries int    `yaml:"retries"`
+}
+
+type ClockConfig struct {
+	// Zone is the IANA time zone business days are counted in.
+	Zone string `yaml:"zone"`
+
+	location *time.Location
+}
+
+type WebhookConfig struct {
+	Secrets map[constant.PaymentChannel]Secret `yaml:"secrets"`
+}
+
+type SettlementConfig struct {
+	ReportDir string `yaml:"reportDir"`
+}
+
+type PendingConfig struct {
+	// Timeout is how long a payment may wait for its channel before it is
+	// rejected.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultPath is the file Load reads when -config and PAYMENT_CONFIG are not
+// given. Unlike a file asked for explicitly, it may be missing.
+const DefaultPath = "config.yaml"
+
+const envPrefix = "PAYMENT_"
+
+// databaseDrivers are the default port and connection string parameters of
+// the drivers connecting to a server.
+var databaseDrivers = map[storage.Driver]struct {
+	port    int
+	options map[string]string
+}{
+	storage.DriverSQLServer: {1433, map[string]string{"encrypt": "disable", "parseTime": "True", "time_zone": "UTC"}},
+	storage.DriverPostgres:  {5432, map[string]string{"sslmode": "disable", "TimeZone": "UTC"}},
+}
+
+var kafkaAcks = map[string]messaging.KafkaAcks{
+	"all":    messaging.KafkaAcksAll,
+	"leader": messaging.KafkaAcksLeader,
+	"none":   messaging.KafkaAcksNone,
+}
+
+// webhookChannels are the channels that call us back and so have a secret.
+var webhookChannels = []constant.PaymentChannel{
+	constant.PaymentChannelPromptPay,
+	constant.PaymentChannelQRPayment,
+}
+
+func defaults() *Config {
+	return &Config{
+		HTTP: HTTPConfig{
+			Addr:            "0.0.0.0:8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			RequestTimeout:  10 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver: string(storage.DriverSQLServer),
+			Host:   "localhost",
+			Name:   "tdd-workshop",
+			User:   "sa",
+		},
+		Kafka: KafkaConfig{
+			Brokers: []string{"localhost:9092"},
+			Acks:    "all",
+			Retries: 3,
+		},
+		Clock:      ClockConfig{Zone: "Asia/Bangkok"},
+		Webhook:    WebhookConfig{Secrets: map[constant.PaymentChannel]Secret{}},
+		Settlement: SettlementConfig{ReportDir: "settlements"},
+		Pending:    PendingConfig{Timeout: 15 * time.Minute},
+		Fees:       "fees.json",
+		Rates:      "rates.json",
+	}
+}
+
+// Load builds the Config from the file named by -config or PAYMENT_CONFIG,
+// then the PAYMENT_* environment variables, then the flags in args, and
+// validates it. Every setting has a flag named like database.password and
+// an environment variable named like PAYMENT_DATABASE_PASSWORD; secrets also
+// take a -file variant holding the path to read them from.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	type override struct{ key, value string }
+	var flags []override
+	ss := settings()
+
+	set := flag.NewFlagSet("payment", flag.ContinueOnError)
+	path := set.String("config", "", "path of the YAML config file (env "+envPrefix+"CONFIG)")
+	for _, s := range ss {
+		key := s.key
+		set.Func(key, s.usage+" (env "+envName(key)+")", func(v string) error {
+			flags = append(flags, override{key, v})
+			return nil
+		})
+	}
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := defaults()
+	file, explicit := *path, true
+	if file == "" {
+		file = getenv(envPrefix + "CONFIG")
+	}
+	if file == "" {
+		file, explicit = DefaultPath, false
+	}
+	if err := c.readFile(file); err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	for _, s := range ss {
+		if v := getenv(envName(s.key)); v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("config: %s: %w", envName(s.key), err)
+			}
+		}
+	}
+	for _, f := range flags {
+		for _, s := range ss {
+			if s.key != f.key {
+				continue
+			}
+			if err := s.set(c, f.value); err != nil {
+				return nil, fmt.Errorf("config: -%s: %w", f.key, err)
+			}
+		}
+	}
+
+	if err := c.resolve(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// resolve reads the secrets given as files.
+func (c *Config) resolve() error {
+	if err := c.Database.Password.resolve(); err != nil {
+		return fmt.Errorf("database.password: %w", err)
+	}
+	for ch, s := range c.Webhook.Secrets {
+		if err := s.resolve(); err != nil {
+			return fmt.Errorf("webhook.secrets.%s: %w", ch, err)
+		}
+		c.Webhook.Secrets[ch] = s
+	}
+	return nil
+}
+
+// Validate reports every missing or invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(key, v string) {
+		if v == "" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", key))
+		}
+	}
+
+	required("http.addr", c.HTTP.Addr)
+	positive("http.readTimeout", c.HTTP.ReadTimeout)
+	positive("http.writeTimeout", c.HTTP.WriteTimeout)
+	positive("http.idleTimeout", c.HTTP.IdleTimeout)
+	positive("http.requestTimeout", c.HTTP.RequestTimeout)
+	positive("http.shutdownTimeout", c.HTTP.ShutdownTimeout)
+	if c.HTTP.RequestTimeout >= c.HTTP.WriteTimeout {
+		errs = append(errs, errors.New("http.requestTimeout must be shorter than http.writeTimeout"))
+	}
+
+	switch storage.Driver(c.Database.Driver) {
+	case storage.DriverSQLite:
+		required("database.path", c.Database.Path)
+	case storage.DriverSQLServer, storage.DriverPostgres:
+		required("database.host", c.Database.Host)
+		required("database.name", c.Database.Name)
+		required("database.user", c.Database.User)
+		required("database.password", c.Database.Password.Value)
+		if c.Database.Port < 0 || c.Database.Port > 65535 {
+			errs = append(errs, errors.New("database.port must be between 1 and 65535, or 0 for the default"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be sqlserver, postgres or sqlite, got %q", c.Database.Driver))
+	}
+
+	if len(c.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers is required"))
+	}
+	if _, ok := kafkaAcks[c.Kafka.Acks]; !ok {
+		errs = append(errs, fmt.Errorf("kafka.acks must be all, leader or none, got %q", c.Kafka.Acks))
+	}
+	if c.Kafka.Retries < 0 {
+		errs = append(errs, errors.New("kafka.retries must not be negative"))
+	}
+
+	loc, err := time.LoadLocation(c.Clock.Zone)
+	if err != nil || c.Clock.Zone == "" {
+		errs = append(errs, fmt.Errorf("clock.zone %q is not a time zone", c.Clock.Zone))
+	}
+	c.Clock.location = loc
+
+	required("settlement.reportDir", c.Settlement.ReportDir)
+	positive("pending.timeout", c.Pending.Timeout)
+	required("fees", c.Fees)
+	required("rates", c.Rates)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// DSN is the connection string of Driver.
+func (c DatabaseConfig) DSN() string {
+	d := databaseDrivers[storage.Driver(c.Driver)]
+	q := url.Values{}
+	for k, v := range d.options {
+		q.Set(k, v)
+	}
+	for k, v := range c.Options {
+		q.Set(k, v)
+	}
+	if storage.Driver(c.Driver) == storage.DriverSQLite {
+		if len(q) == 0 {
+			return c.Path
+		}
+		return c.Path + "?" + q.Encode()
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = d.port
+	}
+	u := url.URL{
+		Scheme: c.Driver,
+		User:   url.UserPassword(c.User, c.Password.Value),
+		Host:   net.JoinHostPort(c.Host, strconv.Itoa(port)),
+	}
+	if storage.Driver(c.Driver) == storage.DriverPostgres {
+		u.Path = "/" + c.Name
+	} else {
+		q.Set("database", c.Name)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (c KafkaConfig) Producer() messaging.KafkaConfig {
+	return messaging.KafkaConfig{
+		Brokers:  c.Brokers,
+		ClientID: c.ClientID,
+		Acks:     kafkaAcks[c.Acks],
+		Retries:  c.Retries,
+	}
+}
+
+// Location is the time zone of Zone, set once the config is validated.
+func (c ClockConfig) Location() *time.Location {
+	return c.location
+}
+
+// Values are the webhook secrets by channel, leaving out channels without one.
+func (c WebhookConfig) Values() map[constant.PaymentChannel]string {
+	v := map[constant.PaymentChannel]string{}
+	for ch, s := range c.Secrets {
+		if s.Value != "" {
+			v[ch] = s.Value
+		}
+	}
+	return v
+}
+
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+func settings() []setting {
+	str := func(key, usage string, field func(c *Config) *string) setting {
+		return setting{key, usage, func(c *Config, v string) error {
+			*field(c) = v
+			return nil
+		}}
+	}
+	num := func(key, usage string, field func(c *Config) *int) setting {
+		return setting{key, usage, func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = n
+			return nil
+		}}
+	}
+	dur := func(key, usage string, field func(c *Config) *time.Duration) setting {
+		return setting{key, usage, func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = d
+			return nil
+		}}
+	}
+	secret := func(key, usage string, put func(c *Config, s Secret)) []setting {
+		return []setting{
+			{key, usage, func(c *Config, v string) error {
+				put(c, Secret{Value: v})
+				return nil
+			}},
+			{key + "-file", "file holding the " + usage, func(c *Config, v string) error {
+				put(c, Secret{File: v})
+				return nil
+			}},
+		}
+	}
+
+	s := []setting{
+		str("http.addr", "address the HTTP server listens on", func(c *Config) *string { return &c.HTTP.Addr }),
+		dur("http.read-timeout", "HTTP read timeout", func(c *Config) *time.Duration { return &c.HTTP.ReadTimeout }),
+		dur("http.write-timeout", "HTTP write timeout", func(c *Config) *time.Duration { return &c.HTTP.WriteTimeout }),
+		dur("http.idle-timeout", "HTTP idle timeout", func(c *Config) *time.Duration { return &c.HTTP.IdleTimeout }),
+		dur("http.request-timeout", "deadline of the work done for a request", func(c *Config) *time.Duration { return &c.HTTP.RequestTimeout }),
+		dur("http.shutdown-timeout", "time given to drain requests and stop workers on shutdown", func(c *Config) *time.Duration { return &c.HTTP.ShutdownTimeout }),
+		str("database.driver", "database driver: sqlserver, postgres or sqlite", func(c *Config) *string { return &c.Database.Driver }),
+		str("database.path", "database file of sqlite", func(c *Config) *string { return &c.Database.Path }),
+		str("database.host", "database host", func(c *Config) *string { return &c.Database.Host }),
+		num("database.port", "database port", func(c *Config) *int { return &c.Database.Port }),
+		str("database.name", "database name", func(c *Config) *string { return &c.Database.Name }),
+		str("database.user", "database user", func(c *Config) *string { return &c.Database.User }),
+		{"kafka.brokers", "comma separated Kafka brokers", func(c *Config, v string) error {
+			c.Kafka.Brokers = strings.Split(v, ",")
+			return nil
+		}},
+		str("kafka.client-id", "Kafka client id", func(c *Config) *string { return &c.Kafka.ClientID }),
+		str("kafka.acks", "Kafka acks: all, leader or none", func(c *Config) *string { return &c.Kafka.Acks }),
+		num("kafka.retries", "Kafka publish retries", func(c *Config) *int { return &c.Kafka.Retries }),
+		str("clock.zone", "time zone business days are counted in", func(c *Config) *string { return &c.Clock.Zone }),
+		str("settlement.report-dir", "directory of the settlement reports", func(c *Config) *string { return &c.Settlement.ReportDir }),
+		dur("pending.timeout", "time a payment may stay pending before it is rejected", func(c *Config) *time.Duration { return &c.Pending.Timeout }),
+		str("fees", "path of the fee schedule", func(c *Config) *string { return &c.Fees }),
+		str("rates", "path of the exchange rates", func(c *Config) *string { return &c.Rates }),
+	}
+	s = append(s, secret("database.password", "database password", func(c *Config, v Secret) { c.Database.Password = v })...)
+	for _, ch := range webhookChannels {
+		s = append(s, secret("webhook.secrets."+string(ch), string(ch)+" webhook secret", func(c *Config, v Secret) {
+			if c.Webhook.Secrets == nil {
+				c.Webhook.Secrets = map[constant.PaymentChannel]Secret{}
+			}
+			c.Webhook.Secrets[ch] = v
+		})...)
+	}
+	return s
+}
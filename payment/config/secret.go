@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret is a sensitive value given inline or read from File, e.g. a Docker
+// or Kubernetes secret mounted into the container. In YAML it is either a
+// plain string or {file: /run/secrets/name}.
+type Secret struct {
+	Value string
+	File  string
+}
+
+func (s *Secret) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*s = Secret{}
+		return n.Decode(&s.Value)
+	}
+	var v struct {
+		Value string `yaml:"value"`
+		File  string `yaml:"file"`
+	}
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	*s = Secret(v)
+	return nil
+}
+
+// String keeps the value out of logs and error messages.
+func (s Secret) String() string {
+	if s.Value == "" {
+		return ""
+	}
+	return "******"
+}
+
+// resolve reads the value from File when one is set. The trailing newline
+// most editors and secret stores add is dropped.
+func (s *Secret) resolve() error {
+	if s.File == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.File)
+	if err != nil {
+		return fmt.Errorf("read secret: %w", err)
+	}
+	s.Value = strings.TrimRight(string(b), "\r\n")
+	return nil
+}
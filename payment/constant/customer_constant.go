@@ -10,3 +10,12 @@ const (
 func IsActiveCustomer(status CustomerStatus) bool {
 	return CustomerStatusActive == status
 }
+
+func IsValidCustomerStatus(status CustomerStatus) bool {
+	switch status {
+	case CustomerStatusActive, CustomerStatusInActive:
+		return true
+	default:
+		return false
+	}
+}
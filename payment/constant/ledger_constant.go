@@ -0,0 +1,25 @@
+package constant
+
+type LedgerAccountType string
+
+const (
+	LedgerAccountTypeCustomer LedgerAccountType = "customer"
+	LedgerAccountTypeMerchant LedgerAccountType = "merchant"
+	// Fees the platform earned from merchants
+	LedgerAccountTypeFee LedgerAccountType = "fee"
+	// Carries converted payments and refunds between currencies
+	LedgerAccountTypeFX LedgerAccountType = "fx"
+	// Money entering or leaving the platform, e.g. top-ups, bank transfers
+	// and settlement payouts
+	LedgerAccountTypeExternal LedgerAccountType = "external"
+)
+
+type JournalEntryKind string
+
+const (
+	JournalEntryKindOpening    JournalEntryKind = "opening"
+	JournalEntryKindPayment    JournalEntryKind = "payment"
+	JournalEntryKindRefund     JournalEntryKind = "refund"
+	JournalEntryKindTopUp      JournalEntryKind = "top_up"
+	JournalEntryKindSettlement JournalEntryKind = "settlement"
+)
@@ -11,3 +11,14 @@ const (
 func IsActiveMerchant(status MerchantStatus) bool {
 	return MerchantStatusActive == status
 }
+
+func IsValidMerchantStatus(status MerchantStatus) bool {
+	switch status {
+	case MerchantStatusActive, MerchantStatusSuspend, MerchantStatusInActive:
+		return true
+	default:
+		return false
+	}
+}
+
+var KafkaTopicMerchantSettlement = "merchant-settlement"
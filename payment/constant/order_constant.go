@@ -1,5 +1,7 @@
 package constant
 
+import "fmt"
+
 type OrderStatus string
 
 const (
@@ -12,3 +14,42 @@ const (
 func IsOrderRequestPayment(status OrderStatus) bool {
 	return OrderStatusRequestPayment == status
 }
+
+// orderTransitions lists every legal move of the order lifecycle.
+// Confirm and reject are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusOpen:           {OrderStatusRequestPayment, OrderStatusReject},
+	OrderStatusRequestPayment: {OrderStatusOpen, OrderStatusConfirm, OrderStatusReject},
+	OrderStatusConfirm:        {},
+	OrderStatusReject:         {},
+}
+
+type OrderTransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("order status cannot change from %s to %s", e.From, e.To)
+}
+
+func IsInitialOrderStatus(status OrderStatus) bool {
+	return OrderStatusOpen == status
+}
+
+func CanTransitOrder(from, to OrderStatus) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitOrder returns an *OrderTransitionError when the order may not move from one status to the other.
+func TransitOrder(from, to OrderStatus) error {
+	if !CanTransitOrder(from, to) {
+		return &OrderTransitionError{From: from, To: to}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build unit_test
+// +build unit_test
+
+package constant
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitOrder(t *testing.T) {
+	data := []struct {
+		from  OrderStatus
+		to    OrderStatus
+		legal bool
+	}{
+		{OrderStatusOpen, OrderStatusRequestPayment, true},
+		{OrderStatusOpen, OrderStatusReject, true},
+		{OrderStatusOpen, OrderStatusConfirm, false},
+		{OrderStatusRequestPayment, OrderStatusConfirm, true},
+		{OrderStatusRequestPayment, OrderStatusReject, true},
+		{OrderStatusRequestPayment, OrderStatusOpen, true},
+		{OrderStatusConfirm, OrderStatusOpen, false},
+		{OrderStatusConfirm, OrderStatusReject, false},
+		{OrderStatusReject, OrderStatusOpen, false},
+		{"", OrderStatusOpen, false},
+	}
+
+	for _, v := range data {
+		t.Run(fmt.Sprintf("%s to %s", v.from, v.to), func(t *testing.T) {
+			err := TransitOrder(v.from, v.to)
+
+			assert.Equal(t, v.legal, CanTransitOrder(v.from, v.to))
+			if v.legal {
+				assert.Nil(t, err)
+			} else {
+				assert.Equal(t, &OrderTransitionError{From: v.from, To: v.to}, err)
+			}
+		})
+	}
+}
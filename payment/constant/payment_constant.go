@@ -18,11 +18,64 @@ func IsValidPaymentChannel(channel PaymentChannel) bool {
 	}
 }
 
+// IsQRPaymentChannel reports whether the customer pays by scanning a QR code
+// in their banking app, so the payment stays pending until the bank confirms it.
+func IsQRPaymentChannel(channel PaymentChannel) bool {
+	return channel == PaymentChannelPromptPay || channel == PaymentChannelQRPayment
+}
+
+// IsTwoPhasePaymentChannel reports whether payments of the channel are only
+// authorized at first and captured or voided later.
+func IsTwoPhasePaymentChannel(channel PaymentChannel) bool {
+	return channel == PaymentChannelCredit
+}
+
+// PaymentAmountPolicy decides how a payment amount has to relate to the order amount.
+type PaymentAmountPolicy string
+
+const (
+	// PaymentAmountPolicyExact requires a single payment of the full order amount.
+	PaymentAmountPolicyExact PaymentAmountPolicy = "exact"
+	// PaymentAmountPolicyPartial accepts several payments until the order amount is covered.
+	PaymentAmountPolicyPartial PaymentAmountPolicy = "partial"
+)
+
 type PaymentTranasctionStatus string
 
 const (
-	PaymentTranasctionStatusConfirm PaymentTranasctionStatus = "comfirm"
-	PaymentTranasctionStatusReject  PaymentTranasctionStatus = "reject"
+	PaymentTranasctionStatusConfirm    PaymentTranasctionStatus = "comfirm"
+	PaymentTranasctionStatusReject     PaymentTranasctionStatus = "reject"
+	PaymentTranasctionStatusPending    PaymentTranasctionStatus = "pending"
+	PaymentTranasctionStatusAuthorized PaymentTranasctionStatus = "authorized"
+	PaymentTranasctionStatusVoid       PaymentTranasctionStatus = "void"
+)
+
+func IsValidPaymentTranasctionStatus(status PaymentTranasctionStatus) bool {
+	switch status {
+	case PaymentTranasctionStatusConfirm, PaymentTranasctionStatusReject, PaymentTranasctionStatusPending,
+		PaymentTranasctionStatusAuthorized, PaymentTranasctionStatusVoid:
+		return true
+	default:
+		return false
+	}
+}
+
+// HoldStatus is the state of the funds an authorization holds on a customer.
+type HoldStatus string
+
+const (
+	HoldStatusHeld     HoldStatus = "held"
+	HoldStatusCaptured HoldStatus = "captured"
+	HoldStatusVoided   HoldStatus = "voided"
+)
+
+type PaymentTranasctionType string
+
+const (
+	PaymentTranasctionTypePayment PaymentTranasctionType = "payment"
+	PaymentTranasctionTypeRefund  PaymentTranasctionType = "refund"
 )
 
 var KafkaTopicPaymentTransaction = "payment-transaction"
+
+var KafkaTopicPaymentRefund = "payment-refund"
@@ -0,0 +1,23 @@
+package constant
+
+// ReconciliationKind is how a channel and our books came apart.
+type ReconciliationKind string
+
+const (
+	// ReconciliationKindCaptureNotBooked is money the channel captured for a
+	// payment we failed to book.
+	ReconciliationKindCaptureNotBooked ReconciliationKind = "capture_not_booked"
+	// ReconciliationKindCaptureFailed is a booked payment the channel failed
+	// to capture.
+	ReconciliationKindCaptureFailed ReconciliationKind = "capture_failed"
+	// ReconciliationKindTransferToReturn is money the customer transferred
+	// for a pending payment we rejected.
+	ReconciliationKindTransferToReturn ReconciliationKind = "transfer_to_return"
+)
+
+type ReconciliationStatus string
+
+const (
+	ReconciliationStatusOpen     ReconciliationStatus = "open"
+	ReconciliationStatusResolved ReconciliationStatus = "resolved"
+)
@@ -0,0 +1,136 @@
+package fee
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+// Rule charges Rate of the payment amount plus Fixed. Rate is a fraction,
+// e.g. 0.025 for 2.5%, and Fixed is charged in the currency of the payment.
+type Rule struct {
+	Rate  money.Rate   `json:"rate"`
+	Fixed money.Amount `json:"fixed"`
+	// Tiers replace Rate and Fixed once the merchant's volume this month
+	// reaches MinVolume, lowest MinVolume first.
+	Tiers []Tier `json:"tiers,omitempty"`
+}
+
+type Tier struct {
+	MinVolume money.Amount `json:"minVolume"`
+	Rate      money.Rate   `json:"rate"`
+	Fixed     money.Amount `json:"fixed"`
+}
+
+// Schedule is the fee charged per payment channel. A merchant listed in
+// Merchants pays its own rule for the channels it lists instead.
+type Schedule struct {
+	Channels  map[constant.PaymentChannel]Rule          `json:"channels"`
+	Merchants map[uint]map[constant.PaymentChannel]Rule `json:"merchants,omitempty"`
+}
+
+// LoadSchedule reads a Schedule from a JSON file, e.g.
+// {"channels": {"debit": {"rate": "0.015", "fixed": "2"}}}.
+func LoadSchedule(path string) (Schedule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("fee: read schedule: %w", err)
+	}
+	var s Schedule
+	if err := json.Unmarshal(b, &s); err != nil {
+		return Schedule{}, fmt.Errorf("fee: parse schedule: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+func (s Schedule) Validate() error {
+	for ch, r := range s.Channels {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("fee: channel %s: %w", ch, err)
+		}
+	}
+	for id, rules := range s.Merchants {
+		for ch, r := range rules {
+			if err := r.validate(); err != nil {
+				return fmt.Errorf("fee: merchant %d channel %s: %w", id, ch, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Rule returns the rule the merchant pays on the channel, or false when the
+// channel is free.
+func (s Schedule) Rule(merchantID uint, ch constant.PaymentChannel) (Rule, bool) {
+	if r, ok := s.Merchants[merchantID][ch]; ok {
+		return r, true
+	}
+	r, ok := s.Channels[ch]
+	return r, ok
+}
+
+func (r Rule) validate() error {
+	if err := validCharge(r.Rate, r.Fixed); err != nil {
+		return err
+	}
+	var prev money.Amount
+	for i, t := range r.Tiers {
+		if !t.MinVolume.IsPositive() || (i > 0 && t.MinVolume.Cmp(prev) <= 0) {
+			return fmt.Errorf("tier %d: min volume must be positive and ascending", i)
+		}
+		if err := validCharge(t.Rate, t.Fixed); err != nil {
+			return fmt.Errorf("tier %d: %w", i, err)
+		}
+		prev = t.MinVolume
+	}
+	return nil
+}
+
+func validCharge(rate money.Rate, fixed money.Amount) error {
+	if rate.Cmp(money.One) > 0 {
+		return fmt.Errorf("rate %s must not exceed 1", rate)
+	}
+	if fixed.IsNegative() {
+		return fmt.Errorf("fixed %s must not be negative", fixed)
+	}
+	return nil
+}
+
+// Tiered reports whether the fee depends on the merchant's volume.
+func (r Rule) Tiered() bool {
+	return len(r.Tiers) > 0
+}
+
+// Fee is what the merchant pays on amount given its volume this month,
+// rounded to the currency and never more than amount itself.
+func (r Rule) Fee(amount money.Amount, c money.Currency, volume money.Amount) (money.Amount, error) {
+	rate, fixed := r.Rate, r.Fixed
+	for _, t := range r.Tiers {
+		if volume.Cmp(t.MinVolume) < 0 {
+			break
+		}
+		rate, fixed = t.Rate, t.Fixed
+	}
+	f, err := amount.Convert(rate, c)
+	if err != nil {
+		return money.Amount{}, err
+	}
+	fixed, err = fixed.Round(c.Precision())
+	if err != nil {
+		return money.Amount{}, err
+	}
+	f, err = f.Add(fixed)
+	if err != nil {
+		return money.Amount{}, err
+	}
+	if f.Cmp(amount) > 0 {
+		return amount, nil
+	}
+	return f, nil
+}
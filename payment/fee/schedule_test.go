@@ -0,0 +1,137 @@
+//go:build unit_test
+// +build unit_test
+
+package fee
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	var s Schedule
+
+	setup := func() {
+		var err error
+		s, err = LoadSchedule("testdata/fees.json")
+		assert.Nil(t, err)
+	}
+
+	fee := func(merchantID uint, ch constant.PaymentChannel, amount string, c money.Currency, volume string) money.Amount {
+		r, ok := s.Rule(merchantID, ch)
+		assert.True(t, ok)
+		f, err := r.Fee(money.MustParse(amount), c, money.MustParse(volume))
+		assert.Nil(t, err)
+		return f
+	}
+
+	t.Run("fee should charge rate of amount plus fixed", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual := fee(1, constant.PaymentChannelDebit, "1000", money.THB, "0")
+
+		//Assert
+		assert.Equal(t, money.MustFromInt(17), actual)
+	})
+
+	t.Run("fee should round to currency precision", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual := fee(1, constant.PaymentChannelDebit, "33.33", money.THB, "0")
+
+		//Assert
+		assert.Equal(t, money.MustParse("2.5"), actual)
+	})
+
+	t.Run("fee should never exceed amount", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual := fee(1, constant.PaymentChannelDebit, "1", money.THB, "0")
+
+		//Assert
+		assert.Equal(t, money.MustFromInt(1), actual)
+	})
+
+	t.Run("merchant override should replace channel rule", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual := fee(7, constant.PaymentChannelDebit, "1000", money.THB, "0")
+
+		//Assert
+		assert.Equal(t, money.MustFromInt(10), actual)
+	})
+
+	t.Run("fee should use highest tier volume reaches", func(t *testing.T) {
+		data := []struct {
+			volume   string
+			expected money.Amount
+		}{
+			{"0", money.MustFromInt(35)},
+			{"99999.99", money.MustFromInt(35)},
+			{"100000", money.MustFromInt(30)},
+			{"5000000", money.MustFromInt(20)},
+		}
+		for _, v := range data {
+			t.Run(v.volume, func(t *testing.T) {
+				//Arrange
+				setup()
+
+				//Action
+				actual := fee(1, constant.PaymentChannelCredit, "1000", money.THB, v.volume)
+
+				//Assert
+				assert.Equal(t, v.expected, actual)
+			})
+		}
+	})
+
+	t.Run("channel without rule should be free", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, ok := s.Rule(1, constant.PaymentChannelPromptPay)
+
+		//Assert
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid schedule should return error when", func(t *testing.T) {
+		data := []struct {
+			name string
+			json string
+		}{
+			{"rate over one", `{"channels":{"debit":{"rate":"1.5"}}}`},
+			{"negative fixed", `{"channels":{"debit":{"fixed":"-1"}}}`},
+			{"tiers not ascending", `{"channels":{"debit":{"tiers":[{"minVolume":"100"},{"minVolume":"50"}]}}}`},
+			{"merchant rule invalid", `{"merchants":{"7":{"debit":{"rate":"2"}}}}`},
+			{"malformed json", `{"channels":`},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				path := filepath.Join(t.TempDir(), "fees.json")
+				os.WriteFile(path, []byte(v.json), 0o644)
+
+				//Action
+				_, err := LoadSchedule(path)
+
+				//Assert
+				assert.NotNil(t, err)
+			})
+		}
+	})
+}
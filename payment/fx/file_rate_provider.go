@@ -0,0 +1,66 @@
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+type pair struct {
+	from money.Currency
+	to   money.Currency
+}
+
+type fileRateProvider struct {
+	rates map[pair]money.Rate
+}
+
+// NewFileRateProvider loads fixed rates from a JSON file of "FROM/TO": "rate"
+// pairs, e.g. {"USD/THB": "36.25"}. The opposite direction is derived when
+// the file does not list it.
+func NewFileRateProvider(path string) (RateProvider, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fx: read rates: %w", err)
+	}
+	var raw map[string]money.Rate
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("fx: parse rates: %w", err)
+	}
+	rates := map[pair]money.Rate{}
+	for k, r := range raw {
+		from, to, ok := strings.Cut(k, "/")
+		if !ok || !money.IsValidCurrency(money.Currency(from)) || !money.IsValidCurrency(money.Currency(to)) {
+			return nil, fmt.Errorf("fx: invalid currency pair %q", k)
+		}
+		if r.IsZero() {
+			return nil, fmt.Errorf("fx: invalid rate for %q", k)
+		}
+		rates[pair{money.Currency(from), money.Currency(to)}] = r
+	}
+	for p, r := range rates {
+		inv := pair{p.to, p.from}
+		if _, ok := rates[inv]; !ok {
+			v, err := r.Inverse()
+			if err != nil {
+				return nil, fmt.Errorf("fx: invalid rate for %q: %w", p.from+"/"+p.to, err)
+			}
+			rates[inv] = v
+		}
+	}
+	return &fileRateProvider{rates: rates}, nil
+}
+
+func (s *fileRateProvider) Rate(from, to money.Currency) (money.Rate, error) {
+	if from == to {
+		return money.One, nil
+	}
+	r, ok := s.rates[pair{from, to}]
+	if !ok {
+		return money.Rate{}, &RateNotFoundError{From: from, To: to}
+	}
+	return r, nil
+}
@@ -0,0 +1,107 @@
+//go:build unit_test
+// +build unit_test
+
+package fx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRateProvider(t *testing.T) {
+	var p RateProvider
+
+	setup := func() {
+		var err error
+		p, err = NewFileRateProvider("testdata/rates.json")
+		assert.Nil(t, err)
+	}
+
+	t.Run("rate should return listed pair", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		r, err := p.Rate(money.USD, money.THB)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParseRate("36.25"), r)
+	})
+
+	t.Run("rate should derive inverse when pair is not listed", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		r, err := p.Rate(money.THB, money.USD)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParseRate("0.02758621"), r)
+	})
+
+	t.Run("rate should prefer listed pair over inverse", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		r, err := p.Rate(money.THB, money.EUR)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParseRate("0.0253"), r)
+	})
+
+	t.Run("rate of same currency should be one", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		r, err := p.Rate(money.SGD, money.SGD)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.One, r)
+	})
+
+	t.Run("rate of unknown pair should return not found", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := p.Rate(money.SGD, money.THB)
+
+		//Assert
+		assert.ErrorIs(t, err, ErrRateNotFound)
+		assert.EqualError(t, err, "fx: rate SGD/THB not found")
+	})
+
+	t.Run("invalid pair should fail to load", func(t *testing.T) {
+		//Arrange
+		path := filepath.Join(t.TempDir(), "rates.json")
+		os.WriteFile(path, []byte(`{"USDTHB": "36"}`), 0o600)
+
+		//Action
+		_, err := NewFileRateProvider(path)
+
+		//Assert
+		assert.EqualError(t, err, `fx: invalid currency pair "USDTHB"`)
+	})
+	t.Run("rate without an inverse should fail to load", func(t *testing.T) {
+		//Arrange
+		path := filepath.Join(t.TempDir(), "rates.json")
+		os.WriteFile(path, []byte(`{"THB/JPY": "300000000"}`), 0o600)
+
+		//Action
+		_, err := NewFileRateProvider(path)
+
+		//Assert
+		assert.ErrorIs(t, err, money.ErrInvalidRate)
+		assert.ErrorContains(t, err, `"THB/JPY"`)
+	})
+}
@@ -0,0 +1,28 @@
+package fx
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+var ErrRateNotFound = errors.New("fx: rate not found")
+
+// RateProvider quotes how many units of to one unit of from buys.
+type RateProvider interface {
+	Rate(from, to money.Currency) (money.Rate, error)
+}
+
+type RateNotFoundError struct {
+	From money.Currency
+	To   money.Currency
+}
+
+func (e *RateNotFoundError) Error() string {
+	return fmt.Sprintf("fx: rate %s/%s not found", e.From, e.To)
+}
+
+func (e *RateNotFoundError) Unwrap() error {
+	return ErrRateNotFound
+}
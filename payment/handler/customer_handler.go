@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type CustomerHandler interface {
+	CreateCustomer() http.HandlerFunc
+	GetCustomer() http.HandlerFunc
+	ListCustomers() http.HandlerFunc
+	UpdateCustomerStatus() http.HandlerFunc
+	TopUpCustomer() http.HandlerFunc
+}
+
+type customerHandler struct {
+	c service.CustomerService
+}
+
+func NewCustomerHandler(c service.CustomerService) CustomerHandler {
+	return &customerHandler{
+		c: c,
+	}
+}
+
+func (h *customerHandler) CreateCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req service.RequestCreateCustomer
+
+		err := decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.c.CreateCustomer(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+func (h *customerHandler) GetCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.c.GetCustomer(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *customerHandler) ListCustomers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := pageQuery(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.c.ListCustomers(r.Context(), page)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *customerHandler) UpdateCustomerStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var req service.RequestUpdateCustomerStatus
+
+		err = decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.c.UpdateCustomerStatus(r.Context(), id, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *customerHandler) TopUpCustomer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var req service.RequestTopUp
+
+		err = decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.c.TopUpCustomer(r.Context(), id, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build unit_test
+// +build unit_test
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCustomerService struct {
+	Creates  []service.RequestCreateCustomer
+	Pages    []service.RequestPage
+	Statuses []service.RequestUpdateCustomerStatus
+	TopUps   []service.RequestTopUp
+	IDs      []uint
+	res      *service.CustomerResponse
+	err      error
+}
+
+func (m *mockCustomerService) SetResponse(res *service.CustomerResponse, err error) {
+	m.res = res
+	m.err = err
+}
+
+func (m *mockCustomerService) CreateCustomer(ctx context.Context, r service.RequestCreateCustomer) (*service.CustomerResponse, error) {
+	m.Creates = append(m.Creates, r)
+	return m.res, m.err
+}
+
+func (m *mockCustomerService) GetCustomer(ctx context.Context, id uint) (*service.CustomerResponse, error) {
+	m.IDs = append(m.IDs, id)
+	return m.res, m.err
+}
+
+func (m *mockCustomerService) ListCustomers(ctx context.Context, r service.RequestPage) (*service.PageResponse[service.CustomerResponse], error) {
+	m.Pages = append(m.Pages, r)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &service.PageResponse[service.CustomerResponse]{Items: []service.CustomerResponse{*m.res}, Page: 1, Size: 20, Total: 1}, nil
+}
+
+func (m *mockCustomerService) UpdateCustomerStatus(ctx context.Context, id uint, r service.RequestUpdateCustomerStatus) (*service.CustomerResponse, error) {
+	m.IDs = append(m.IDs, id)
+	m.Statuses = append(m.Statuses, r)
+	return m.res, m.err
+}
+
+func (m *mockCustomerService) TopUpCustomer(ctx context.Context, id uint, r service.RequestTopUp) (*service.CustomerResponse, error) {
+	m.IDs = append(m.IDs, id)
+	m.TopUps = append(m.TopUps, r)
+	return m.res, m.err
+}
+
+func TestCustomerHandler(t *testing.T) {
+	var (
+		m  *mockCustomerService
+		h  CustomerHandler
+		rr *httptest.ResponseRecorder
+		r  *mux.Router
+	)
+
+	setup := func() {
+		m = &mockCustomerService{}
+		h = NewCustomerHandler(m)
+		rr = httptest.NewRecorder()
+		r = mux.NewRouter()
+		r.HandleFunc("/customers", h.CreateCustomer()).Methods(http.MethodPost)
+		r.HandleFunc("/customers", h.ListCustomers()).Methods(http.MethodGet)
+		r.HandleFunc("/customers/{id}", h.GetCustomer()).Methods(http.MethodGet)
+		r.HandleFunc("/customers/{id}/status", h.UpdateCustomerStatus()).Methods(http.MethodPatch)
+		r.HandleFunc("/customers/{id}/top-up", h.TopUpCustomer()).Methods(http.MethodPost)
+	}
+
+	customer := &service.CustomerResponse{ID: 1, Name: "Madmax Drinkcola", Status: "active", Amount: money.MustFromInt(1000)}
+
+	t.Run("create customer should return created customer", func(t *testing.T) {
+		setup()
+		m.SetResponse(customer, nil)
+		req, _ := http.NewRequest(http.MethodPost, "/customers", bytes.NewBufferString(`{"name":"Madmax Drinkcola"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, []service.RequestCreateCustomer{{Name: "Madmax Drinkcola"}}, m.Creates)
+	})
+
+	t.Run("create customer with body over limit should return request entity too large", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodPost, "/customers", bytes.NewBufferString(`{"name":"`+strings.Repeat("a", maxBodyBytes)+`"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Equal(t, 0, len(m.Creates))
+	})
+
+	t.Run("list customers should pass paging query", func(t *testing.T) {
+		setup()
+		m.SetResponse(customer, nil)
+		req, _ := http.NewRequest(http.MethodGet, "/customers?page=2&size=5", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestPage{{Page: 2, Size: 5}}, m.Pages)
+		assert.Contains(t, rr.Body.String(), `"total":1`)
+	})
+
+	t.Run("list customers invalid paging query should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodGet, "/customers?page=two", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Pages))
+	})
+
+	t.Run("get customer not found should return not found", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrCustomerNotFound)
+		req, _ := http.NewRequest(http.MethodGet, "/customers/9", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, []uint{9}, m.IDs)
+	})
+
+	t.Run("update customer status should return updated customer", func(t *testing.T) {
+		setup()
+		m.SetResponse(customer, nil)
+		req, _ := http.NewRequest(http.MethodPatch, "/customers/1/status", bytes.NewBufferString(`{"status":"inactive"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestUpdateCustomerStatus{{Status: "inactive"}}, m.Statuses)
+	})
+
+	t.Run("top up invalid amount should return unprocessable entity", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrInvalidTopUpAmount)
+		req, _ := http.NewRequest(http.MethodPost, "/customers/1/top-up", bytes.NewBufferString(`{"amount":-5}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []service.RequestTopUp{{Amount: money.MustFromInt(-5)}}, m.TopUps)
+	})
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+const headerIdempotencyKey = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// responseCapture records what the wrapped handler wrote so it can be replayed.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseCapture) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseCapture) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent runs next at most once per Idempotency-Key. A duplicate with the same
+// request gets the stored response back; a reused key with a different request is
+// rejected. Server errors release the key so the client can retry. The key is
+// released or completed even when the request was cancelled. A key still in
+// progress after the lease is taken over by the next duplicate, as its request
+// is presumed dead.
+func (h *paymentHandler) idempotent(w http.ResponseWriter, r *http.Request, body []byte, next func(context.Context, http.ResponseWriter, []byte)) {
+	ctx := r.Context()
+	key := r.Header.Get(headerIdempotencyKey)
+	if key == "" {
+		next(ctx, w, body)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, service.ErrIdempotencyKeyInvalid)
+		return
+	}
+
+	f := fingerprint(r, body)
+	n := h.c.Now()
+	k := &storage.IdempotencyKey{
+		Key:         key,
+		Fingerprint: f,
+		CreatedAt:   n,
+		UpdatedAt:   n,
+	}
+	err := h.i.Create(ctx, k)
+	if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+		err = h.i.TakeOver(ctx, k, n.Add(-h.cfg.IdempotencyLease))
+		if err == nil {
+			log.Printf("idempotency key %s: took over after lease expired", key)
+		}
+	}
+	if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+		replay(ctx, h.i, w, key, f)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	c := &responseCapture{ResponseWriter: w}
+	next(ctx, c, body)
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if c.status >= http.StatusInternalServerError {
+		if err := h.i.Delete(ctx, k); err != nil {
+			log.Printf("idempotency key %s: release: %v", key, err)
+		}
+		return
+	}
+	k.Completed = true
+	k.StatusCode = c.status
+	k.ContentType = w.Header().Get("Content-Type")
+	k.Response = c.body.String()
+	if err := h.i.Complete(ctx, k); err != nil {
+		log.Printf("idempotency key %s: complete: %v", key, err)
+	}
+}
+
+func replay(ctx context.Context, i storage.IdempotencyStorage, w http.ResponseWriter, key, f string) {
+	k, err := i.Get(ctx, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, service.ErrIdempotencyKeyInProgress)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if k.Fingerprint != f {
+		writeError(w, service.ErrIdempotencyKeyReused)
+		return
+	}
+	if !k.Completed {
+		writeError(w, service.ErrIdempotencyKeyInProgress)
+		return
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	if k.ContentType != "" {
+		w.Header().Set("Content-Type", k.ContentType)
+	}
+	w.WriteHeader(k.StatusCode)
+	w.Write([]byte(k.Response))
+}
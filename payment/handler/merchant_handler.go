@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type MerchantHandler interface {
+	CreateMerchant() http.HandlerFunc
+	GetMerchant() http.HandlerFunc
+	ListMerchants() http.HandlerFunc
+	UpdateMerchantStatus() http.HandlerFunc
+	TopUpMerchant() http.HandlerFunc
+}
+
+type merchantHandler struct {
+	m service.MerchantService
+}
+
+func NewMerchantHandler(m service.MerchantService) MerchantHandler {
+	return &merchantHandler{
+		m: m,
+	}
+}
+
+func (h *merchantHandler) CreateMerchant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req service.RequestCreateMerchant
+
+		err := decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.m.CreateMerchant(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+func (h *merchantHandler) GetMerchant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.m.GetMerchant(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *merchantHandler) ListMerchants() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := pageQuery(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.m.ListMerchants(r.Context(), page)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *merchantHandler) UpdateMerchantStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var req service.RequestUpdateMerchantStatus
+
+		err = decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.m.UpdateMerchantStatus(r.Context(), id, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *merchantHandler) TopUpMerchant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var req service.RequestTopUp
+
+		err = decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.m.TopUpMerchant(r.Context(), id, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
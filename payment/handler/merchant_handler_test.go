@@ -0,0 +1,238 @@
+//go:build unit_test
+// +build unit_test
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockMerchantService struct {
+	Creates  []service.RequestCreateMerchant
+	Pages    []service.RequestPage
+	Statuses []service.RequestUpdateMerchantStatus
+	TopUps   []service.RequestTopUp
+	IDs      []uint
+	res      *service.MerchantResponse
+	err      error
+}
+
+func (m *mockMerchantService) SetResponse(res *service.MerchantResponse, err error) {
+	m.res = res
+	m.err = err
+}
+
+func (m *mockMerchantService) CreateMerchant(ctx context.Context, r service.RequestCreateMerchant) (*service.MerchantResponse, error) {
+	m.Creates = append(m.Creates, r)
+	return m.res, m.err
+}
+
+func (m *mockMerchantService) GetMerchant(ctx context.Context, id uint) (*service.MerchantResponse, error) {
+	m.IDs = append(m.IDs, id)
+	return m.res, m.err
+}
+
+func (m *mockMerchantService) ListMerchants(ctx context.Context, r service.RequestPage) (*service.PageResponse[service.MerchantResponse], error) {
+	m.Pages = append(m.Pages, r)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &service.PageResponse[service.MerchantResponse]{Items: []service.MerchantResponse{*m.res}, Page: 1, Size: 20, Total: 1}, nil
+}
+
+func (m *mockMerchantService) UpdateMerchantStatus(ctx context.Context, id uint, r service.RequestUpdateMerchantStatus) (*service.MerchantResponse, error) {
+	m.IDs = append(m.IDs, id)
+	m.Statuses = append(m.Statuses, r)
+	return m.res, m.err
+}
+
+func (m *mockMerchantService) TopUpMerchant(ctx context.Context, id uint, r service.RequestTopUp) (*service.MerchantResponse, error) {
+	m.IDs = append(m.IDs, id)
+	m.TopUps = append(m.TopUps, r)
+	return m.res, m.err
+}
+
+func TestMerchantHandler(t *testing.T) {
+	var (
+		m  *mockMerchantService
+		h  MerchantHandler
+		rr *httptest.ResponseRecorder
+		r  *mux.Router
+	)
+
+	setup := func() {
+		m = &mockMerchantService{}
+		h = NewMerchantHandler(m)
+		rr = httptest.NewRecorder()
+		r = mux.NewRouter()
+		r.HandleFunc("/merchants", h.CreateMerchant()).Methods(http.MethodPost)
+		r.HandleFunc("/merchants", h.ListMerchants()).Methods(http.MethodGet)
+		r.HandleFunc("/merchants/{id}", h.GetMerchant()).Methods(http.MethodGet)
+		r.HandleFunc("/merchants/{id}/status", h.UpdateMerchantStatus()).Methods(http.MethodPatch)
+		r.HandleFunc("/merchants/{id}/top-up", h.TopUpMerchant()).Methods(http.MethodPost)
+	}
+
+	merchant := &service.MerchantResponse{ID: 1, Name: "Rabit Cart", Status: "active", Amount: money.MustFromInt(100), Currency: money.THB}
+
+	t.Run("create merchant should return created merchant", func(t *testing.T) {
+		setup()
+		m.SetResponse(merchant, nil)
+		req, _ := http.NewRequest(http.MethodPost, "/merchants", bytes.NewBufferString(`{"name":"Rabit Cart","currency":"THB","promptPayID":"0812345678"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, []service.RequestCreateMerchant{{Name: "Rabit Cart", Currency: money.THB, PromptPayID: "0812345678"}}, m.Creates)
+		assert.Contains(t, rr.Body.String(), `"name":"Rabit Cart"`)
+	})
+
+	t.Run("create merchant invalid body should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodPost, "/merchants", bytes.NewBufferString(`not json`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Creates))
+	})
+
+	t.Run("create merchant invalid name should return unprocessable entity", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrInvalidName)
+		req, _ := http.NewRequest(http.MethodPost, "/merchants", bytes.NewBufferString(`{"name":""}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrInvalidName.Code)
+	})
+
+	t.Run("list merchants should pass paging query", func(t *testing.T) {
+		setup()
+		m.SetResponse(merchant, nil)
+		req, _ := http.NewRequest(http.MethodGet, "/merchants?page=2&size=5", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestPage{{Page: 2, Size: 5}}, m.Pages)
+		assert.Contains(t, rr.Body.String(), `"total":1`)
+	})
+
+	t.Run("list merchants invalid paging query should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodGet, "/merchants?size=five", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Pages))
+	})
+
+	t.Run("get merchant should return merchant", func(t *testing.T) {
+		setup()
+		m.SetResponse(merchant, nil)
+		req, _ := http.NewRequest(http.MethodGet, "/merchants/1", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []uint{1}, m.IDs)
+	})
+
+	t.Run("get merchant not found should return not found", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrMerchantNotFound)
+		req, _ := http.NewRequest(http.MethodGet, "/merchants/9", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrMerchantNotFound.Code)
+		assert.Equal(t, []uint{9}, m.IDs)
+	})
+
+	t.Run("get merchant invalid id should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodGet, "/merchants/abc", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.IDs))
+	})
+
+	t.Run("update merchant status should return updated merchant", func(t *testing.T) {
+		setup()
+		m.SetResponse(merchant, nil)
+		req, _ := http.NewRequest(http.MethodPatch, "/merchants/1/status", bytes.NewBufferString(`{"status":"inactive"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestUpdateMerchantStatus{{Status: "inactive"}}, m.Statuses)
+	})
+
+	t.Run("update merchant invalid status should return unprocessable entity", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrInvalidMerchantStatus)
+		req, _ := http.NewRequest(http.MethodPatch, "/merchants/1/status", bytes.NewBufferString(`{"status":"closed"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrInvalidMerchantStatus.Code)
+	})
+
+	t.Run("update status of unknown merchant should return not found", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrMerchantNotFound)
+		req, _ := http.NewRequest(http.MethodPatch, "/merchants/9/status", bytes.NewBufferString(`{"status":"inactive"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, []uint{9}, m.IDs)
+	})
+
+	t.Run("top up merchant should return merchant with new amount", func(t *testing.T) {
+		setup()
+		m.SetResponse(merchant, nil)
+		req, _ := http.NewRequest(http.MethodPost, "/merchants/1/top-up", bytes.NewBufferString(`{"amount":"40.25"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestTopUp{{Amount: money.MustParse("40.25")}}, m.TopUps)
+	})
+
+	t.Run("top up invalid amount should return unprocessable entity", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrInvalidTopUpAmount)
+		req, _ := http.NewRequest(http.MethodPost, "/merchants/1/top-up", bytes.NewBufferString(`{"amount":-5}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []service.RequestTopUp{{Amount: money.MustFromInt(-5)}}, m.TopUps)
+	})
+
+	t.Run("top up invalid body should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodPost, "/merchants/1/top-up", bytes.NewBufferString(`{"amount":"1e3"}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.TopUps))
+	})
+}
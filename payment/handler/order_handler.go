@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type OrderHandler interface {
+	CreateOrder() http.HandlerFunc
+	GetOrder() http.HandlerFunc
+	RequestPayment() http.HandlerFunc
+}
+
+type orderHandler struct {
+	o service.OrderService
+}
+
+func NewOrderHandler(o service.OrderService) OrderHandler {
+	return &orderHandler{
+		o: o,
+	}
+}
+
+func (h *orderHandler) CreateOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req service.RequestCreateOrder
+
+		err := decodeBody(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.o.CreateOrder(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+func (h *orderHandler) GetOrder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.o.GetOrder(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *orderHandler) RequestPayment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		res, err := h.o.RequestPayment(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
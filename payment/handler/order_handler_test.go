@@ -0,0 +1,131 @@
+//go:build unit_test
+// +build unit_test
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockOrderService struct {
+	Creates []service.RequestCreateOrder
+	IDs     []uint
+	res     *service.OrderResponse
+	err     error
+}
+
+func (m *mockOrderService) SetResponse(res *service.OrderResponse, err error) {
+	m.res = res
+	m.err = err
+}
+
+func (m *mockOrderService) CreateOrder(ctx context.Context, r service.RequestCreateOrder) (*service.OrderResponse, error) {
+	m.Creates = append(m.Creates, r)
+	return m.res, m.err
+}
+
+func (m *mockOrderService) GetOrder(ctx context.Context, id uint) (*service.OrderResponse, error) {
+	m.IDs = append(m.IDs, id)
+	return m.res, m.err
+}
+
+func (m *mockOrderService) RequestPayment(ctx context.Context, id uint) (*service.OrderResponse, error) {
+	m.IDs = append(m.IDs, id)
+	return m.res, m.err
+}
+
+func TestOrderHandler(t *testing.T) {
+	var (
+		m  *mockOrderService
+		h  OrderHandler
+		rr *httptest.ResponseRecorder
+		r  *mux.Router
+	)
+
+	setup := func() {
+		m = &mockOrderService{}
+		h = NewOrderHandler(m)
+		rr = httptest.NewRecorder()
+		r = mux.NewRouter()
+		r.HandleFunc("/orders", h.CreateOrder()).Methods(http.MethodPost)
+		r.HandleFunc("/orders/{id}", h.GetOrder()).Methods(http.MethodGet)
+		r.HandleFunc("/orders/{id}/request-payment", h.RequestPayment()).Methods(http.MethodPatch)
+	}
+
+	order := &service.OrderResponse{ID: 1, CustomerID: 1, MerchantID: 2, Amount: money.MustFromInt(1200), Currency: money.THB, Status: "open"}
+	orderJSON := `{"id":1,"customerID":1,"merchantID":2,"amount":1200,"currency":"THB","status":"open","createdAt":"0001-01-01T00:00:00Z","updatedAt":"0001-01-01T00:00:00Z"}`
+
+	t.Run("create order should return created order", func(t *testing.T) {
+		setup()
+		m.SetResponse(order, nil)
+		req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(`{"customerID":1,"merchantID":2,"amount":1200}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.JSONEq(t, orderJSON, rr.Body.String())
+		assert.Equal(t, []service.RequestCreateOrder{{CustomerID: 1, MerchantID: 2, Amount: money.MustFromInt(1200)}}, m.Creates)
+	})
+
+	t.Run("create order invalid json should return bad request", func(t *testing.T) {
+		setup()
+		req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(`{`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Creates))
+	})
+
+	t.Run("create order with inactive customer should return unprocessable entity", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrCustomerNotActive)
+		req, _ := http.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(`{"customerID":1,"merchantID":2,"amount":1200}`))
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("get order should return order", func(t *testing.T) {
+		setup()
+		m.SetResponse(order, nil)
+		req, _ := http.NewRequest(http.MethodGet, "/orders/1", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, orderJSON, rr.Body.String())
+		assert.Equal(t, []uint{1}, m.IDs)
+	})
+
+	t.Run("get order not found should return not found", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrOrderNotFound)
+		req, _ := http.NewRequest(http.MethodGet, "/orders/9", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("request payment illegal transition should return conflict", func(t *testing.T) {
+		setup()
+		m.SetResponse(nil, service.ErrOrderIllegalTransition)
+		req, _ := http.NewRequest(http.MethodPatch, "/orders/1/request-payment", http.NoBody)
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, []uint{1}, m.IDs)
+	})
+}
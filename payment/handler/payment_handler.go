@@ -1,54 +1,267 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
 	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/skip2/go-qrcode"
 )
 
 type PaymentHandler interface {
 	Payment() http.HandlerFunc
+	Refund() http.HandlerFunc
+	Capture() http.HandlerFunc
+	Void() http.HandlerFunc
+	QR() http.HandlerFunc
+	QRImage() http.HandlerFunc
+	GetPayment() http.HandlerFunc
+	ListPayments() http.HandlerFunc
+	ListOrderPayments() http.HandlerFunc
+}
+
+// qrImageSize is the width and height in pixels of the QR PNG.
+const qrImageSize = 256
+
+type PaymentHandlerConfig struct {
+	// IdempotencyLease is how long a request may hold its Idempotency-Key
+	// before a duplicate may take it over. It must outlast any request.
+	IdempotencyLease time.Duration
 }
 
 type paymentHandler struct {
-	p service.Service
+	p   service.Service
+	i   storage.IdempotencyStorage
+	c   clock.Clock
+	cfg PaymentHandlerConfig
 }
 
-func NewHandler(p service.Service) PaymentHandler {
+func NewHandler(p service.Service, i storage.IdempotencyStorage, c clock.Clock, cfg PaymentHandlerConfig) PaymentHandler {
+	if cfg.IdempotencyLease == 0 {
+		cfg.IdempotencyLease = time.Minute
+	}
 	return &paymentHandler{
-		p: p,
+		p:   p,
+		i:   i,
+		c:   c,
+		cfg: cfg,
 	}
 }
 
 func (h *paymentHandler) Payment() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req service.RequestPayment
+		b, err := readBody(w, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		h.idempotent(w, r, b, h.payment)
+	}
+}
+
+func (h *paymentHandler) payment(ctx context.Context, w http.ResponseWriter, b []byte) {
+	var req service.RequestPayment
+
+	err := json.Unmarshal(b, &req)
+	if err != nil {
+		writeError(w, service.ErrInvalidRequest)
+		return
+	}
+
+	res, err := h.p.Payment(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if res.Status == constant.PaymentTranasctionStatusPending {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, res)
+}
 
-		err := json.NewDecoder(r.Body).Decode(&req)
+func (h *paymentHandler) Refund() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		b, err := readBody(w, r)
 		if err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			writeError(w, err)
 			return
 		}
+		h.idempotent(w, r, b, func(ctx context.Context, w http.ResponseWriter, b []byte) {
+			h.refund(ctx, w, id, b)
+		})
+	}
+}
+
+func (h *paymentHandler) refund(ctx context.Context, w http.ResponseWriter, id uint, b []byte) {
+	var req service.RequestRefund
 
-		err = h.p.Payment(req)
+	if len(b) > 0 {
+		err := json.Unmarshal(b, &req)
+		if err != nil {
+			writeError(w, service.ErrInvalidRequest)
+			return
+		}
+	}
+	req.PaymentID = id
+
+	res, err := h.p.Refund(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (h *paymentHandler) Capture() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		b, err := readBody(w, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		h.idempotent(w, r, b, func(ctx context.Context, w http.ResponseWriter, b []byte) {
+			h.capture(ctx, w, id, b)
+		})
+	}
+}
+
+func (h *paymentHandler) capture(ctx context.Context, w http.ResponseWriter, id uint, b []byte) {
+	var req service.RequestCapture
+
+	if len(b) > 0 {
+		err := json.Unmarshal(b, &req)
+		if err != nil {
+			writeError(w, service.ErrInvalidRequest)
+			return
+		}
+	}
+	req.PaymentID = id
+
+	res, err := h.p.Capture(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *paymentHandler) Void() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
 		if err != nil {
-			var httpstatus int
-			switch err.Error() {
-			case "invalid payment channel",
-				"order status is not request payment",
-				"customer status is not active",
-				"customer amount is not enough",
-				"merchant status is not active":
-				httpstatus = http.StatusUnprocessableEntity
-			default:
-				httpstatus = http.StatusInternalServerError
+			writeError(w, err)
+			return
+		}
+		h.idempotent(w, r, nil, func(ctx context.Context, w http.ResponseWriter, b []byte) {
+			res, err := h.p.Void(ctx, id)
+			if err != nil {
+				writeError(w, err)
+				return
 			}
+			writeJSON(w, http.StatusOK, res)
+		})
+	}
+}
+
+func (h *paymentHandler) QR() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		res, err := h.p.PaymentQR(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
 
-			http.Error(w, fmt.Sprintf("Failed payment : %v", err.Error()), httpstatus)
+func (h *paymentHandler) QRImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
 			return
 		}
+		res, err := h.p.PaymentQR(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		png, err := qrcode.Encode(res.QRPayload, qrcode.Medium, qrImageSize)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(png)
+	}
+}
 
+func (h *paymentHandler) GetPayment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		res, err := h.p.GetPayment(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *paymentHandler) ListPayments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := listPaymentsQuery(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		res, err := h.p.ListPayments(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (h *paymentHandler) ListOrderPayments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		res, err := h.p.ListOrderPayments(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
 	}
 }
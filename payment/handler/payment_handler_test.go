@@ -5,21 +5,98 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/kaweel/workshop-tdd/payment/storage"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 type mockService struct {
-	Calls []service.RequestPayment
-	err   error
+	Calls     []service.RequestPayment
+	Refunds   []service.RequestRefund
+	QRs       []uint
+	Completes []service.RequestCompletePayment
+	Captures  []service.RequestCapture
+	Voids     []uint
+	Lists     []service.RequestListPayments
+	Gets      []uint
+	payment   *service.PaymentResponse
+	refund    *service.RefundMessage
+	err       error
+}
+
+func (m *mockService) SetPaymentResponse(res *service.PaymentResponse) {
+	m.payment = res
+}
+
+func (m *mockService) CompletePayment(ctx context.Context, r service.RequestCompletePayment) (*service.PaymentResponse, error) {
+	m.Completes = append(m.Completes, r)
+	return m.payment, m.err
+}
+
+func (m *mockService) Capture(ctx context.Context, r service.RequestCapture) (*service.PaymentResponse, error) {
+	m.Captures = append(m.Captures, r)
+	return m.payment, m.err
+}
+
+func (m *mockService) Void(ctx context.Context, paymentID uint) (*service.PaymentResponse, error) {
+	m.Voids = append(m.Voids, paymentID)
+	return m.payment, m.err
+}
+
+func (m *mockService) ExpireAuthorizations(ctx context.Context, now time.Time, limit int) (int, error) {
+	return 0, m.err
+}
+
+func (m *mockService) GetPayment(ctx context.Context, id uint) (*service.PaymentTransactionResponse, error) {
+	m.Gets = append(m.Gets, id)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &service.PaymentTransactionResponse{ID: id, Status: constant.PaymentTranasctionStatusReject, Reason: "customer amount is not enough"}, nil
+}
+
+func (m *mockService) ListOrderPayments(ctx context.Context, orderID uint) ([]service.PaymentTransactionResponse, error) {
+	m.Gets = append(m.Gets, orderID)
+	return []service.PaymentTransactionResponse{{ID: 1, OrderID: orderID}}, m.err
+}
+
+func (m *mockService) ListPayments(ctx context.Context, r service.RequestListPayments) (*service.CursorPageResponse[service.PaymentTransactionResponse], error) {
+	m.Lists = append(m.Lists, r)
+	return &service.CursorPageResponse[service.PaymentTransactionResponse]{Items: []service.PaymentTransactionResponse{}, Size: 20, NextCursor: "7"}, m.err
+}
+
+func (m *mockService) ExpirePending(ctx context.Context, before time.Time, limit int) (int, error) {
+	return 0, m.err
+}
+
+func (m *mockService) PaymentQR(ctx context.Context, orderID uint) (*service.PaymentResponse, error) {
+	m.QRs = append(m.QRs, orderID)
+	return m.payment, m.err
+}
+
+func (m *mockService) SetRefund(res *service.RefundMessage, err error) {
+	m.refund = res
+	m.err = err
+}
+
+func (m *mockService) Refund(ctx context.Context, r service.RequestRefund) (*service.RefundMessage, error) {
+	m.Refunds = append(m.Refunds, r)
+	return m.refund, m.err
 }
 
 func (m *mockService) SetPayment(r service.RequestPayment, err error) {
@@ -27,25 +104,91 @@ func (m *mockService) SetPayment(r service.RequestPayment, err error) {
 	m.err = err
 }
 
-func (m *mockService) Payment(r service.RequestPayment) error {
-	return m.err
+func (m *mockService) Payment(ctx context.Context, r service.RequestPayment) (*service.PaymentResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.payment, m.err
+}
+
+type mockIdempotencyStorage struct {
+	keys        map[string]*storage.IdempotencyKey
+	Deleted     []string
+	completeErr error
+}
+
+func (m *mockIdempotencyStorage) SetComplete(err error) {
+	m.completeErr = err
+}
+
+func (m *mockIdempotencyStorage) Get(ctx context.Context, key string) (*storage.IdempotencyKey, error) {
+	k, ok := m.keys[key]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+func (m *mockIdempotencyStorage) Create(ctx context.Context, k *storage.IdempotencyKey) error {
+	if _, ok := m.keys[k.Key]; ok {
+		return storage.ErrIdempotencyKeyExists
+	}
+	c := *k
+	m.keys[k.Key] = &c
+	return nil
+}
+
+func (m *mockIdempotencyStorage) TakeOver(ctx context.Context, k *storage.IdempotencyKey, staleBefore time.Time) error {
+	v, ok := m.keys[k.Key]
+	if !ok || v.Completed || v.Fingerprint != k.Fingerprint || !v.CreatedAt.Before(staleBefore) {
+		return storage.ErrIdempotencyKeyExists
+	}
+	c := *k
+	m.keys[k.Key] = &c
+	return nil
+}
+
+func (m *mockIdempotencyStorage) Complete(ctx context.Context, k *storage.IdempotencyKey) error {
+	if m.completeErr != nil {
+		return m.completeErr
+	}
+	c := *k
+	m.keys[k.Key] = &c
+	return nil
+}
+
+func (m *mockIdempotencyStorage) Delete(ctx context.Context, k *storage.IdempotencyKey) error {
+	delete(m.keys, k.Key)
+	m.Deleted = append(m.Deleted, k.Key)
+	return nil
 }
 
 func TestPaymentHandler(t *testing.T) {
 
 	var (
 		m  *mockService
+		mi *mockIdempotencyStorage
 		h  PaymentHandler
 		rr *httptest.ResponseRecorder
 		r  *mux.Router
 	)
 
 	setup := func() {
-		m = &mockService{}
-		h = NewHandler(m)
+		m = &mockService{payment: &service.PaymentResponse{TransactionID: 1, OrderID: 1, Channel: constant.PaymentChannelDebit, Status: constant.PaymentTranasctionStatusConfirm, Amount: money.MustFromInt(100)}}
+		mi = &mockIdempotencyStorage{keys: map[string]*storage.IdempotencyKey{}}
+		h = NewHandler(m, mi, clock.NewClock(), PaymentHandlerConfig{})
 		rr = httptest.NewRecorder()
 		r = mux.NewRouter()
 		r.HandleFunc("/payment", h.Payment())
+		r.HandleFunc("/payment/{id}/refund", h.Refund()).Methods(http.MethodPost)
+		r.HandleFunc("/payment/{id}/capture", h.Capture()).Methods(http.MethodPost)
+		r.HandleFunc("/payment/{id}/void", h.Void()).Methods(http.MethodPost)
+		r.HandleFunc("/payments", h.ListPayments()).Methods(http.MethodGet)
+		r.HandleFunc("/payments/{id}", h.GetPayment()).Methods(http.MethodGet)
+		r.HandleFunc("/orders/{id}/payments", h.ListOrderPayments()).Methods(http.MethodGet)
+		r.HandleFunc("/orders/{id}/qr", h.QR()).Methods(http.MethodGet)
+		r.HandleFunc("/orders/{id}/qr.png", h.QRImage()).Methods(http.MethodGet)
 	}
 
 	t.Run("invalid request should return bad request", func(t *testing.T) {
@@ -59,19 +202,45 @@ func TestPaymentHandler(t *testing.T) {
 		r.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"code":"INVALID_REQUEST","message":"invalid request","retryable":false}`, rr.Body.String())
 		assert.Equal(t, 0, len(m.Calls))
 	})
 
-	t.Run("failed payment should return unprocessable entity when", func(t *testing.T) {
+	t.Run("request body over limit should return request entity too large when", func(t *testing.T) {
+		data := []string{"/payment", "/payment/1/refund", "/payment/1/capture"}
+		for _, v := range data {
+			t.Run(v, func(t *testing.T) {
+				setup()
+				body := `{"reason":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+				req, err := http.NewRequest(http.MethodPost, v, bytes.NewBufferString(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set(headerIdempotencyKey, "key-1")
+
+				r.ServeHTTP(rr, req)
+
+				assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+				assert.JSONEq(t, `{"code":"REQUEST_TOO_LARGE","message":"request body is too large","retryable":false}`, rr.Body.String())
+				assert.Equal(t, 0, len(mi.keys))
+				assert.Equal(t, 0, len(m.Refunds))
+				assert.Equal(t, 0, len(m.Captures))
+			})
+		}
+	})
+
+	t.Run("failed payment should return error status and code when", func(t *testing.T) {
 		data := []struct {
-			r   string
-			err error
+			r      string
+			err    *service.Error
+			status int
 		}{
-			{`{"orderID":1,"channel":"zebit","amount":100}`, errors.New("invalid payment channel")},
-			{`{"orderID":2,"channel":"debit","amount":100}`, errors.New("order status is not request payment")},
-			{`{"orderID":3,"channel":"debit","amount":100}`, errors.New("customer status is not active")},
-			{`{"orderID":4,"channel":"debit","amount":100}`, errors.New("customer amount is not enough")},
-			{`{"orderID":5,"channel":"debit","amount":100}`, errors.New("merchant status is not active")},
+			{`{"orderID":1,"channel":"zebit","amount":100}`, service.ErrInvalidPaymentChannel, http.StatusUnprocessableEntity},
+			{`{"orderID":2,"channel":"debit","amount":100}`, service.ErrOrderNotRequestPayment, http.StatusUnprocessableEntity},
+			{`{"orderID":3,"channel":"debit","amount":100}`, service.ErrCustomerNotActive, http.StatusUnprocessableEntity},
+			{`{"orderID":4,"channel":"debit","amount":100}`, service.ErrCustomerAmountNotEnough, http.StatusUnprocessableEntity},
+			{`{"orderID":5,"channel":"debit","amount":100}`, service.ErrMerchantNotActive, http.StatusUnprocessableEntity},
+			{`{"orderID":6,"channel":"debit","amount":100}`, service.ErrOrderNotFound, http.StatusNotFound},
 		}
 
 		for _, v := range data {
@@ -88,7 +257,9 @@ func TestPaymentHandler(t *testing.T) {
 
 				r.ServeHTTP(rr, req)
 
-				assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+				assert.Equal(t, v.status, rr.Code)
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+				assert.JSONEq(t, fmt.Sprintf(`{"code":%q,"message":%q,"retryable":false}`, v.err.Code, v.err.Message), rr.Body.String())
 				assert.Equal(t, 1, len(m.Calls))
 				assert.Equal(t, expected, m.Calls[0])
 			})
@@ -111,8 +282,396 @@ func TestPaymentHandler(t *testing.T) {
 		r.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.JSONEq(t, `{"code":"INTERNAL_ERROR","message":"internal error","retryable":true}`, rr.Body.String())
 		assert.Equal(t, 1, len(m.Calls))
 		assert.Equal(t, expected, m.Calls[0])
 	})
 
+	t.Run("confirmed payment should return ok with transaction", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(`{"orderID":1,"channel":"debit","amount":100}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"transactionID":1,"orderID":1,"channel":"debit","status":"comfirm","amount":100,"currency":"","settledAmount":0,"settledCurrency":"","feeAmount":0,"netAmount":0}`, rr.Body.String())
+	})
+
+	t.Run("pending qr payment should return accepted with qr payload", func(t *testing.T) {
+		setup()
+		m.SetPaymentResponse(&service.PaymentResponse{TransactionID: 1, OrderID: 1, Channel: constant.PaymentChannelPromptPay, Status: constant.PaymentTranasctionStatusPending, QRPayload: "000201"})
+		req, err := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(`{"orderID":1,"channel":"promptpay","amount":100}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"qrPayload":"000201"`)
+	})
+
+	newIdempotentRequest := func(key, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Idempotency-Key", key)
+		return req
+	}
+
+	t.Run("first request with idempotency key should store response", func(t *testing.T) {
+		setup()
+		reqStr := `{"orderID":1,"channel":"debit","amount":100}`
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", reqStr))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, true, mi.keys["key-1"].Completed)
+		assert.Equal(t, http.StatusOK, mi.keys["key-1"].StatusCode)
+		assert.NotEmpty(t, mi.keys["key-1"].Fingerprint)
+	})
+
+	t.Run("duplicate request with idempotency key should replay stored response without calling service", func(t *testing.T) {
+		setup()
+		reqStr := `{"orderID":4,"channel":"debit","amount":100}`
+		m.err = service.ErrCustomerAmountNotEnough
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", reqStr))
+		first := rr.Body.String()
+		m.err = nil
+		rr = httptest.NewRecorder()
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", reqStr))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, first, rr.Body.String())
+		assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("reused idempotency key with different request should return unprocessable entity", func(t *testing.T) {
+		setup()
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":100}`))
+		rr = httptest.NewRecorder()
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":1}`))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrIdempotencyKeyReused.Code)
+	})
+
+	t.Run("idempotency key still in progress should return conflict", func(t *testing.T) {
+		setup()
+		reqStr := `{"orderID":1,"channel":"debit","amount":100}`
+		req := newIdempotentRequest("key-1", reqStr)
+		mi.keys["key-1"] = &storage.IdempotencyKey{Key: "key-1", Fingerprint: fingerprint(req, []byte(reqStr)), CreatedAt: time.Now().UTC()}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("idempotency key in progress past its lease should be taken over", func(t *testing.T) {
+		setup()
+		reqStr := `{"orderID":1,"channel":"debit","amount":100}`
+		req := newIdempotentRequest("key-1", reqStr)
+		mi.keys["key-1"] = &storage.IdempotencyKey{Key: "key-1", Fingerprint: fingerprint(req, []byte(reqStr)), CreatedAt: time.Now().UTC().Add(-2 * time.Minute)}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, true, mi.keys["key-1"].Completed)
+	})
+
+	t.Run("idempotency key past its lease with different request should return unprocessable entity", func(t *testing.T) {
+		setup()
+		req := newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":100}`)
+		mi.keys["key-1"] = &storage.IdempotencyKey{Key: "key-1", Fingerprint: "other", CreatedAt: time.Now().UTC().Add(-2 * time.Minute)}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrIdempotencyKeyReused.Code)
+	})
+
+	t.Run("failing to complete idempotency key should still return response", func(t *testing.T) {
+		setup()
+		mi.SetComplete(errors.New("connection reset"))
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":100}`))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, false, mi.keys["key-1"].Completed)
+	})
+
+	t.Run("internal error should release idempotency key for retry", func(t *testing.T) {
+		setup()
+		m.err = errors.New("Unknow error")
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":100}`))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, []string{"key-1"}, mi.Deleted)
+		assert.Nil(t, mi.keys["key-1"])
+	})
+
+	t.Run("payment past request deadline should return gateway timeout and release idempotency key", func(t *testing.T) {
+		setup()
+		r.Use(Timeout(time.Nanosecond))
+
+		r.ServeHTTP(rr, newIdempotentRequest("key-1", `{"orderID":1,"channel":"debit","amount":100}`))
+
+		assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+		assert.JSONEq(t, `{"code":"REQUEST_TIMEOUT","message":"request timed out","retryable":true}`, rr.Body.String())
+		assert.Equal(t, []string{"key-1"}, mi.Deleted)
+	})
+
+	t.Run("refund should return created refund", func(t *testing.T) {
+		setup()
+		m.SetRefund(&service.RefundMessage{RefundID: 9, PaymentID: 3, OrderID: 1, Amount: money.MustFromInt(50), Status: "comfirm"}, nil)
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/refund", bytes.NewBufferString(`{"amount":50,"reason":"damaged"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, []service.RequestRefund{{PaymentID: 3, Amount: money.MustFromInt(50), Reason: "damaged"}}, m.Refunds)
+		assert.JSONEq(t, `{"refundID":9,"paymentID":3,"orderID":1,"status":"comfirm","amount":50,"reason":"","createdAt":"0001-01-01T00:00:00Z"}`, rr.Body.String())
+	})
+
+	t.Run("refund without body should request full refund", func(t *testing.T) {
+		setup()
+		m.SetRefund(&service.RefundMessage{RefundID: 9, PaymentID: 3}, nil)
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/refund", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, []service.RequestRefund{{PaymentID: 3}}, m.Refunds)
+	})
+
+	t.Run("refund unknown payment should return not found", func(t *testing.T) {
+		setup()
+		m.SetRefund(nil, service.ErrPaymentNotFound)
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/refund", bytes.NewBufferString(`{"amount":50}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("refund invalid payment id should return bad request", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodPost, "/payment/abc/refund", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Refunds))
+	})
+
+	t.Run("capture should capture requested amount", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/capture", bytes.NewBufferString(`{"amount":40.5}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestCapture{{PaymentID: 3, Amount: money.MustParse("40.5")}}, m.Captures)
+	})
+
+	t.Run("capture without body should capture authorized amount", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/capture", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestCapture{{PaymentID: 3}}, m.Captures)
+	})
+
+	t.Run("capture of payment that is not authorized should return conflict", func(t *testing.T) {
+		setup()
+		m.err = service.ErrPaymentNotAuthorized
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/capture", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("void should void payment", func(t *testing.T) {
+		setup()
+		m.SetPaymentResponse(&service.PaymentResponse{TransactionID: 3, Status: constant.PaymentTranasctionStatusVoid})
+		req, err := http.NewRequest(http.MethodPost, "/payment/3/void", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []uint{3}, m.Voids)
+		assert.Contains(t, rr.Body.String(), `"status":"void"`)
+	})
+
+	t.Run("void invalid payment id should return bad request", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodPost, "/payment/abc/void", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, 0, len(m.Voids))
+	})
+
+	t.Run("get payment should return transaction with reason", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodGet, "/payments/3", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []uint{3}, m.Gets)
+		assert.Contains(t, rr.Body.String(), `"reason":"customer amount is not enough"`)
+	})
+
+	t.Run("get unknown payment should return not found", func(t *testing.T) {
+		setup()
+		m.err = service.ErrPaymentNotFound
+		req, err := http.NewRequest(http.MethodGet, "/payments/3", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("list payments should parse filters from query", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodGet, "/payments?status=reject&channel=debit&merchantID=4&from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&cursor=10&size=5", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestListPayments{{
+			Status:     constant.PaymentTranasctionStatusReject,
+			Channel:    constant.PaymentChannelDebit,
+			MerchantID: 4,
+			From:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:         time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			Cursor:     "10",
+			Size:       5,
+		}}, m.Lists)
+		assert.JSONEq(t, `{"items":[],"size":20,"nextCursor":"7"}`, rr.Body.String())
+	})
+
+	t.Run("list payments with invalid query should return bad request", func(t *testing.T) {
+		data := []string{"merchantID=abc", "from=yesterday", "to=2024-01-02", "size=x"}
+		for _, v := range data {
+			t.Run(v, func(t *testing.T) {
+				setup()
+				req, err := http.NewRequest(http.MethodGet, "/payments?"+v, http.NoBody)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				r.ServeHTTP(rr, req)
+
+				assert.Equal(t, http.StatusBadRequest, rr.Code)
+				assert.Equal(t, 0, len(m.Lists))
+			})
+		}
+	})
+
+	t.Run("list order payments should return transactions of order", func(t *testing.T) {
+		setup()
+		req, err := http.NewRequest(http.MethodGet, "/orders/5/payments", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []uint{5}, m.Gets)
+		assert.Contains(t, rr.Body.String(), `"orderID":5`)
+	})
+
+	t.Run("qr should return payload of pending payment", func(t *testing.T) {
+		setup()
+		m.SetPaymentResponse(&service.PaymentResponse{TransactionID: 1, OrderID: 5, Status: constant.PaymentTranasctionStatusPending, QRPayload: "000201"})
+		req, err := http.NewRequest(http.MethodGet, "/orders/5/qr", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []uint{5}, m.QRs)
+		assert.Contains(t, rr.Body.String(), `"qrPayload":"000201"`)
+	})
+
+	t.Run("qr image should return png", func(t *testing.T) {
+		setup()
+		m.SetPaymentResponse(&service.PaymentResponse{QRPayload: "000201"})
+		req, err := http.NewRequest(http.MethodGet, "/orders/5/qr.png", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+		assert.True(t, bytes.HasPrefix(rr.Body.Bytes(), []byte("\x89PNG")))
+	})
+
+	t.Run("qr of order without pending payment should return not found", func(t *testing.T) {
+		setup()
+		m.err = service.ErrPaymentNotFound
+		req, err := http.NewRequest(http.MethodGet, "/orders/5/qr.png", http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	})
 }
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+// maxBodyBytes is the largest request body a handler reads. A larger one is
+// refused with service.ErrRequestTooLarge.
+const maxBodyBytes = 1 << 20
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	return b, nil
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v); err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+func bodyError(err error) error {
+	var me *http.MaxBytesError
+	if errors.As(err, &me) {
+		return service.ErrRequestTooLarge
+	}
+	return service.ErrInvalidRequest
+}
+
+func pathID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 0)
+	if err != nil {
+		return 0, service.ErrInvalidRequest
+	}
+	return uint(id), nil
+}
+
+func queryInt(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, service.ErrInvalidRequest
+	}
+	return n, nil
+}
+
+func queryUint(r *http.Request, name string) (uint, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 0)
+	if err != nil {
+		return 0, service.ErrInvalidRequest
+	}
+	return uint(n), nil
+}
+
+// queryTime reads an RFC 3339 timestamp.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, service.ErrInvalidRequest
+	}
+	return t, nil
+}
+
+func pageQuery(r *http.Request) (service.RequestPage, error) {
+	page, err := queryInt(r, "page")
+	if err != nil {
+		return service.RequestPage{}, err
+	}
+	size, err := queryInt(r, "size")
+	if err != nil {
+		return service.RequestPage{}, err
+	}
+	return service.RequestPage{Page: page, Size: size}, nil
+}
+
+func listPaymentsQuery(r *http.Request) (service.RequestListPayments, error) {
+	q := r.URL.Query()
+	req := service.RequestListPayments{
+		Status:  constant.PaymentTranasctionStatus(q.Get("status")),
+		Channel: constant.PaymentChannel(q.Get("channel")),
+		Cursor:  q.Get("cursor"),
+	}
+	var err error
+	if req.MerchantID, err = queryUint(r, "merchantID"); err != nil {
+		return req, err
+	}
+	if req.From, err = queryTime(r, "from"); err != nil {
+		return req, err
+	}
+	if req.To, err = queryTime(r, "to"); err != nil {
+		return req, err
+	}
+	if req.Size, err = queryInt(r, "size"); err != nil {
+		return req, err
+	}
+	return req, nil
+}
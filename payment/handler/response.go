@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError reports catalogue errors as they are, a cancelled or expired
+// request as service.ErrRequestTimeout and hides anything else behind
+// service.ErrInternal.
+func writeError(w http.ResponseWriter, err error) {
+	var e *service.Error
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		e = service.ErrRequestTimeout
+	default:
+		log.Printf("unexpected error: %v", err)
+		e = service.ErrInternal
+	}
+	writeJSON(w, e.HTTPStatus, errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		Retryable: e.Retryable,
+	})
+}
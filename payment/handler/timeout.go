@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout gives every request a deadline of d. The services stop their
+// queries once it passes, and the client gets service.ErrRequestTimeout.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
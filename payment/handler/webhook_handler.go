@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the webhook body.
+const SignatureHeader = "X-Signature"
+
+type WebhookConfig struct {
+	// Secrets holds the key each channel signs its webhooks with. Channels
+	// without a secret cannot call us.
+	Secrets map[constant.PaymentChannel]string
+}
+
+type WebhookHandler interface {
+	Webhook() http.HandlerFunc
+}
+
+type webhookHandler struct {
+	p   service.Service
+	cfg WebhookConfig
+}
+
+func NewWebhookHandler(p service.Service, cfg WebhookConfig) WebhookHandler {
+	return &webhookHandler{
+		p:   p,
+		cfg: cfg,
+	}
+}
+
+func (h *webhookHandler) Webhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ch := constant.PaymentChannel(mux.Vars(r)["channel"])
+		secret, ok := h.cfg.Secrets[ch]
+		if !ok || secret == "" {
+			writeError(w, service.ErrInvalidPaymentChannel)
+			return
+		}
+		b, err := readBody(w, r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !validSignature(secret, b, r.Header.Get(SignatureHeader)) {
+			writeError(w, service.ErrInvalidSignature)
+			return
+		}
+
+		var req service.RequestCompletePayment
+		if err := json.Unmarshal(b, &req); err != nil {
+			writeError(w, service.ErrInvalidRequest)
+			return
+		}
+		req.Channel = ch
+
+		res, err := h.p.CompletePayment(r.Context(), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// Sign returns the signature a channel sends for body.
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func validSignature(secret string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	want, _ := hex.DecodeString(Sign(secret, body))
+	return hmac.Equal(got, want)
+}
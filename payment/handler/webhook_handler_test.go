@@ -0,0 +1,118 @@
+//go:build unit_test
+// +build unit_test
+
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookHandler(t *testing.T) {
+
+	var (
+		m  *mockService
+		h  WebhookHandler
+		rr *httptest.ResponseRecorder
+		r  *mux.Router
+	)
+
+	setup := func() {
+		m = &mockService{payment: &service.PaymentResponse{TransactionID: 3, OrderID: 7, Channel: constant.PaymentChannelPromptPay, Status: constant.PaymentTranasctionStatusConfirm}}
+		h = NewWebhookHandler(m, WebhookConfig{Secrets: map[constant.PaymentChannel]string{constant.PaymentChannelPromptPay: "s3cret"}})
+		rr = httptest.NewRecorder()
+		r = mux.NewRouter()
+		r.HandleFunc("/webhooks/{channel}", h.Webhook()).Methods(http.MethodPost)
+	}
+
+	newRequest := func(channel, body, signature string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/webhooks/"+channel, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(SignatureHeader, signature)
+		return req
+	}
+
+	t.Run("signed webhook should complete payment of channel", func(t *testing.T) {
+		setup()
+		body := `{"transactionID":3,"result":"success","providerRef":"bank-123"}`
+
+		r.ServeHTTP(rr, newRequest("promptpay", body, Sign("s3cret", []byte(body))))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []service.RequestCompletePayment{{Channel: constant.PaymentChannelPromptPay, TransactionID: 3, Result: service.PaymentResultSuccess, ProviderRef: "bank-123"}}, m.Completes)
+		assert.Contains(t, rr.Body.String(), `"status":"comfirm"`)
+	})
+
+	t.Run("invalid signature should return unauthorized without completing payment", func(t *testing.T) {
+		data := []struct {
+			name      string
+			signature string
+		}{
+			{"missing", ""},
+			{"not hex", "zz"},
+			{"wrong secret", Sign("other", []byte(`{"transactionID":3,"result":"success"}`))},
+			{"other body", Sign("s3cret", []byte(`{"transactionID":4,"result":"success"}`))},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				setup()
+
+				r.ServeHTTP(rr, newRequest("promptpay", `{"transactionID":3,"result":"success"}`, v.signature))
+
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+				assert.Contains(t, rr.Body.String(), service.ErrInvalidSignature.Code)
+				assert.Equal(t, 0, len(m.Completes))
+			})
+		}
+	})
+
+	t.Run("channel without secret should be refused", func(t *testing.T) {
+		setup()
+		body := `{"transactionID":3,"result":"success"}`
+
+		r.ServeHTTP(rr, newRequest("debit", body, Sign("s3cret", []byte(body))))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, 0, len(m.Completes))
+	})
+
+	t.Run("signed invalid body should return bad request", func(t *testing.T) {
+		setup()
+		body := `not json`
+
+		r.ServeHTTP(rr, newRequest("promptpay", body, Sign("s3cret", []byte(body))))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("body over limit should return request entity too large without completing payment", func(t *testing.T) {
+		setup()
+		body := `{"transactionID":3,"result":"failed","reason":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+
+		r.ServeHTTP(rr, newRequest("promptpay", body, Sign("s3cret", []byte(body))))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Contains(t, rr.Body.String(), service.ErrRequestTooLarge.Code)
+		assert.Equal(t, 0, len(m.Completes))
+	})
+
+	t.Run("payment no longer pending should return conflict", func(t *testing.T) {
+		setup()
+		m.err = service.ErrPaymentNotPending
+		body := `{"transactionID":3,"result":"failed"}`
+
+		r.ServeHTTP(rr, newRequest("promptpay", body, Sign("s3cret", []byte(body))))
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
@@ -0,0 +1,146 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Component is a part of the server the manager starts and stops. Either
+// func may be nil.
+type Component struct {
+	Name string
+	// Run runs the component until its ctx is done. It is started in its own
+	// goroutine; returning an error shuts the server down.
+	Run func(ctx context.Context) error
+	// Stop releases the component once every component registered after it
+	// has stopped. It should give up when ctx is done.
+	Stop func(ctx context.Context) error
+}
+
+type ManagerConfig struct {
+	// ShutdownTimeout bounds stopping all the components.
+	ShutdownTimeout time.Duration
+	// Signals shut the server down, SIGINT and SIGTERM by default.
+	Signals []os.Signal
+}
+
+type Manager interface {
+	// Register adds a component. Components start in the order they are
+	// registered and stop in reverse, so register each one after the
+	// components it uses.
+	Register(c Component)
+	// Run starts the components and blocks until ctx is done, a signal
+	// arrives or a component fails, then stops them all.
+	Run(ctx context.Context) error
+}
+
+type manager struct {
+	cfg        ManagerConfig
+	components []Component
+}
+
+func NewManager(cfg ManagerConfig) Manager {
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 15 * time.Second
+	}
+	if len(cfg.Signals) == 0 {
+		cfg.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return &manager{cfg: cfg}
+}
+
+func (m *manager) Register(c Component) {
+	m.components = append(m.components, c)
+}
+
+// running is a started component. done is closed once Run has returned.
+type running struct {
+	Component
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (m *manager) Run(ctx context.Context) error {
+	ctx, stopSignals := signal.NotifyContext(ctx, m.cfg.Signals...)
+	defer stopSignals()
+
+	failed := make(chan error, len(m.components))
+	rs := make([]*running, len(m.components))
+	for i, c := range m.components {
+		r := &running{Component: c, cancel: func() {}, done: make(chan struct{})}
+		rs[i] = r
+		if c.Run == nil {
+			close(r.done)
+			continue
+		}
+		// Each component is cancelled on its turn to stop, not all at once
+		runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		r.cancel = cancel
+		go func() {
+			defer close(r.done)
+			if err := c.Run(runCtx); err != nil {
+				failed <- fmt.Errorf("lifecycle: %s: %w", c.Name, err)
+			}
+		}()
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		log.Println("lifecycle: shutting down")
+	case err := <-failed:
+		log.Printf("lifecycle: shutting down: %v", err)
+		errs = append(errs, err)
+	}
+	// A second signal kills the process as if none were handled
+	stopSignals()
+
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.cfg.ShutdownTimeout)
+	defer cancel()
+	for i := len(rs) - 1; i >= 0; i-- {
+		errs = append(errs, stop(stopCtx, rs[i]))
+	}
+	for {
+		select {
+		case err := <-failed:
+			errs = append(errs, err)
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// stop stops r and waits for its Run to return. Once ctx is done it waits no
+// more, so the components after r are still stopped.
+func stop(ctx context.Context, r *running) error {
+	log.Printf("lifecycle: stopping %s", r.Name)
+	var err error
+	if r.Stop != nil {
+		err = r.Stop(ctx)
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("lifecycle: stop %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// Worker is a component running run until it is stopped, like the loops of
+// the background workers.
+func Worker(name string, run func(ctx context.Context)) Component {
+	return Component{Name: name, Run: func(ctx context.Context) error {
+		run(ctx)
+		return nil
+	}}
+}
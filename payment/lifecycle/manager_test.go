@@ -0,0 +1,156 @@
+//go:build unit_test
+// +build unit_test
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(e string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestManager(t *testing.T) {
+	var rec *recorder
+	var m Manager
+
+	setup := func(cfg ManagerConfig) {
+		rec = &recorder{}
+		m = NewManager(cfg)
+	}
+
+	// worker runs until cancelled like the background workers do
+	worker := func(name string) Component {
+		return Component{Name: name, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			rec.add(name + " returned")
+			return nil
+		}}
+	}
+
+	closer := func(name string, err error) Component {
+		return Component{Name: name, Stop: func(ctx context.Context) error {
+			rec.add(name + " closed")
+			return err
+		}}
+	}
+
+	t.Run("cancel should stop components in reverse order of registration", func(t *testing.T) {
+		//Arrange
+		setup(ManagerConfig{})
+		ctx, cancel := context.WithCancel(context.Background())
+		m.Register(closer("database", nil))
+		m.Register(closer("producer", nil))
+		m.Register(worker("relay"))
+		m.Register(Component{Name: "http", Run: func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return nil
+		}, Stop: func(ctx context.Context) error {
+			rec.add("http drained")
+			return nil
+		}})
+
+		//Action
+		err := m.Run(ctx)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"http drained", "relay returned", "producer closed", "database closed"}, rec.Events())
+	})
+
+	t.Run("failing component should stop the rest and return its error", func(t *testing.T) {
+		//Arrange
+		setup(ManagerConfig{})
+		m.Register(closer("database", nil))
+		m.Register(worker("relay"))
+		m.Register(Component{Name: "http", Run: func(ctx context.Context) error {
+			return errors.New("address already in use")
+		}})
+
+		//Action
+		err := m.Run(context.Background())
+
+		//Assert
+		assert.EqualError(t, err, "lifecycle: http: address already in use")
+		assert.Equal(t, []string{"relay returned", "database closed"}, rec.Events())
+	})
+
+	t.Run("stop errors should be returned after stopping the rest", func(t *testing.T) {
+		//Arrange
+		setup(ManagerConfig{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		m.Register(closer("database", nil))
+		m.Register(closer("producer", errors.New("broken pipe")))
+
+		//Action
+		err := m.Run(ctx)
+
+		//Assert
+		assert.EqualError(t, err, "lifecycle: stop producer: broken pipe")
+		assert.Equal(t, []string{"producer closed", "database closed"}, rec.Events())
+	})
+
+	t.Run("component past the deadline should not hold up the rest", func(t *testing.T) {
+		//Arrange
+		setup(ManagerConfig{ShutdownTimeout: 50 * time.Millisecond})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stuck := make(chan struct{})
+		defer close(stuck)
+		m.Register(closer("database", nil))
+		m.Register(Component{Name: "settlement", Run: func(ctx context.Context) error {
+			<-stuck
+			return nil
+		}})
+
+		//Action
+		err := m.Run(ctx)
+
+		//Assert
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "lifecycle: stop settlement")
+		assert.Equal(t, []string{"database closed"}, rec.Events())
+	})
+
+	t.Run("signal should shut down", func(t *testing.T) {
+		//Arrange
+		setup(ManagerConfig{Signals: []os.Signal{syscall.SIGUSR1}})
+		m.Register(closer("database", nil))
+		m.Register(Component{Name: "signaller", Run: func(ctx context.Context) error {
+			syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			<-ctx.Done()
+			return nil
+		}})
+
+		//Action
+		err := m.Run(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"database closed"}, rec.Events())
+	})
+}
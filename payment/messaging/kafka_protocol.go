@@ -0,0 +1,374 @@
+package messaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Subset of the Kafka wire protocol needed to produce records:
+// Metadata v1 to find partition leaders and Produce v3 carrying a v2 record batch.
+const (
+	kafkaAPIProduce  int16 = 0
+	kafkaAPIMetadata int16 = 3
+
+	kafkaProduceVersion  int16 = 3
+	kafkaMetadataVersion int16 = 1
+
+	kafkaRecordBatchMagic int8 = 2
+)
+
+const (
+	kafkaErrNone                    int16 = 0
+	kafkaErrUnknownTopicOrPartition int16 = 3
+	kafkaErrLeaderNotAvailable      int16 = 5
+	kafkaErrNotLeaderForPartition   int16 = 6
+	kafkaErrRequestTimedOut         int16 = 7
+	kafkaErrNetworkException        int16 = 13
+	kafkaErrNotEnoughReplicas       int16 = 19
+	kafkaErrNotEnoughReplicasAfter  int16 = 20
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type KafkaError struct {
+	Code      int16
+	Topic     string
+	Partition int32
+}
+
+func (e *KafkaError) Error() string {
+	return fmt.Sprintf("kafka: topic %s partition %d: error code %d", e.Topic, e.Partition, e.Code)
+}
+
+type kafkaNetworkError struct {
+	err error
+}
+
+func (e *kafkaNetworkError) Error() string {
+	return fmt.Sprintf("kafka: network: %v", e.err)
+}
+
+func (e *kafkaNetworkError) Unwrap() error {
+	return e.err
+}
+
+func isRetriableKafkaError(err error) bool {
+	var n *kafkaNetworkError
+	if errors.As(err, &n) {
+		return true
+	}
+	var k *KafkaError
+	if !errors.As(err, &k) {
+		return false
+	}
+	switch k.Code {
+	case kafkaErrUnknownTopicOrPartition,
+		kafkaErrLeaderNotAvailable,
+		kafkaErrNotLeaderForPartition,
+		kafkaErrRequestTimedOut,
+		kafkaErrNetworkException,
+		kafkaErrNotEnoughReplicas,
+		kafkaErrNotEnoughReplicasAfter:
+		return true
+	default:
+		return false
+	}
+}
+
+type kafkaRecord struct {
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+}
+
+type kafkaBroker struct {
+	NodeID int32
+	Host   string
+	Port   int32
+}
+
+type kafkaTopicMetadata struct {
+	ErrorCode  int16
+	Name       string
+	Partitions []kafkaPartition
+}
+
+type kafkaMetadata struct {
+	Brokers []kafkaBroker
+	Topics  []kafkaTopicMetadata
+}
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) { e.b = append(e.b, byte(v)) }
+
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) varint(v int64) { e.b = binary.AppendVarint(e.b, v) }
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) varbytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	v := d.take(1)
+	if v == nil {
+		return 0
+	}
+	return int8(v[0])
+}
+
+func (d *decoder) int16() int16 {
+	v := d.take(2)
+	if v == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(v))
+}
+
+func (d *decoder) int32() int32 {
+	v := d.take(4)
+	if v == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(v))
+}
+
+func (d *decoder) int64() int64 {
+	v := d.take(8)
+	if v == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+func encodeRequest(apiKey, apiVersion int16, correlationID int32, clientID string, body []byte) []byte {
+	h := encoder{}
+	h.int16(apiKey)
+	h.int16(apiVersion)
+	h.int32(correlationID)
+	h.string(clientID)
+	e := encoder{}
+	e.int32(int32(len(h.b) + len(body)))
+	e.b = append(e.b, h.b...)
+	e.b = append(e.b, body...)
+	return e.b
+}
+
+func readResponse(r io.Reader) (int32, []byte, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(r, size); err != nil {
+		return 0, nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 4 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return int32(binary.BigEndian.Uint32(b)), b[4:], nil
+}
+
+func encodeMetadataRequest(topics ...string) []byte {
+	e := encoder{}
+	e.int32(int32(len(topics)))
+	for _, t := range topics {
+		e.string(t)
+	}
+	return e.b
+}
+
+func decodeMetadataResponse(b []byte) (*kafkaMetadata, error) {
+	d := decoder{b: b}
+	m := &kafkaMetadata{}
+	for i, n := 0, d.arrayLen(); i < n && d.err == nil; i++ {
+		br := kafkaBroker{NodeID: d.int32(), Host: d.string(), Port: d.int32()}
+		d.string() // rack
+		m.Brokers = append(m.Brokers, br)
+	}
+	d.int32() // controller id
+	for i, n := 0, d.arrayLen(); i < n && d.err == nil; i++ {
+		t := kafkaTopicMetadata{ErrorCode: d.int16(), Name: d.string()}
+		d.int8() // is internal
+		for j, pn := 0, d.arrayLen(); j < pn && d.err == nil; j++ {
+			d.int16() // partition error code
+			p := kafkaPartition{ID: d.int32(), Leader: d.int32()}
+			for k, rn := 0, d.arrayLen(); k < rn; k++ {
+				d.int32() // replicas
+			}
+			for k, in := 0, d.arrayLen(); k < in; k++ {
+				d.int32() // isr
+			}
+			t.Partitions = append(t.Partitions, p)
+		}
+		m.Topics = append(m.Topics, t)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("kafka: decode metadata response: %w", d.err)
+	}
+	return m, nil
+}
+
+func encodeProduceRequest(acks int16, timeout time.Duration, topic string, partition int32, batch []byte) []byte {
+	e := encoder{}
+	e.int16(-1) // transactional id
+	e.int16(acks)
+	e.int32(int32(timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(1)
+	e.int32(partition)
+	e.bytes(batch)
+	return e.b
+}
+
+func decodeProduceResponse(b []byte, topic string, partition int32) (int16, error) {
+	d := decoder{b: b}
+	for i, n := 0, d.arrayLen(); i < n && d.err == nil; i++ {
+		name := d.string()
+		for j, pn := 0, d.arrayLen(); j < pn && d.err == nil; j++ {
+			id := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && name == topic && id == partition {
+				return code, nil
+			}
+		}
+	}
+	if d.err != nil {
+		return 0, fmt.Errorf("kafka: decode produce response: %w", d.err)
+	}
+	return 0, fmt.Errorf("kafka: produce response missing %s[%d]", topic, partition)
+}
+
+func encodeRecordBatch(records []kafkaRecord) []byte {
+	base := records[0].Timestamp.UnixMilli()
+	maxTs := base
+	body := encoder{}
+	for i, r := range records {
+		ts := r.Timestamp.UnixMilli()
+		if ts > maxTs {
+			maxTs = ts
+		}
+		rec := encoder{}
+		rec.int8(0) // attributes
+		rec.varint(ts - base)
+		rec.varint(int64(i))
+		rec.varbytes(r.Key)
+		rec.varbytes(r.Value)
+		rec.varint(0) // headers
+		body.varint(int64(len(rec.b)))
+		body.b = append(body.b, rec.b...)
+	}
+
+	// Everything after the crc field is covered by the checksum.
+	crcd := encoder{}
+	crcd.int16(0) // attributes: no compression
+	crcd.int32(int32(len(records) - 1))
+	crcd.int64(base)
+	crcd.int64(maxTs)
+	crcd.int64(-1) // producer id
+	crcd.int16(-1) // producer epoch
+	crcd.int32(-1) // base sequence
+	crcd.int32(int32(len(records)))
+	crcd.b = append(crcd.b, body.b...)
+
+	e := encoder{}
+	e.int64(0) // base offset
+	e.int32(int32(4 + 1 + 4 + len(crcd.b)))
+	e.int32(-1) // partition leader epoch
+	e.int8(kafkaRecordBatchMagic)
+	e.int32(int32(crc32.Checksum(crcd.b, crc32c)))
+	e.b = append(e.b, crcd.b...)
+	return e.b
+}
@@ -1,21 +1,289 @@
 package messaging
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
 type KafkaProducer interface {
-	Publish(RequestPublish) error
+	Publish(ctx context.Context, r RequestPublish) error
+	Close() error
 }
 
-type kafkaProducer struct {
-}
 type RequestPublish struct {
 	Topic   string
 	Key     string
 	Message any
 }
 
-func NewKafkaProducer() KafkaProducer {
-	return &kafkaProducer{}
+type KafkaAcks int16
+
+const (
+	KafkaAcksNone   KafkaAcks = 0
+	KafkaAcksLeader KafkaAcks = 1
+	KafkaAcksAll    KafkaAcks = -1
+)
+
+type KafkaConfig struct {
+	Brokers      []string
+	ClientID     string
+	Acks         KafkaAcks
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Timeout the broker waits for the required acks before answering.
+	RequestTimeout time.Duration
+	Retries        int
+	RetryBackoff   time.Duration
+}
+
+func (c KafkaConfig) withDefaults() KafkaConfig {
+	if c.ClientID == "" {
+		c.ClientID = "payment"
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = 5 * time.Second
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = 10 * time.Second
+	}
+	if c.RequestTimeout == 0 {
+		c.RequestTimeout = 5 * time.Second
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	return c
+}
+
+type kafkaProducer struct {
+	cfg KafkaConfig
+
+	mu            sync.Mutex
+	conns         map[string]*kafkaConn
+	brokers       map[int32]string
+	partitions    map[string][]kafkaPartition
+	correlationID int32
+	roundRobin    uint32
+}
+
+type kafkaPartition struct {
+	ID     int32
+	Leader int32
+}
+
+type kafkaConn struct {
+	net.Conn
+}
+
+var ErrKafkaNoBrokers = errors.New("kafka: no brokers configured")
+
+func NewKafkaProducer(cfg KafkaConfig) KafkaProducer {
+	return &kafkaProducer{
+		cfg:        cfg.withDefaults(),
+		conns:      map[string]*kafkaConn{},
+		brokers:    map[int32]string{},
+		partitions: map[string][]kafkaPartition{},
+	}
+}
+
+// Publish sends r to the leader of its partition. Cancelling ctx or reaching
+// its deadline aborts dialing, the round trip and the retry backoff.
+func (s *kafkaProducer) Publish(ctx context.Context, r RequestPublish) error {
+	if len(s.cfg.Brokers) == 0 {
+		return ErrKafkaNoBrokers
+	}
+	value, err := json.Marshal(r.Message)
+	if err != nil {
+		return fmt.Errorf("kafka: marshal message: %w", err)
+	}
+	var key []byte
+	if r.Key != "" {
+		key = []byte(r.Key)
+	}
+	record := kafkaRecord{
+		Key:       key,
+		Value:     value,
+		Timestamp: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err = s.produce(ctx, r.Topic, record)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= s.cfg.Retries || !isRetriableKafkaError(err) {
+			return err
+		}
+		delete(s.partitions, r.Topic)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.cfg.RetryBackoff):
+		}
+	}
+}
+
+func (s *kafkaProducer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for addr, c := range s.conns {
+		errs = append(errs, c.Close())
+		delete(s.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *kafkaProducer) produce(ctx context.Context, topic string, record kafkaRecord) error {
+	partitions, err := s.topicPartitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+	p := partitions[s.partition(record.Key, len(partitions))]
+	addr, ok := s.brokers[p.Leader]
+	if !ok {
+		return &KafkaError{Code: kafkaErrLeaderNotAvailable, Topic: topic, Partition: p.ID}
+	}
+
+	req := encodeProduceRequest(int16(s.cfg.Acks), s.cfg.RequestTimeout, topic, p.ID, encodeRecordBatch([]kafkaRecord{record}))
+	if s.cfg.Acks == KafkaAcksNone {
+		return s.send(ctx, addr, kafkaAPIProduce, kafkaProduceVersion, req)
+	}
+	res, err := s.roundTrip(ctx, addr, kafkaAPIProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+	code, err := decodeProduceResponse(res, topic, p.ID)
+	if err != nil {
+		return err
+	}
+	if code != kafkaErrNone {
+		return &KafkaError{Code: code, Topic: topic, Partition: p.ID}
+	}
+	return nil
+}
+
+func (s *kafkaProducer) partition(key []byte, n int) int {
+	if key == nil {
+		s.roundRobin++
+		return int(s.roundRobin % uint32(n))
+	}
+	return int(toPositive(murmur2(key)) % int32(n))
 }
 
-func (s *kafkaProducer) Publish(r RequestPublish) error {
+func (s *kafkaProducer) topicPartitions(ctx context.Context, topic string) ([]kafkaPartition, error) {
+	if p, ok := s.partitions[topic]; ok {
+		return p, nil
+	}
+	var lastErr error
+	for _, addr := range s.cfg.Brokers {
+		res, err := s.roundTrip(ctx, addr, kafkaAPIMetadata, kafkaMetadataVersion, encodeMetadataRequest(topic))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		m, err := decodeMetadataResponse(res)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, b := range m.Brokers {
+			s.brokers[b.NodeID] = net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+		}
+		for _, t := range m.Topics {
+			if t.Name != topic {
+				continue
+			}
+			if t.ErrorCode != kafkaErrNone {
+				return nil, &KafkaError{Code: t.ErrorCode, Topic: topic, Partition: -1}
+			}
+			if len(t.Partitions) == 0 {
+				return nil, &KafkaError{Code: kafkaErrLeaderNotAvailable, Topic: topic, Partition: -1}
+			}
+			s.partitions[topic] = t.Partitions
+			return t.Partitions, nil
+		}
+		lastErr = &KafkaError{Code: kafkaErrUnknownTopicOrPartition, Topic: topic, Partition: -1}
+	}
+	return nil, lastErr
+}
+
+func (s *kafkaProducer) conn(ctx context.Context, addr string) (*kafkaConn, error) {
+	if c, ok := s.conns[addr]; ok {
+		return c, nil
+	}
+	d := net.Dialer{Timeout: s.cfg.DialTimeout}
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, &kafkaNetworkError{err: err}
+	}
+	s.conns[addr] = &kafkaConn{Conn: c}
+	return s.conns[addr], nil
+}
+
+func (s *kafkaProducer) send(ctx context.Context, addr string, apiKey, apiVersion int16, body []byte) error {
+	c, err := s.conn(ctx, addr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+	s.correlationID++
+	c.SetWriteDeadline(deadline(ctx, s.cfg.WriteTimeout))
+	if _, err := c.Write(encodeRequest(apiKey, apiVersion, s.correlationID, s.cfg.ClientID, body)); err != nil {
+		s.dropConn(addr)
+		return &kafkaNetworkError{err: err}
+	}
 	return nil
 }
+
+func (s *kafkaProducer) roundTrip(ctx context.Context, addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	if err := s.send(ctx, addr, apiKey, apiVersion, body); err != nil {
+		return nil, err
+	}
+	c := s.conns[addr]
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+	c.SetReadDeadline(deadline(ctx, s.cfg.WriteTimeout+s.cfg.RequestTimeout))
+	id, res, err := readResponse(c)
+	if err != nil {
+		s.dropConn(addr)
+		return nil, &kafkaNetworkError{err: err}
+	}
+	if id != s.correlationID {
+		s.dropConn(addr)
+		return nil, fmt.Errorf("kafka: correlation id mismatch: expected %d got %d", s.correlationID, id)
+	}
+	return res, nil
+}
+
+func (s *kafkaProducer) dropConn(addr string) {
+	if c, ok := s.conns[addr]; ok {
+		c.Close()
+		delete(s.conns, addr)
+	}
+}
+
+// deadline is d from now, or the deadline of ctx when that comes first.
+func deadline(ctx context.Context, d time.Duration) time.Time {
+	t := time.Now().Add(d)
+	if v, ok := ctx.Deadline(); ok && v.Before(t) {
+		return v
+	}
+	return t
+}
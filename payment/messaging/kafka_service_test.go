@@ -0,0 +1,380 @@
+//go:build unit_test
+// +build unit_test
+
+package messaging
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type producedRecord struct {
+	Topic     string
+	Partition int32
+	Acks      int16
+	Key       []byte
+	Value     []byte
+}
+
+type fakeKafkaBroker struct {
+	l          net.Listener
+	partitions int32
+
+	mu        sync.Mutex
+	Records   []producedRecord
+	Metadata  int
+	errCodes  []int16
+	crcFailed bool
+}
+
+func newFakeKafkaBroker(t *testing.T, partitions int32) *fakeKafkaBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	b := &fakeKafkaBroker{l: l, partitions: partitions}
+	go b.serve()
+	t.Cleanup(func() { l.Close() })
+	return b
+}
+
+func (b *fakeKafkaBroker) Addr() string {
+	return b.l.Addr().String()
+}
+
+// SetProduceErrors makes the next produce requests answer with the given error codes in order.
+func (b *fakeKafkaBroker) SetProduceErrors(codes ...int16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errCodes = codes
+}
+
+func (b *fakeKafkaBroker) serve() {
+	for {
+		c, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+func (b *fakeKafkaBroker) handle(c net.Conn) {
+	defer c.Close()
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(c, size); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size))
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+		d := decoder{b: req}
+		apiKey := d.int16()
+		d.int16() // version
+		correlationID := d.int32()
+		d.string() // client id
+
+		var body []byte
+		switch apiKey {
+		case kafkaAPIMetadata:
+			body = b.metadata(&d)
+		case kafkaAPIProduce:
+			var acks int16
+			body, acks = b.produce(&d)
+			if acks == 0 {
+				continue
+			}
+		default:
+			return
+		}
+		e := encoder{}
+		e.int32(int32(4 + len(body)))
+		e.int32(correlationID)
+		e.b = append(e.b, body...)
+		c.Write(e.b)
+	}
+}
+
+func (b *fakeKafkaBroker) metadata(d *decoder) []byte {
+	b.mu.Lock()
+	b.Metadata++
+	b.mu.Unlock()
+
+	var topics []string
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topics = append(topics, d.string())
+	}
+	host, port, _ := net.SplitHostPort(b.Addr())
+	p, _ := strconv.Atoi(port)
+
+	e := encoder{}
+	e.int32(1)
+	e.int32(1)
+	e.string(host)
+	e.int32(int32(p))
+	e.int16(-1) // rack
+	e.int32(1)  // controller
+	e.int32(int32(len(topics)))
+	for _, t := range topics {
+		e.int16(0)
+		e.string(t)
+		e.int8(0)
+		e.int32(b.partitions)
+		for i := int32(0); i < b.partitions; i++ {
+			e.int16(0)
+			e.int32(i)
+			e.int32(1) // leader
+			e.int32(1)
+			e.int32(1)
+			e.int32(1)
+			e.int32(1)
+		}
+	}
+	return e.b
+}
+
+func (b *fakeKafkaBroker) produce(d *decoder) ([]byte, int16) {
+	d.string() // transactional id
+	acks := d.int16()
+	d.int32() // timeout
+	d.arrayLen()
+	topic := d.string()
+	d.arrayLen()
+	partition := d.int32()
+	batch := decoder{b: d.bytes()}
+
+	batch.int64() // base offset
+	batch.int32() // length
+	batch.int32() // leader epoch
+	batch.int8()  // magic
+	crc := uint32(batch.int32())
+	rest := batch.b
+	crcOK := crc == crc32.Checksum(rest, crc32.MakeTable(crc32.Castagnoli))
+	batch.int16() // attributes
+	batch.int32() // last offset delta
+	batch.int64() // base timestamp
+	batch.int64() // max timestamp
+	batch.int64() // producer id
+	batch.int16() // producer epoch
+	batch.int32() // base sequence
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !crcOK {
+		b.crcFailed = true
+	}
+	code := kafkaErrNone
+	if len(b.errCodes) > 0 {
+		code = b.errCodes[0]
+		b.errCodes = b.errCodes[1:]
+	}
+	if code == kafkaErrNone {
+		for i, n := 0, batch.arrayLen(); i < n; i++ {
+			batch.varint() // length
+			batch.int8()   // attributes
+			batch.varint() // timestamp delta
+			batch.varint() // offset delta
+			key := batch.varbytes()
+			value := batch.varbytes()
+			batch.varint() // headers
+			b.Records = append(b.Records, producedRecord{Topic: topic, Partition: partition, Acks: acks, Key: key, Value: value})
+		}
+	}
+
+	e := encoder{}
+	e.int32(1)
+	e.string(topic)
+	e.int32(1)
+	e.int32(partition)
+	e.int16(code)
+	e.int64(0)
+	e.int64(-1)
+	e.int32(0) // throttle
+	return e.b, acks
+}
+
+func TestMurmur2(t *testing.T) {
+	data := []struct {
+		in       string
+		expected int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, v := range data {
+		t.Run(v.in, func(t *testing.T) {
+			assert.Equal(t, v.expected, murmur2([]byte(v.in)))
+		})
+	}
+}
+
+func TestKafkaProducer(t *testing.T) {
+	var b *fakeKafkaBroker
+	var p KafkaProducer
+
+	type message struct {
+		OrderID uint    `json:"orderID"`
+		Amount  float64 `json:"amount"`
+	}
+
+	setup := func(cfg KafkaConfig) {
+		b = newFakeKafkaBroker(t, 3)
+		cfg.Brokers = []string{b.Addr()}
+		p = NewKafkaProducer(cfg)
+		t.Cleanup(func() { p.Close() })
+	}
+
+	t.Run("publish should serialize message as json and partition by key", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksAll})
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "1", Message: message{OrderID: 1, Amount: 100}})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.False(t, b.crcFailed)
+		assert.Equal(t, 1, len(b.Records))
+		assert.Equal(t, "payment-transaction", b.Records[0].Topic)
+		assert.Equal(t, toPositive(murmur2([]byte("1")))%3, b.Records[0].Partition)
+		assert.Equal(t, int16(-1), b.Records[0].Acks)
+		assert.Equal(t, []byte("1"), b.Records[0].Key)
+		assert.JSONEq(t, `{"orderID":1,"amount":100}`, string(b.Records[0].Value))
+	})
+
+	t.Run("publish with same key should always use same partition and cache metadata", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksLeader})
+
+		//Action
+		for i := 0; i < 5; i++ {
+			assert.Nil(t, p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "42", Message: i}))
+		}
+
+		//Assert
+		assert.Equal(t, 5, len(b.Records))
+		for _, r := range b.Records {
+			assert.Equal(t, b.Records[0].Partition, r.Partition)
+		}
+		assert.Equal(t, 1, b.Metadata)
+	})
+
+	t.Run("publish without acks should not wait for response", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksNone})
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "1", Message: "fire"})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return len(b.Records) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("publish retriable error should retry and refresh metadata", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksAll, Retries: 2, RetryBackoff: time.Millisecond})
+		b.SetProduceErrors(kafkaErrNotLeaderForPartition)
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "1", Message: "retry"})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(b.Records))
+		assert.Equal(t, 2, b.Metadata)
+	})
+
+	t.Run("publish retriable error should fail when retries exhausted", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksAll, Retries: 1, RetryBackoff: time.Millisecond})
+		b.SetProduceErrors(kafkaErrRequestTimedOut, kafkaErrRequestTimedOut)
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "1", Message: "retry"})
+
+		//Assert
+		assert.EqualError(t, err, "kafka: topic payment-transaction partition "+strconv.Itoa(int(toPositive(murmur2([]byte("1")))%3))+": error code 7")
+		assert.Equal(t, 0, len(b.Records))
+	})
+
+	t.Run("publish non retriable error should fail immediately", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksAll, Retries: 3, RetryBackoff: time.Millisecond})
+		b.SetProduceErrors(10) // MESSAGE_TOO_LARGE
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Key: "1", Message: "big"})
+
+		//Assert
+		var k *KafkaError
+		assert.ErrorAs(t, err, &k)
+		assert.Equal(t, int16(10), k.Code)
+		assert.Equal(t, 1, b.Metadata)
+	})
+
+	t.Run("publish should stop retrying when context is cancelled", func(t *testing.T) {
+		//Arrange
+		setup(KafkaConfig{Acks: KafkaAcksAll, Retries: 3, RetryBackoff: time.Minute})
+		b.SetProduceErrors(kafkaErrNotLeaderForPartition)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		//Action
+		err := p.Publish(ctx, RequestPublish{Topic: "payment-transaction", Key: "1", Message: "cancel"})
+
+		//Assert
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, len(b.Records))
+	})
+
+	t.Run("publish should give up waiting for broker at context deadline", func(t *testing.T) {
+		//Arrange
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { l.Close() })
+		p = NewKafkaProducer(KafkaConfig{Brokers: []string{l.Addr().String()}, Acks: KafkaAcksAll})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+
+		//Action
+		err = p.Publish(ctx, RequestPublish{Topic: "payment-transaction", Message: "silent"})
+
+		//Assert
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("publish without brokers should return error", func(t *testing.T) {
+		//Arrange
+		p = NewKafkaProducer(KafkaConfig{})
+
+		//Action
+		err := p.Publish(context.Background(), RequestPublish{Topic: "payment-transaction", Message: "x"})
+
+		//Assert
+		assert.Equal(t, ErrKafkaNoBrokers, err)
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/migration"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: payment migrate up [flags]
+       payment migrate down [steps] [flags]
+       payment migrate status [flags]
+       payment migrate open-accounts [flags]
+
+up applies every pending migration, down reverts the last steps (default 1)
+and status lists them. open-accounts brings the balances from before the
+ledger into it, once, after up and before the server takes payments. The
+flags are those of the server, see payment -h.`
+
+// migrate runs the migrate subcommand with the arguments following it.
+func migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+	cmd, args := args[0], args[1:]
+	steps := 1
+	if cmd == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				log.Fatalf("migrate down: steps must be positive, got %d", n)
+			}
+			steps, args = n, args[1:]
+		}
+	}
+	if cmd != "up" && cmd != "down" && cmd != "status" && cmd != "open-accounts" {
+		log.Fatal(migrateUsage)
+	}
+
+	cfg := loadConfig(args)
+	db := openDatabase(cfg)
+	m, err := migration.NewMigrator(db, clock.NewClock())
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch cmd {
+	case "up":
+		ms, err := m.Up(ctx)
+		report("Applied", ms)
+		if err != nil {
+			log.Fatalf("Failed to migrate up: %v", err)
+		}
+	case "down":
+		ms, err := m.Down(ctx, steps)
+		report("Reverted", ms)
+		if err != nil {
+			log.Fatalf("Failed to migrate down: %v", err)
+		}
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	case "open-accounts":
+		if err := checkSchema(db); err != nil {
+			log.Fatalf("Failed to open ledger accounts: %v", err)
+		}
+		n, err := service.NewLedgerService(storage.NewLedgerStorage(db), clock.NewClock()).OpenAccounts(ctx)
+		if err != nil {
+			log.Fatalf("Failed to open ledger accounts: %v", err)
+		}
+		log.Printf("Opened %d ledger accounts", n)
+	}
+}
+
+func report(verb string, ms []migration.Migration) {
+	if len(ms) == 0 {
+		log.Printf("%s no migrations, the schema is up to date", verb)
+	}
+	for _, v := range ms {
+		log.Printf("%s %04d_%s", verb, v.Version, v.Name)
+	}
+}
+
+// checkSchema fails when migrations are pending, so the server never runs
+// against a schema older than its code.
+func checkSchema(db *gorm.DB) error {
+	m, err := migration.NewMigrator(db, clock.NewClock())
+	if err != nil {
+		return err
+	}
+	status, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migrations pending, run payment migrate up", pending)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// dialect is what running migrations needs that differs between databases:
+// creating the table of applied migrations and keeping other runners out.
+type dialect struct {
+	createTable string
+	// lock runs fn holding a lock no other runner can take at the same time.
+	lock func(conn *gorm.DB, fn func(conn *gorm.DB) error) error
+}
+
+// dialects are keyed by the name of the gorm dialector.
+var dialects = map[string]dialect{
+	"sqlserver": {
+		createTable: `IF OBJECT_ID('schema_migrations', 'U') IS NULL
+CREATE TABLE schema_migrations (version bigint PRIMARY KEY, name varchar(255) NOT NULL, applied_at datetimeoffset NOT NULL)`,
+		lock: sqlServerLock,
+	},
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name varchar(255) NOT NULL, applied_at timestamptz NOT NULL)`,
+		lock:        postgresLock,
+	},
+	"sqlite": {
+		createTable: sqliteCreateTable,
+		lock:        sqliteLock,
+	},
+}
+
+// lockName identifies the migration lock of this service in a database
+// shared with others.
+const lockName = "payment_schema_migrations"
+
+// sqlServerLock holds an application lock owned by the session, which SQL
+// Server releases when the connection closes should the release fail.
+func sqlServerLock(conn *gorm.DB, fn func(conn *gorm.DB) error) error {
+	var result int
+	r := conn.Raw(`DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = '` + lockName + `', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = -1;
+SELECT @result`).Scan(&result)
+	if r.Error != nil {
+		return fmt.Errorf("migration: lock: %w", r.Error)
+	}
+	if result < 0 {
+		return fmt.Errorf("migration: lock: sp_getapplock returned %d", result)
+	}
+	err := fn(conn)
+	unlock := conn.WithContext(context.WithoutCancel(conn.Statement.Context)).
+		Exec(`EXEC sp_releaseapplock @Resource = '` + lockName + `', @LockOwner = 'Session'`)
+	return errors.Join(err, unlock.Error)
+}
+
+// postgresLockKey is lockName as the number advisory locks are taken on.
+const postgresLockKey = 0x7061796d656e74
+
+// postgresLock holds a session advisory lock.
+func postgresLock(conn *gorm.DB, fn func(conn *gorm.DB) error) error {
+	if r := conn.Exec("SELECT pg_advisory_lock(?)", postgresLockKey); r.Error != nil {
+		return fmt.Errorf("migration: lock: %w", r.Error)
+	}
+	err := fn(conn)
+	unlock := conn.WithContext(context.WithoutCancel(conn.Statement.Context)).
+		Exec("SELECT pg_advisory_unlock(?)", postgresLockKey)
+	return errors.Join(err, unlock.Error)
+}
+
+const sqliteCreateTable = `CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name varchar(255) NOT NULL, applied_at datetime NOT NULL)`
+
+// sqliteLock runs fn in one transaction holding the write lock of the
+// database, the only lock SQLite has. A write that changes nothing takes it
+// up front; each migration then runs in a savepoint.
+func sqliteLock(conn *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if r := tx.Exec(sqliteCreateTable); r.Error != nil {
+			return fmt.Errorf("migration: lock: %w", r.Error)
+		}
+		if r := tx.Exec("DELETE FROM schema_migrations WHERE version IS NULL"); r.Error != nil {
+			return fmt.Errorf("migration: lock: %w", r.Error)
+		}
+		return fn(tx)
+	})
+}
@@ -0,0 +1,255 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"gorm.io/gorm"
+)
+
+// The schema of each database is kept in its own directory as numbered pairs
+// of files, 0001_name.up.sql and 0001_name.down.sql. Statements end with a
+// semicolon at the end of a line.
+//
+//go:embed sqlserver postgres sqlite
+var files embed.FS
+
+type Migration struct {
+	Version uint
+	Name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Migration
+	// AppliedAt is nil for a migration still to run.
+	AppliedAt *time.Time
+}
+
+type Migrator interface {
+	// Up runs the migrations not applied yet in order and returns them.
+	Up(ctx context.Context) ([]Migration, error)
+	// Down reverts the last steps applied migrations and returns them.
+	Down(ctx context.Context, steps int) ([]Migration, error)
+	Status(ctx context.Context) ([]Status, error)
+}
+
+type migrator struct {
+	db         *gorm.DB
+	clock      clock.Clock
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator returns the Migrator of the database db is connected to.
+func NewMigrator(db *gorm.DB, clock clock.Clock) (Migrator, error) {
+	name := db.Dialector.Name()
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("migration: unsupported database %q", name)
+	}
+	ms, err := load(name)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, clock: clock, dialect: d, migrations: ms}, nil
+}
+
+// schemaMigration is a row of the table recording the applied migrations.
+type schemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+func (m *migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			if _, ok := applied[v.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := exec(tx, v.up); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: v.Version, Name: v.Name, AppliedAt: m.clock.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration: up %04d_%s: %w", v.Version, v.Name, err)
+			}
+			done = append(done, v)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			v := m.migrations[i]
+			if _, ok := applied[v.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := exec(tx, v.down); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{Version: v.Version}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration: down %04d_%s: %w", v.Version, v.Name, err)
+			}
+			done = append(done, v)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+	var s []Status
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, v := range m.migrations {
+			st := Status{Migration: v}
+			if r, ok := applied[v.Version]; ok {
+				st.AppliedAt = &r.AppliedAt
+			}
+			s = append(s, st)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// locked runs fn on one connection holding the migration lock, so runners
+// started together apply each migration once.
+func (m *migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		return m.dialect.lock(conn, func(conn *gorm.DB) error {
+			if err := conn.Exec(m.dialect.createTable).Error; err != nil {
+				return fmt.Errorf("migration: create schema_migrations: %w", err)
+			}
+			return fn(conn)
+		})
+	})
+}
+
+func (m *migrator) applied(conn *gorm.DB) (map[uint]schemaMigration, error) {
+	var rows []schemaMigration
+	if r := conn.Order("version").Find(&rows); r.Error != nil {
+		return nil, fmt.Errorf("migration: read schema_migrations: %w", r.Error)
+	}
+	applied := map[uint]schemaMigration{}
+	for _, v := range rows {
+		applied[v.Version] = v
+	}
+	return applied, nil
+}
+
+func exec(tx *gorm.DB, sql string) error {
+	for _, s := range statements(sql) {
+		if err := tx.Exec(s).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statements splits sql at the semicolons ending a line, leaving out
+// comment lines.
+func statements(sql string) []string {
+	var s []string
+	var b strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		if strings.HasSuffix(t, ";") {
+			s = append(s, strings.TrimSuffix(strings.TrimSpace(b.String()), ";"))
+			b.Reset()
+		}
+	}
+	if t := strings.TrimSpace(b.String()); t != "" {
+		s = append(s, t)
+	}
+	return s
+}
+
+// load reads the migrations of dir in version order, checking every version
+// has one up and one down file.
+func load(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migration: %w", err)
+	}
+	byVersion := map[uint]*Migration{}
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		num, name, found := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(num, 10, 32)
+		if !ok || !found || err != nil || !strings.HasSuffix(e.Name(), ".sql") {
+			return nil, fmt.Errorf("migration: %s/%s is not named like 0001_name.up.sql", dir, e.Name())
+		}
+		b, err := fs.ReadFile(files, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migration: %w", err)
+		}
+		v, ok := byVersion[uint(version)]
+		if !ok {
+			v = &Migration{Version: uint(version), Name: name}
+			byVersion[v.Version] = v
+		}
+		if v.Name != name {
+			return nil, fmt.Errorf("migration: %s version %04d is named both %s and %s", dir, version, v.Name, name)
+		}
+		switch direction {
+		case "up":
+			v.up = string(b)
+		case "down":
+			v.down = string(b)
+		default:
+			return nil, fmt.Errorf("migration: %s/%s is neither up nor down", dir, e.Name())
+		}
+	}
+
+	var ms []Migration
+	for _, v := range byVersion {
+		if v.up == "" || v.down == "" {
+			return nil, fmt.Errorf("migration: %s/%04d_%s needs both an up and a down file", dir, v.Version, v.Name)
+		}
+		ms = append(ms, *v)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
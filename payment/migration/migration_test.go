@@ -0,0 +1,200 @@
+//go:build integration_test
+// +build integration_test
+
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type mockClock struct {
+	t time.Time
+}
+
+func (m *mockClock) Now() time.Time {
+	return m.t
+}
+
+func TestMigrator(t *testing.T) {
+	var ctx context.Context
+	var db *gorm.DB
+	var m Migrator
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	setup := func() {
+		ctx = context.Background()
+		var err error
+		db, err = storage.Open(storage.DriverSQLite, filepath.Join(t.TempDir(), "migration.db"))
+		if err != nil {
+			t.Fatalf("Failed to open SQLite: %v", err)
+		}
+		m, err = NewMigrator(db, &mockClock{t: now})
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+	}
+
+	versions := func(ms []Migration) []uint {
+		var v []uint
+		for _, m := range ms {
+			v = append(v, m.Version)
+		}
+		return v
+	}
+
+	t.Run("up should apply every migration in order once", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		first, err := m.Up(ctx)
+		second, err2 := m.Up(ctx)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Nil(t, err2)
+		assert.Equal(t, []uint{1, 2, 3, 4, 5, 6, 7, 8, 9}, versions(first))
+		assert.Empty(t, second)
+		status, err := m.Status(ctx)
+		assert.Nil(t, err)
+		for _, s := range status {
+			assert.Equal(t, now, s.AppliedAt.UTC(), s.Name)
+		}
+	})
+
+	t.Run("up should create a table with every column of each storage model", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := m.Up(ctx)
+
+		//Assert
+		assert.Nil(t, err)
+		models := []any{&storage.CustomerProfile{}, &storage.MerchantProfile{}, &storage.Order{}, &storage.OrderStatusHistory{}, &storage.PaymentTranasction{}, &storage.Hold{}, &storage.Outbox{}, &storage.IdempotencyKey{}, &storage.Settlement{}, &storage.LedgerAccount{}, &storage.JournalEntry{}, &storage.Posting{}, &storage.Reconciliation{}}
+		for _, v := range models {
+			stmt := &gorm.Statement{DB: db}
+			assert.Nil(t, stmt.Parse(v))
+			assert.True(t, db.Migrator().HasTable(v), stmt.Table)
+			for _, f := range stmt.Schema.Fields {
+				if f.DBName != "" {
+					assert.True(t, db.Migrator().HasColumn(v, f.DBName), stmt.Table+"."+f.DBName)
+				}
+			}
+		}
+	})
+
+	t.Run("down should revert the last migrations and up should apply them again", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.Up(ctx)
+
+		//Action
+		down, err := m.Down(ctx, 2)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []uint{9, 8}, versions(down))
+		assert.False(t, db.Migrator().HasColumn(&storage.PaymentTranasction{}, "confirmed_at"))
+		assert.False(t, db.Migrator().HasTable("reconciliations"))
+		assert.True(t, db.Migrator().HasTable("postings"))
+		status, _ := m.Status(ctx)
+		assert.Nil(t, status[7].AppliedAt)
+		assert.NotNil(t, status[6].AppliedAt)
+		up, err := m.Up(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []uint{8, 9}, versions(up))
+	})
+
+	t.Run("up should take confirmed transactions as confirmed when last updated", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.Up(ctx)
+		m.Down(ctx, 1)
+		o := &storage.Order{
+			Customer: storage.CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: storage.MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+			Status:   constant.OrderStatusConfirm,
+		}
+		db.Create(o)
+		insert := "INSERT INTO payment_tranasctions (created_at, updated_at, order_id, channel, amount, status) VALUES (?, ?, ?, 'debit', 100, ?)"
+		db.Exec(insert, now, now, o.ID, constant.PaymentTranasctionStatusConfirm)
+		db.Exec(insert, now, now, o.ID, constant.PaymentTranasctionStatusReject)
+
+		//Action
+		_, err := m.Up(ctx)
+
+		//Assert
+		assert.Nil(t, err)
+		var rows []storage.PaymentTranasction
+		db.Order("id").Find(&rows)
+		assert.Equal(t, 2, len(rows))
+		assert.True(t, now.Equal(*rows[0].ConfirmedAt))
+		assert.Nil(t, rows[1].ConfirmedAt)
+	})
+
+	t.Run("down past the first migration should drop every table", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.Up(ctx)
+
+		//Action
+		down, err := m.Down(ctx, 100)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 9, len(down))
+		tables, _ := db.Migrator().GetTables()
+		assert.ElementsMatch(t, []string{"schema_migrations", "sqlite_sequence"}, tables)
+	})
+
+	t.Run("concurrent up should apply each migration once", func(t *testing.T) {
+		//Arrange
+		setup()
+		applied := make([][]Migration, 3)
+		errs := make([]error, 3)
+		var wg sync.WaitGroup
+
+		//Action
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				applied[i], errs[i] = m.Up(ctx)
+			}(i)
+		}
+		wg.Wait()
+
+		//Assert
+		total := 0
+		for i := range errs {
+			assert.Nil(t, errs[i])
+			total += len(applied[i])
+		}
+		assert.Equal(t, 9, total)
+	})
+}
+
+func TestStatements(t *testing.T) {
+	t.Run("statements should split at semicolons ending a line", func(t *testing.T) {
+		//Arrange
+		sql := "-- a comment\nCREATE TABLE a (\n    id int,\n    name varchar(10) DEFAULT ';'\n);\n\nCREATE INDEX idx_a ON a (id);\n"
+
+		//Action
+		actual := statements(sql)
+
+		//Assert
+		assert.Equal(t, []string{"CREATE TABLE a (\n    id int,\n    name varchar(10) DEFAULT ';'\n)", "CREATE INDEX idx_a ON a (id)"}, actual)
+	})
+}
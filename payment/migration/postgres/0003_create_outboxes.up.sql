@@ -0,0 +1,17 @@
+CREATE TABLE outboxes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    topic varchar(100) NOT NULL,
+    "key" varchar(100),
+    payload text NOT NULL,
+    status varchar(10) NOT NULL,
+    attempts bigint NOT NULL,
+    last_error varchar(255),
+    next_attempt_at timestamptz NOT NULL,
+    sent_at timestamptz
+);
+CREATE INDEX idx_outboxes_status ON outboxes (status);
+CREATE INDEX idx_outboxes_next_attempt_at ON outboxes (next_attempt_at);
+CREATE INDEX idx_outboxes_deleted_at ON outboxes (deleted_at);
@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+    "key" varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    completed boolean NOT NULL,
+    status_code bigint,
+    content_type varchar(100),
+    response text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY ("key")
+);
@@ -0,0 +1,19 @@
+CREATE TABLE settlements (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    merchant_id bigint NOT NULL,
+    window_start timestamptz NOT NULL,
+    window_end timestamptz NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    payment_count bigint NOT NULL,
+    refund_count bigint NOT NULL,
+    gross_amount decimal(19,4) NOT NULL,
+    fee_amount decimal(19,4) NOT NULL DEFAULT 0,
+    refund_amount decimal(19,4) NOT NULL,
+    net_amount decimal(19,4) NOT NULL,
+    CONSTRAINT fk_settlements_merchant FOREIGN KEY (merchant_id) REFERENCES merchant_profiles (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX idx_settlement_merchant_window ON settlements (merchant_id, window_end);
+CREATE INDEX idx_settlements_deleted_at ON settlements (deleted_at);
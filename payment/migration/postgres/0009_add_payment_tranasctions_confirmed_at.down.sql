@@ -0,0 +1,2 @@
+DROP INDEX idx_payment_tranasctions_confirmed_at;
+ALTER TABLE payment_tranasctions DROP COLUMN confirmed_at;
@@ -0,0 +1,4 @@
+DROP TABLE order_status_histories;
+DROP TABLE orders;
+DROP TABLE merchant_profiles;
+DROP TABLE customer_profiles;
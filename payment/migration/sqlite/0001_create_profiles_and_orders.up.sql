@@ -0,0 +1,53 @@
+CREATE TABLE customer_profiles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name varchar(100) NOT NULL,
+    status varchar(10) NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    held_amount decimal(19,4) NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_customer_profiles_deleted_at ON customer_profiles (deleted_at);
+
+CREATE TABLE merchant_profiles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name varchar(100) NOT NULL,
+    status varchar(10) NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    prompt_pay_id varchar(20)
+);
+CREATE INDEX idx_merchant_profiles_deleted_at ON merchant_profiles (deleted_at);
+
+CREATE TABLE orders (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    customer_id integer NOT NULL,
+    merchant_id integer NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    status varchar(20) NOT NULL,
+    CONSTRAINT fk_orders_customer FOREIGN KEY (customer_id) REFERENCES customer_profiles (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT fk_orders_merchant FOREIGN KEY (merchant_id) REFERENCES merchant_profiles (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at);
+
+CREATE TABLE order_status_histories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    order_id integer NOT NULL,
+    "from" varchar(20),
+    "to" varchar(20) NOT NULL,
+    reason varchar(255)
+);
+CREATE INDEX idx_order_status_histories_order_id ON order_status_histories (order_id);
+CREATE INDEX idx_order_status_histories_deleted_at ON order_status_histories (deleted_at);
@@ -0,0 +1,26 @@
+CREATE TABLE payment_tranasctions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    order_id integer NOT NULL,
+    type varchar(10) NOT NULL DEFAULT 'payment',
+    parent_id integer,
+    channel varchar(10) NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    status varchar(30) NOT NULL,
+    reason varchar(255),
+    provider_ref varchar(64),
+    settled_amount decimal(19,4) NOT NULL DEFAULT 0,
+    settled_currency varchar(3) NOT NULL DEFAULT 'THB',
+    rate decimal(19,8) NOT NULL DEFAULT 1,
+    fee_amount decimal(19,4) NOT NULL DEFAULT 0,
+    net_amount decimal(19,4) NOT NULL DEFAULT 0,
+    settlement_id integer,
+    CONSTRAINT fk_payment_tranasctions_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX idx_payment_tranasctions_parent_id ON payment_tranasctions (parent_id);
+CREATE INDEX idx_payment_tranasctions_provider_ref ON payment_tranasctions (provider_ref);
+CREATE INDEX idx_payment_tranasctions_settlement_id ON payment_tranasctions (settlement_id);
+CREATE INDEX idx_payment_tranasctions_deleted_at ON payment_tranasctions (deleted_at);
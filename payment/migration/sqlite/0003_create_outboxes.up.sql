@@ -0,0 +1,17 @@
+CREATE TABLE outboxes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    topic varchar(100) NOT NULL,
+    "key" varchar(100),
+    payload text NOT NULL,
+    status varchar(10) NOT NULL,
+    attempts integer NOT NULL,
+    last_error varchar(255),
+    next_attempt_at datetime NOT NULL,
+    sent_at datetime
+);
+CREATE INDEX idx_outboxes_status ON outboxes (status);
+CREATE INDEX idx_outboxes_next_attempt_at ON outboxes (next_attempt_at);
+CREATE INDEX idx_outboxes_deleted_at ON outboxes (deleted_at);
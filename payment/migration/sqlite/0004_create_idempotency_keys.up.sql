@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+    "key" varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    completed numeric NOT NULL,
+    status_code integer,
+    content_type varchar(100),
+    response text,
+    created_at datetime,
+    updated_at datetime,
+    PRIMARY KEY ("key")
+);
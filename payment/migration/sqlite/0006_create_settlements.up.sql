@@ -0,0 +1,19 @@
+CREATE TABLE settlements (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    merchant_id integer NOT NULL,
+    window_start datetime NOT NULL,
+    window_end datetime NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    payment_count integer NOT NULL,
+    refund_count integer NOT NULL,
+    gross_amount decimal(19,4) NOT NULL,
+    fee_amount decimal(19,4) NOT NULL DEFAULT 0,
+    refund_amount decimal(19,4) NOT NULL,
+    net_amount decimal(19,4) NOT NULL,
+    CONSTRAINT fk_settlements_merchant FOREIGN KEY (merchant_id) REFERENCES merchant_profiles (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX idx_settlement_merchant_window ON settlements (merchant_id, window_end);
+CREATE INDEX idx_settlements_deleted_at ON settlements (deleted_at);
@@ -0,0 +1,38 @@
+CREATE TABLE ledger_accounts (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    type varchar(10) NOT NULL,
+    owner_id integer NOT NULL,
+    currency varchar(3) NOT NULL
+);
+CREATE UNIQUE INDEX idx_ledger_account ON ledger_accounts (type, owner_id, currency);
+CREATE INDEX idx_ledger_accounts_deleted_at ON ledger_accounts (deleted_at);
+
+CREATE TABLE journal_entries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    kind varchar(20) NOT NULL,
+    reference varchar(64) NOT NULL
+);
+CREATE INDEX idx_journal_entries_reference ON journal_entries (reference);
+CREATE INDEX idx_journal_entries_deleted_at ON journal_entries (deleted_at);
+
+CREATE TABLE postings (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    journal_entry_id integer NOT NULL,
+    account_id integer NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL,
+    CONSTRAINT fk_journal_entries_postings FOREIGN KEY (journal_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_postings_account FOREIGN KEY (account_id) REFERENCES ledger_accounts (id)
+);
+CREATE INDEX idx_postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX idx_postings_account_id ON postings (account_id);
+CREATE INDEX idx_postings_deleted_at ON postings (deleted_at);
@@ -0,0 +1,17 @@
+CREATE TABLE outboxes (
+    id bigint IDENTITY(1,1) PRIMARY KEY,
+    created_at datetimeoffset,
+    updated_at datetimeoffset,
+    deleted_at datetimeoffset,
+    topic varchar(100) NOT NULL,
+    "key" varchar(100),
+    payload nvarchar(max) NOT NULL,
+    status varchar(10) NOT NULL,
+    attempts bigint NOT NULL,
+    last_error varchar(255),
+    next_attempt_at datetimeoffset NOT NULL,
+    sent_at datetimeoffset
+);
+CREATE INDEX idx_outboxes_status ON outboxes (status);
+CREATE INDEX idx_outboxes_next_attempt_at ON outboxes (next_attempt_at);
+CREATE INDEX idx_outboxes_deleted_at ON outboxes (deleted_at);
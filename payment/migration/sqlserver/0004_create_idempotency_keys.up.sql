@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+    "key" varchar(255) NOT NULL,
+    fingerprint varchar(64) NOT NULL,
+    completed bit NOT NULL,
+    status_code bigint,
+    content_type varchar(100),
+    response nvarchar(max),
+    created_at datetimeoffset,
+    updated_at datetimeoffset,
+    PRIMARY KEY ("key")
+);
@@ -0,0 +1,19 @@
+CREATE TABLE holds (
+    id bigint IDENTITY(1,1) PRIMARY KEY,
+    created_at datetimeoffset,
+    updated_at datetimeoffset,
+    deleted_at datetimeoffset,
+    payment_tranasction_id bigint NOT NULL,
+    customer_id bigint NOT NULL,
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    status varchar(10) NOT NULL,
+    expires_at datetimeoffset NOT NULL,
+    CONSTRAINT fk_holds_payment_tranasction FOREIGN KEY (payment_tranasction_id) REFERENCES payment_tranasctions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT fk_holds_customer FOREIGN KEY (customer_id) REFERENCES customer_profiles (id)
+);
+CREATE UNIQUE INDEX idx_holds_payment_tranasction_id ON holds (payment_tranasction_id);
+CREATE INDEX idx_holds_customer_id ON holds (customer_id);
+CREATE INDEX idx_holds_status ON holds (status);
+CREATE INDEX idx_holds_expires_at ON holds (expires_at);
+CREATE INDEX idx_holds_deleted_at ON holds (deleted_at);
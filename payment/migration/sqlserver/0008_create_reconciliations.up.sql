@@ -0,0 +1,18 @@
+CREATE TABLE reconciliations (
+    id bigint IDENTITY(1,1) PRIMARY KEY,
+    created_at datetimeoffset,
+    updated_at datetimeoffset,
+    deleted_at datetimeoffset,
+    payment_tranasction_id bigint NOT NULL,
+    kind varchar(30) NOT NULL,
+    channel varchar(10) NOT NULL,
+    provider_ref varchar(64),
+    amount decimal(19,4) NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'THB',
+    reason varchar(255),
+    status varchar(10) NOT NULL,
+    CONSTRAINT fk_reconciliations_payment_tranasction FOREIGN KEY (payment_tranasction_id) REFERENCES payment_tranasctions (id)
+);
+CREATE INDEX idx_reconciliations_payment_tranasction_id ON reconciliations (payment_tranasction_id);
+CREATE INDEX idx_reconciliations_status ON reconciliations (status);
+CREATE INDEX idx_reconciliations_deleted_at ON reconciliations (deleted_at);
@@ -0,0 +1,5 @@
+-- Transactions confirmed before the column existed are taken as confirmed
+-- when they were last updated.
+ALTER TABLE payment_tranasctions ADD confirmed_at datetimeoffset;
+UPDATE payment_tranasctions SET confirmed_at = updated_at WHERE status = 'comfirm';
+CREATE INDEX idx_payment_tranasctions_confirmed_at ON payment_tranasctions (confirmed_at);
@@ -0,0 +1,83 @@
+package money
+
+import "fmt"
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+const (
+	THB Currency = "THB"
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	JPY Currency = "JPY"
+	SGD Currency = "SGD"
+)
+
+// DefaultCurrency is used for wallets and orders created without a currency.
+const DefaultCurrency = THB
+
+var currencyPrecision = map[Currency]int{
+	THB: 2,
+	USD: 2,
+	EUR: 2,
+	JPY: 0,
+	SGD: 2,
+}
+
+func IsValidCurrency(c Currency) bool {
+	_, ok := currencyPrecision[c]
+	return ok
+}
+
+// Precision is the number of minor unit decimals the currency allows.
+func (c Currency) Precision() int {
+	if p, ok := currencyPrecision[c]; ok {
+		return p
+	}
+	return 2
+}
+
+// Money is an amount in a given currency. Arithmetic between different
+// currencies fails with ErrCurrencyMismatch instead of silently mixing them.
+type Money struct {
+	Amount   Amount   `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%s %s", m.Amount.StringFixed(m.Currency.Precision()), m.Currency)
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	a, err := m.Amount.Add(o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: a, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	a, err := m.Amount.Sub(o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: a, Currency: m.Currency}, nil
+}
+
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	return m.Amount.Cmp(o.Amount), nil
+}
+
+// IsValid reports whether the currency is known and the amount fits its precision.
+func (m Money) IsValid() bool {
+	return IsValidCurrency(m.Currency) && m.Amount.HasPrecision(m.Currency.Precision())
+}
@@ -0,0 +1,333 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount keeps. It is larger than
+// any currency precision so conversions and fees can round once at the end.
+const Scale = 4
+
+var (
+	ErrInvalidAmount    = errors.New("money: invalid amount")
+	ErrAmountOverflow   = errors.New("money: amount out of range")
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+)
+
+// Amount is a fixed-point decimal stored as an integer number of 1/10000
+// units. It is a struct so untyped constants cannot silently become units;
+// build amounts with New, FromInt or Parse. The zero value is 0.
+type Amount struct {
+	v int64
+}
+
+// New returns units scaled by 10^-places, e.g. New(4025, 2) is 40.25, or
+// ErrAmountOverflow when the scaled units do not fit an Amount.
+func New(units int64, places int) (Amount, error) {
+	for ; places < Scale; places++ {
+		if units > math.MaxInt64/10 || units < math.MinInt64/10 {
+			return Amount{}, ErrAmountOverflow
+		}
+		units *= 10
+	}
+	for ; places > Scale; places-- {
+		units /= 10
+	}
+	return Amount{v: units}, nil
+}
+
+func FromInt(n int64) (Amount, error) {
+	return New(n, 0)
+}
+
+// MustFromInt is FromInt for amounts known to fit, such as constants.
+func MustFromInt(n int64) Amount {
+	a, err := FromInt(n)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Parse reads a plain decimal such as "1200", "-0.5" or "40.25".
+func Parse(s string) (Amount, error) {
+	v, err := parseScaled(s, Scale)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{v: v}, nil
+}
+
+// parseScaled reads a plain decimal as an integer of 10^-scale units.
+func parseScaled(s string, scale int) (int64, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	if neg || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalidAmount
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > scale {
+		return 0, fmt.Errorf("%w: more than %d decimal places", ErrInvalidAmount, scale)
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	v, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount without trailing zeros, e.g. "1200" or "40.25".
+func (a Amount) String() string {
+	return formatScaled(a.v, Scale)
+}
+
+func formatScaled(v int64, scale int) string {
+	sign := ""
+	u := uint64(v)
+	if v < 0 {
+		sign = "-"
+		u = uint64(-v)
+	}
+	pow := uint64(1)
+	for i := 0; i < scale; i++ {
+		pow *= 10
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%0*d", scale, u%pow), "0")
+	if frac == "" {
+		return fmt.Sprintf("%s%d", sign, u/pow)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, u/pow, frac)
+}
+
+// StringFixed formats the amount with exactly places decimals, rounding half
+// away from zero. Places past Scale are padded with zeros. It rounds the
+// unsigned magnitude, so unlike Round it cannot overflow.
+func (a Amount) StringFixed(places int) string {
+	places = max(places, 0)
+	u := uint64(a.v)
+	if a.v < 0 {
+		u = uint64(-a.v)
+	}
+	if places < Scale {
+		step := uint64(1)
+		for i := places; i < Scale; i++ {
+			step *= 10
+		}
+		r := u % step
+		u -= r
+		if 2*r >= step {
+			u += step
+		}
+	}
+	s := fmt.Sprintf("%0*d", Scale+1, u)
+	whole, frac := s[:len(s)-Scale], s[len(s)-Scale:]
+	sign := ""
+	if a.v < 0 && u != 0 {
+		sign = "-"
+	}
+	if places == 0 {
+		return sign + whole
+	}
+	frac += strings.Repeat("0", max(places-Scale, 0))
+	return sign + whole + "." + frac[:places]
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Add returns a+b, or ErrAmountOverflow when it does not fit an Amount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	v := a.v + b.v
+	if b.v > 0 && v < a.v || b.v < 0 && v > a.v {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{v: v}, nil
+}
+
+// Sub returns a-b, or ErrAmountOverflow when it does not fit an Amount.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	v := a.v - b.v
+	if b.v > 0 && v > a.v || b.v < 0 && v < a.v {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{v: v}, nil
+}
+
+func (a Amount) Neg() Amount { return Amount{v: -a.v} }
+
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a.v < b.v:
+		return -1
+	case a.v > b.v:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (a Amount) IsZero() bool { return a.v == 0 }
+
+func (a Amount) IsNegative() bool { return a.v < 0 }
+
+func (a Amount) IsPositive() bool { return a.v > 0 }
+
+// HasPrecision reports whether the amount fits in places decimals.
+func (a Amount) HasPrecision(places int) bool {
+	r, err := a.Round(places)
+	return err == nil && r == a
+}
+
+// Round rounds half away from zero to places decimals. It returns
+// ErrAmountOverflow when rounding away from zero does not fit an Amount.
+func (a Amount) Round(places int) (Amount, error) {
+	if places >= Scale {
+		return a, nil
+	}
+	step := int64(1)
+	for i := places; i < Scale; i++ {
+		step *= 10
+	}
+	v := a.v
+	r := v % step
+	v -= r
+	if 2*abs(r) >= step {
+		if r > 0 {
+			if v > math.MaxInt64-step {
+				return Amount{}, ErrAmountOverflow
+			}
+			v += step
+		} else {
+			if v < math.MinInt64+step {
+				return Amount{}, ErrAmountOverflow
+			}
+			v -= step
+		}
+	}
+	return Amount{v: v}, nil
+}
+
+// MulRat multiplies by num/den and rounds half away from zero to the Amount
+// scale. It returns ErrAmountOverflow when the product does not fit.
+func (a Amount) MulRat(num, den *big.Int) (Amount, error) {
+	v := quoRound(new(big.Int).Mul(big.NewInt(a.v), num), den)
+	if !v.IsInt64() {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{v: v.Int64()}, nil
+}
+
+// quoRound divides n by d rounding half away from zero.
+func quoRound(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	r.Abs(r).Mul(r, big.NewInt(2))
+	if r.Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if strings.ContainsAny(s, "eE") {
+		return ErrInvalidAmount
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return formatFixed(a.v, Scale), nil
+}
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Amount{}
+		return nil
+	case int64:
+		p, err := FromInt(v)
+		if err != nil {
+			return err
+		}
+		*a = p
+		return nil
+	case float64:
+		p, err := Parse(strconv.FormatFloat(v, 'f', Scale, 64))
+		if err != nil {
+			return err
+		}
+		*a = p
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T into Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	p, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = p
+	return nil
+}
@@ -0,0 +1,347 @@
+//go:build unit_test
+// +build unit_test
+
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	data := []struct {
+		in       string
+		expected string
+		err      bool
+	}{
+		{"1200", "1200", false},
+		{"40.25", "40.25", false},
+		{"40.2500", "40.25", false},
+		{"-0.5", "-0.5", false},
+		{".75", "0.75", false},
+		{"0.0001", "0.0001", false},
+		{"0.00001", "", true},
+		{"1e3", "", true},
+		{"abc", "", true},
+		{"", "", true},
+		{"99999999999999999999", "", true},
+	}
+	for _, v := range data {
+		t.Run(v.in, func(t *testing.T) {
+			a, err := Parse(v.in)
+
+			if v.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, a.String())
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Run("new should scale units to the amount scale", func(t *testing.T) {
+		data := []struct {
+			units    int64
+			places   int
+			expected Amount
+		}{
+			{4025, 2, MustParse("40.25")},
+			{7, 0, MustParse("7")},
+			{123456, 6, MustParse("0.1234")},
+		}
+		for _, v := range data {
+			actual, err := New(v.units, v.places)
+
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, actual)
+		}
+	})
+
+	t.Run("new should fail when scaled units do not fit an amount", func(t *testing.T) {
+		_, err1 := FromInt(math.MaxInt64 / 10000)
+		_, err2 := FromInt(math.MaxInt64/10000 + 1)
+		_, err3 := New(math.MinInt64/100, 2)
+		_, err4 := New(math.MinInt64/100-1, 2)
+
+		assert.Nil(t, err1)
+		assert.Equal(t, ErrAmountOverflow, err2)
+		assert.Nil(t, err3)
+		assert.Equal(t, ErrAmountOverflow, err4)
+	})
+}
+
+func TestAmount(t *testing.T) {
+	t.Run("add and sub should be exact where float64 is not", func(t *testing.T) {
+		//Arrange
+		a := MustParse("0.1")
+
+		//Action
+		actual, err1 := a.Add(MustParse("0.2"))
+		back, err2 := actual.Sub(MustParse("0.2"))
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, MustParse("0.3"), actual)
+		assert.Equal(t, MustParse("0.1"), back)
+	})
+
+	t.Run("add and sub should fail past the range of an amount", func(t *testing.T) {
+		data := []struct {
+			name     string
+			op       func() (Amount, error)
+			expected Amount
+			err      error
+		}{
+			{"add up to max", func() (Amount, error) { return Amount{v: math.MaxInt64 - 1}.Add(Amount{v: 1}) }, Amount{v: math.MaxInt64}, nil},
+			{"add over max", func() (Amount, error) { return Amount{v: math.MaxInt64 - 1}.Add(Amount{v: 2}) }, Amount{}, ErrAmountOverflow},
+			{"add under min", func() (Amount, error) { return Amount{v: math.MinInt64}.Add(Amount{v: -1}) }, Amount{}, ErrAmountOverflow},
+			{"sub down to min", func() (Amount, error) { return Amount{v: math.MinInt64 + 1}.Sub(Amount{v: 1}) }, Amount{v: math.MinInt64}, nil},
+			{"sub under min", func() (Amount, error) { return Amount{v: math.MinInt64 + 1}.Sub(Amount{v: 2}) }, Amount{}, ErrAmountOverflow},
+			{"sub negative over max", func() (Amount, error) { return Amount{v: math.MaxInt64}.Sub(Amount{v: -1}) }, Amount{}, ErrAmountOverflow},
+			{"sub min from zero", func() (Amount, error) { return Amount{}.Sub(Amount{v: math.MinInt64}) }, Amount{}, ErrAmountOverflow},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Action
+				actual, err := v.op()
+
+				//Assert
+				assert.Equal(t, v.err, err)
+				assert.Equal(t, v.expected, actual)
+			})
+		}
+	})
+
+	t.Run("round should round half away from zero", func(t *testing.T) {
+		data := []struct {
+			in       string
+			places   int
+			expected string
+		}{
+			{"1.005", 2, "1.01"},
+			{"-1.005", 2, "-1.01"},
+			{"1.0049", 2, "1"},
+			{"1.0049", 6, "1.0049"},
+		}
+		for _, v := range data {
+			actual, err := MustParse(v.in).Round(v.places)
+
+			assert.Nil(t, err)
+			assert.Equal(t, MustParse(v.expected), actual)
+		}
+	})
+
+	t.Run("round should fail when rounding away from zero does not fit an amount", func(t *testing.T) {
+		down, err1 := Amount{v: math.MaxInt64}.Round(2)
+		_, err2 := Amount{v: math.MaxInt64}.Round(3)
+		_, err3 := Amount{v: math.MinInt64}.Round(3)
+
+		assert.Nil(t, err1)
+		assert.Equal(t, Amount{v: math.MaxInt64 - 7}, down)
+		assert.Equal(t, ErrAmountOverflow, err2)
+		assert.Equal(t, ErrAmountOverflow, err3)
+		assert.False(t, Amount{v: math.MaxInt64}.HasPrecision(3))
+	})
+
+	t.Run("has precision should report extra decimals", func(t *testing.T) {
+		assert.True(t, MustParse("100.01").HasPrecision(2))
+		assert.False(t, MustParse("100.001").HasPrecision(2))
+		assert.False(t, MustParse("100.5").HasPrecision(0))
+	})
+
+	t.Run("mul rat should round once at the end", func(t *testing.T) {
+		//Action
+		actual, err := MustParse("100").MulRat(big.NewInt(1), big.NewInt(3))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, MustParse("33.3333"), actual)
+	})
+
+	t.Run("mul rat should fail past the range of an amount", func(t *testing.T) {
+		//Action
+		same, err1 := Amount{v: math.MaxInt64}.MulRat(big.NewInt(1), big.NewInt(1))
+		_, err2 := Amount{v: math.MaxInt64}.MulRat(big.NewInt(2), big.NewInt(1))
+		_, err3 := Amount{v: math.MinInt64}.MulRat(big.NewInt(-1), big.NewInt(1))
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Equal(t, Amount{v: math.MaxInt64}, same)
+		assert.Equal(t, ErrAmountOverflow, err2)
+		assert.Equal(t, ErrAmountOverflow, err3)
+	})
+
+	t.Run("string fixed should pad to places", func(t *testing.T) {
+		assert.Equal(t, "1200.00", MustFromInt(1200).StringFixed(2))
+		assert.Equal(t, "-0.50", MustParse("-0.5").StringFixed(2))
+		assert.Equal(t, "3", MustParse("2.5").StringFixed(0))
+		assert.Equal(t, "0.00", MustParse("-0.001").StringFixed(2))
+	})
+
+	t.Run("string fixed past the scale should pad with zeros", func(t *testing.T) {
+		assert.Equal(t, "40.250000", MustParse("40.25").StringFixed(6))
+	})
+
+	t.Run("string fixed should round amounts round cannot hold", func(t *testing.T) {
+		assert.Equal(t, "922337203685478", Amount{v: math.MaxInt64}.StringFixed(0))
+		assert.Equal(t, "-922337203685478", Amount{v: math.MinInt64}.StringFixed(0))
+	})
+}
+
+func TestAmountJSON(t *testing.T) {
+	type body struct {
+		Amount Amount `json:"amount"`
+	}
+
+	t.Run("marshal should write a plain number", func(t *testing.T) {
+		b, err := json.Marshal(body{Amount: MustParse("40.25")})
+
+		assert.Nil(t, err)
+		assert.Equal(t, `{"amount":40.25}`, string(b))
+	})
+
+	t.Run("unmarshal should accept number and string", func(t *testing.T) {
+		var n, s body
+
+		assert.Nil(t, json.Unmarshal([]byte(`{"amount":100}`), &n))
+		assert.Nil(t, json.Unmarshal([]byte(`{"amount":"100.10"}`), &s))
+		assert.Equal(t, MustFromInt(100), n.Amount)
+		assert.Equal(t, MustParse("100.1"), s.Amount)
+	})
+
+	t.Run("unmarshal should reject more decimals than the scale", func(t *testing.T) {
+		var b body
+
+		assert.NotNil(t, json.Unmarshal([]byte(`{"amount":0.00001}`), &b))
+	})
+}
+
+func TestAmountSQL(t *testing.T) {
+	t.Run("value should be a fixed decimal string", func(t *testing.T) {
+		v, err := MustParse("40.25").Value()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "40.2500", v)
+	})
+
+	t.Run("scan should accept driver types", func(t *testing.T) {
+		data := []any{[]byte("40.2500"), "40.25", 40.25}
+		for _, v := range data {
+			var a Amount
+
+			assert.Nil(t, a.Scan(v))
+			assert.Equal(t, MustParse("40.25"), a)
+		}
+		var a Amount
+		assert.Nil(t, a.Scan(int64(7)))
+		assert.Equal(t, MustFromInt(7), a)
+	})
+}
+
+func TestRate(t *testing.T) {
+	t.Run("convert should round to target currency precision", func(t *testing.T) {
+		data := []struct {
+			rate     string
+			to       Currency
+			expected Amount
+		}{
+			{"36.25", THB, MustParse("3625")},
+			{"0.02758621", USD, MustParse("2.76")},
+			{"4.14593", JPY, MustFromInt(415)},
+		}
+		for _, v := range data {
+			actual, err := MustFromInt(100).Convert(MustParseRate(v.rate), v.to)
+
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, actual)
+		}
+	})
+
+	t.Run("convert past the range of an amount should fail", func(t *testing.T) {
+		_, err := MustParse("900000000000000").Convert(MustParseRate("36.25"), THB)
+
+		assert.Equal(t, ErrAmountOverflow, err)
+	})
+
+	t.Run("inverse should round to rate scale", func(t *testing.T) {
+		data := []struct {
+			rate     Rate
+			expected Rate
+		}{
+			{MustParseRate("36.25"), MustParseRate("0.02758621")},
+			{One, One},
+		}
+		for _, v := range data {
+			actual, err := v.rate.Inverse()
+
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, actual)
+		}
+	})
+
+	t.Run("inverse should fail when it is not a rate", func(t *testing.T) {
+		_, zero := Rate{}.Inverse()
+		_, vanishing := MustParseRate("300000000").Inverse()
+
+		assert.Equal(t, ErrInvalidRate, zero)
+		assert.Equal(t, ErrInvalidRate, vanishing)
+	})
+
+	t.Run("parse should reject zero and negative rates", func(t *testing.T) {
+		_, zero := ParseRate("0")
+		_, neg := ParseRate("-1")
+
+		assert.Equal(t, ErrInvalidRate, zero)
+		assert.Equal(t, ErrInvalidRate, neg)
+	})
+
+	t.Run("json and sql should keep every decimal", func(t *testing.T) {
+		r := MustParseRate("0.02758621")
+		b, _ := json.Marshal(r)
+		v, _ := r.Value()
+		var fromJSON, fromSQL Rate
+
+		assert.Equal(t, `"0.02758621"`, string(b))
+		assert.Nil(t, json.Unmarshal(b, &fromJSON))
+		assert.Nil(t, fromSQL.Scan([]byte(v.(string))))
+		assert.Equal(t, r, fromJSON)
+		assert.Equal(t, r, fromSQL)
+	})
+}
+
+func TestMoney(t *testing.T) {
+	t.Run("add should keep the currency", func(t *testing.T) {
+		actual, err := Money{Amount: MustFromInt(1), Currency: THB}.Add(Money{Amount: MustParse("0.5"), Currency: THB})
+
+		assert.Nil(t, err)
+		assert.Equal(t, Money{Amount: MustParse("1.5"), Currency: THB}, actual)
+		assert.Equal(t, "1.50 THB", actual.String())
+	})
+
+	t.Run("mixing currencies should fail", func(t *testing.T) {
+		_, err1 := Money{Amount: MustFromInt(1), Currency: THB}.Sub(Money{Amount: MustFromInt(1), Currency: USD})
+		_, err2 := Money{Amount: MustFromInt(1), Currency: THB}.Cmp(Money{Amount: MustFromInt(1), Currency: USD})
+
+		assert.Equal(t, ErrCurrencyMismatch, err1)
+		assert.Equal(t, ErrCurrencyMismatch, err2)
+	})
+
+	t.Run("add past the range of an amount should fail", func(t *testing.T) {
+		_, err := Money{Amount: Amount{v: math.MaxInt64}, Currency: THB}.Add(Money{Amount: MustFromInt(1), Currency: THB})
+
+		assert.Equal(t, ErrAmountOverflow, err)
+	})
+
+	t.Run("is valid should check currency precision", func(t *testing.T) {
+		assert.True(t, Money{Amount: MustFromInt(100), Currency: JPY}.IsValid())
+		assert.False(t, Money{Amount: MustParse("100.5"), Currency: JPY}.IsValid())
+		assert.False(t, Money{Amount: MustFromInt(1), Currency: "XXX"}.IsValid())
+	})
+}
@@ -0,0 +1,144 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of decimal places a Rate keeps.
+const RateScale = 8
+
+const rateUnit = 100000000
+
+var ErrInvalidRate = errors.New("money: invalid rate")
+
+// Rate is an exchange rate: one unit of the source currency buys Rate units
+// of the target currency.
+type Rate struct {
+	v int64
+}
+
+// One is the rate between a currency and itself.
+var One = Rate{v: rateUnit}
+
+func ParseRate(s string) (Rate, error) {
+	v, err := parseScaled(s, RateScale)
+	if err != nil || v <= 0 {
+		return Rate{}, ErrInvalidRate
+	}
+	return Rate{v: v}, nil
+}
+
+func MustParseRate(s string) Rate {
+	r, err := ParseRate(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r Rate) String() string {
+	return formatScaled(r.v, RateScale)
+}
+
+func (r Rate) IsZero() bool { return r.v == 0 }
+
+func (r Rate) Cmp(o Rate) int {
+	switch {
+	case r.v < o.v:
+		return -1
+	case r.v > o.v:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Inverse returns the rate of the opposite direction rounded to RateScale. It
+// returns ErrInvalidRate for a zero rate and for a rate whose inverse rounds
+// to zero or does not fit a Rate.
+func (r Rate) Inverse() (Rate, error) {
+	if r.v == 0 {
+		return Rate{}, ErrInvalidRate
+	}
+	n := new(big.Int).Mul(big.NewInt(rateUnit), big.NewInt(rateUnit))
+	v := quoRound(n, big.NewInt(r.v))
+	if !v.IsInt64() || v.Sign() == 0 {
+		return Rate{}, ErrInvalidRate
+	}
+	return Rate{v: v.Int64()}, nil
+}
+
+// Convert applies the rate and rounds to the precision of the target currency.
+// It returns ErrAmountOverflow when the converted amount does not fit.
+func (a Amount) Convert(r Rate, to Currency) (Amount, error) {
+	v, err := a.MulRat(big.NewInt(r.v), big.NewInt(rateUnit))
+	if err != nil {
+		return Amount{}, err
+	}
+	return v.Round(to.Precision())
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+// UnmarshalJSON also accepts "0" so a message without a rate round-trips.
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		return nil
+	}
+	v, err := parseScaled(s, RateScale)
+	if err != nil || v < 0 {
+		return ErrInvalidRate
+	}
+	*r = Rate{v: v}
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return formatFixed(r.v, RateScale), nil
+}
+
+func (r *Rate) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*r = Rate{}
+		return nil
+	case int64:
+		*r = Rate{v: v * rateUnit}
+		return nil
+	case float64:
+		return r.scanString(strconv.FormatFloat(v, 'f', RateScale, 64))
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T into Rate", src)
+	}
+}
+
+func (r *Rate) scanString(s string) error {
+	v, err := parseScaled(s, RateScale)
+	if err != nil {
+		return err
+	}
+	*r = Rate{v: v}
+	return nil
+}
+
+func formatFixed(v int64, scale int) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	s := fmt.Sprintf("%0*d", scale+1, v)
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
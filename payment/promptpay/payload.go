@@ -0,0 +1,161 @@
+package promptpay
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+)
+
+// EMVCo merchant presented QR tags used by Thai PromptPay and Thai QR payment.
+const (
+	tagPayloadFormat       = "00"
+	tagPointOfInitiation   = "01"
+	tagMerchantPromptPay   = "29"
+	tagMerchantBillPay     = "30"
+	tagCurrency            = "53"
+	tagAmount              = "54"
+	tagCountry             = "58"
+	tagAdditionalData      = "62"
+	tagCRC                 = "63"
+	subReferenceLabel      = "05"
+	aidPromptPay           = "A000000677010111"
+	aidBillPayment         = "A000000677010112"
+	currencyTHB            = "764"
+	initiationStatic       = "11"
+	initiationDynamic      = "12"
+	maxReferenceLength     = 25
+	maxBillReferenceLength = 20
+)
+
+var (
+	ErrInvalidTarget    = errors.New("promptpay: target must be a phone number, tax ID or e-wallet ID")
+	ErrInvalidBillerID  = errors.New("promptpay: biller ID must be 15 digits")
+	ErrInvalidReference = errors.New("promptpay: invalid reference")
+	ErrInvalidAmount    = errors.New("promptpay: amount must be positive with at most 2 decimals")
+)
+
+// TargetType is the kind of PromptPay ID a payment is sent to.
+type TargetType string
+
+const (
+	TargetPhone   TargetType = "01"
+	TargetTaxID   TargetType = "02"
+	TargetEWallet TargetType = "03"
+)
+
+// ParseTarget normalizes a PromptPay ID. Phone numbers become the 13 digit
+// international form the payload carries, e.g. 0812345678 is 0066812345678.
+func ParseTarget(id string) (TargetType, string, error) {
+	d := digits(id)
+	switch {
+	case len(d) == 10 && d[0] == '0':
+		return TargetPhone, "0066" + d[1:], nil
+	case len(d) == 13:
+		return TargetTaxID, d, nil
+	case len(d) == 15:
+		return TargetEWallet, d, nil
+	default:
+		return "", "", ErrInvalidTarget
+	}
+}
+
+// Payload builds a PromptPay credit transfer payload for target. A positive
+// amount makes it a one-time dynamic QR; ref, when set, is carried as the
+// reference label so the payment can be matched when it arrives.
+func Payload(target string, amount money.Amount, ref string) (string, error) {
+	typ, id, err := ParseTarget(target)
+	if err != nil {
+		return "", err
+	}
+	if len(ref) > maxReferenceLength {
+		return "", ErrInvalidReference
+	}
+	account := field("00", aidPromptPay) + field(string(typ), id)
+	return build(tagMerchantPromptPay, account, amount, ref)
+}
+
+// BillPaymentPayload builds a Thai QR bill payment payload. ref1 and ref2
+// are the biller's references, at most 20 upper case letters or digits each.
+func BillPaymentPayload(billerID, ref1, ref2 string, amount money.Amount) (string, error) {
+	if d := digits(billerID); len(d) != 15 || d != billerID {
+		return "", ErrInvalidBillerID
+	}
+	if !validBillReference(ref1) || ref1 == "" || !validBillReference(ref2) {
+		return "", ErrInvalidReference
+	}
+	account := field("00", aidBillPayment) + field("01", billerID) + field("02", ref1)
+	if ref2 != "" {
+		account += field("03", ref2)
+	}
+	return build(tagMerchantBillPay, account, amount, "")
+}
+
+func build(accountTag, account string, amount money.Amount, ref string) (string, error) {
+	if amount.IsNegative() || !amount.HasPrecision(2) {
+		return "", ErrInvalidAmount
+	}
+	var b strings.Builder
+	b.WriteString(field(tagPayloadFormat, "01"))
+	if amount.IsZero() {
+		b.WriteString(field(tagPointOfInitiation, initiationStatic))
+	} else {
+		b.WriteString(field(tagPointOfInitiation, initiationDynamic))
+	}
+	b.WriteString(field(accountTag, account))
+	b.WriteString(field(tagCurrency, currencyTHB))
+	if !amount.IsZero() {
+		b.WriteString(field(tagAmount, amount.StringFixed(2)))
+	}
+	b.WriteString(field(tagCountry, "TH"))
+	if ref != "" {
+		b.WriteString(field(tagAdditionalData, field(subReferenceLabel, ref)))
+	}
+	// The checksum covers everything up to and including its own tag and length.
+	b.WriteString(tagCRC + "04")
+	return b.String() + fmt.Sprintf("%04X", crc16([]byte(b.String()))), nil
+}
+
+func field(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func validBillReference(s string) bool {
+	if len(s) > maxBillReferenceLength {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// crc16 is CRC-16/CCITT-FALSE as required by EMVCo: polynomial 0x1021,
+// initial value 0xFFFF, no reflection.
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
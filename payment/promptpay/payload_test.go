@@ -0,0 +1,86 @@
+//go:build unit_test
+// +build unit_test
+
+package promptpay
+
+import (
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRC16(t *testing.T) {
+	// Reference payload published for PromptPay ID 0801234567.
+	actual := crc16([]byte("00020101021129370016A000000677010111011300668012345675802TH53037646304"))
+
+	assert.Equal(t, uint16(0x6197), actual)
+}
+
+func TestPayload(t *testing.T) {
+	t.Run("phone without amount should build static payload", func(t *testing.T) {
+		//Action
+		actual, err := Payload("080-123-4567", money.Amount{}, "")
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, "00020101021129370016A0000006770101110113006680123456753037645802TH6304BE2B", actual)
+	})
+
+	t.Run("amount and reference should build dynamic payload", func(t *testing.T) {
+		//Action
+		actual, err := Payload("0812345678", money.MustParse("40.25"), "42")
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, "00020101021229370016A000000677010111011300668123456785303764540540.255802TH62060502426304C9D7", actual)
+	})
+
+	t.Run("target types should follow id length", func(t *testing.T) {
+		data := []struct {
+			in       string
+			expected TargetType
+		}{
+			{"0812345678", TargetPhone},
+			{"1234567890123", TargetTaxID},
+			{"123456789012345", TargetEWallet},
+		}
+		for _, v := range data {
+			typ, _, err := ParseTarget(v.in)
+
+			assert.Nil(t, err)
+			assert.Equal(t, v.expected, typ)
+		}
+	})
+
+	t.Run("invalid input should fail", func(t *testing.T) {
+		_, target := Payload("12345", money.MustFromInt(1), "")
+		_, amount := Payload("0812345678", money.MustParse("1.005"), "")
+		_, ref := Payload("0812345678", money.MustFromInt(1), "12345678901234567890123456")
+
+		assert.Equal(t, ErrInvalidTarget, target)
+		assert.Equal(t, ErrInvalidAmount, amount)
+		assert.Equal(t, ErrInvalidReference, ref)
+	})
+}
+
+func TestBillPaymentPayload(t *testing.T) {
+	t.Run("biller and references should build bill payment payload", func(t *testing.T) {
+		//Action
+		actual, err := BillPaymentPayload("010555512345600", "7", "42", money.MustFromInt(1200))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, "00020101021230500016A000000677010112011501055551234560002017030242530376454071200.005802TH6304735F", actual)
+	})
+
+	t.Run("invalid biller or reference should fail", func(t *testing.T) {
+		_, biller := BillPaymentPayload("0105555123456", "7", "", money.MustFromInt(1))
+		_, ref := BillPaymentPayload("010555512345600", "", "", money.MustFromInt(1))
+		_, lower := BillPaymentPayload("010555512345600", "abc", "", money.MustFromInt(1))
+
+		assert.Equal(t, ErrInvalidBillerID, biller)
+		assert.Equal(t, ErrInvalidReference, ref)
+		assert.Equal(t, ErrInvalidReference, lower)
+	})
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+// RequestCapture captures Amount of the authorized payment PaymentID. A zero
+// Amount captures everything that was authorized.
+type RequestCapture struct {
+	PaymentID uint         `json:"-"`
+	Amount    money.Amount `json:"amount"`
+}
+
+// Capture books an authorized payment, possibly for less than was authorized,
+// and releases the rest of the customer's hold.
+func (s *service) Capture(ctx context.Context, r RequestCapture) (*PaymentResponse, error) {
+	if r.Amount.IsNegative() {
+		return nil, ErrInvalidCaptureAmount
+	}
+	t, err := s.authorized(ctx, r.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	amount := r.Amount
+	if amount.IsZero() {
+		amount = t.Amount
+	}
+	if amount.Cmp(t.Amount) > 0 {
+		return nil, ErrCaptureExceedsAuthorized
+	}
+	if !amount.HasPrecision(s.cfg.Precision) || !amount.HasPrecision(t.Currency.Precision()) {
+		return nil, ErrPaymentAmountPrecision
+	}
+	o, err := s.o.GetOrder(ctx, t.OrderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp, err := s.ch.Provider(t.Channel)
+	if err != nil {
+		return nil, fromChannelError(err)
+	}
+
+	// Everything booking checks that can be told beforehand is checked
+	// before the channel takes the money
+	n := s.c.Now()
+	h, err := s.p.GetHold(ctx, t.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotAuthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !h.ExpiresAt.After(n) {
+		return nil, ErrAuthorizationExpired
+	}
+	if o.Status != constant.OrderStatusRequestPayment {
+		return nil, ErrOrderNotRequestPayment
+	}
+	if !constant.IsActiveMerchant(o.Merchant.Status) {
+		return nil, ErrMerchantNotActive
+	}
+	if amount != t.Amount {
+		settled, err := amount.Convert(t.Rate, t.SettledCurrency)
+		if err != nil {
+			return nil, ErrAmountOutOfRange
+		}
+		t.SettledAmount = settled
+		t.Amount = amount
+	}
+	if err := s.charge(ctx, o, t, n); err != nil {
+		return nil, err
+	}
+	t.UpdatedAt = n
+	t.Status = constant.PaymentTranasctionStatusConfirm
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return nil, err
+	}
+	// The channel captures first so a capture it refuses is never booked. A
+	// captured authorization cannot be voided, so a capture that then fails
+	// to book is recorded for reconciliation.
+	if _, err := cp.Capture(ctx, t.ProviderRef, t.SettledAmount); err != nil {
+		return nil, fromChannelError(err)
+	}
+	if err := s.p.Capture(ctx, o, t, e); err != nil {
+		s.reconcile(ctx, constant.ReconciliationKindCaptureNotBooked, t, err)
+		// No hold left to capture means it was released meanwhile
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotAuthorized
+		}
+		return nil, fromStorageError(err)
+	}
+	return toPaymentResponse(t, ""), nil
+}
+
+// Void cancels an authorized payment and releases the customer's hold.
+func (s *service) Void(ctx context.Context, paymentID uint) (*PaymentResponse, error) {
+	t, err := s.authorized(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.void(ctx, t, "authorization voided", s.c.Now()); err != nil {
+		return nil, err
+	}
+	return toPaymentResponse(t, ""), nil
+}
+
+// ExpireAuthorizations voids up to limit authorizations whose hold expired at
+// now and returns how many it voided. Payments captured or voided in the
+// meantime are skipped.
+func (s *service) ExpireAuthorizations(ctx context.Context, now time.Time, limit int) (int, error) {
+	rows, err := s.p.ListExpiredHolds(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	n := s.c.Now()
+	expired := 0
+	for i := range rows {
+		err := s.void(ctx, &rows[i], ErrAuthorizationExpired.Message, n)
+		if err == ErrPaymentNotAuthorized {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *service) authorized(ctx context.Context, id uint) (*storage.PaymentTranasction, error) {
+	t, err := s.p.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != constant.PaymentTranasctionTypePayment {
+		return nil, ErrPaymentNotFound
+	}
+	if t.Status != constant.PaymentTranasctionStatusAuthorized {
+		return nil, ErrPaymentNotAuthorized
+	}
+	return t, nil
+}
+
+// void releases the hold first and then the channel authorization. A
+// channel that fails to void only gets logged: its authorization lapses on
+// its own and the customer's amount is already free.
+func (s *service) void(ctx context.Context, t *storage.PaymentTranasction, reason string, n time.Time) error {
+	cp, err := s.ch.Provider(t.Channel)
+	if err != nil {
+		return fromChannelError(err)
+	}
+	t.UpdatedAt = n
+	t.Status = constant.PaymentTranasctionStatusVoid
+	t.Reason = reason
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return err
+	}
+	err = s.p.Void(ctx, t, e)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrPaymentNotAuthorized
+	}
+	if err != nil {
+		return fromStorageError(err)
+	}
+	voidChannel(ctx, cp, t.ProviderRef)
+	return nil
+}
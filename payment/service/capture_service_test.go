@@ -0,0 +1,343 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/fee"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCaptureService(t *testing.T) {
+	var s Service
+	var m *mockOrderStorage
+	var mp *mockPaymentTranasctionStorage
+	var mt *mockClock
+	var cp *mockChannelProvider
+	var o *storage.Order
+	var p *storage.PaymentTranasction
+
+	setup := func() {
+		o = &storage.Order{
+			Model:    gorm.Model{ID: 7},
+			Amount:   money.MustFromInt(100),
+			Currency: money.USD,
+			Status:   constant.OrderStatusRequestPayment,
+			Customer: storage.CustomerProfile{Status: constant.CustomerStatusActive, Amount: money.MustFromInt(5000), Currency: money.THB},
+			Merchant: storage.MerchantProfile{Status: constant.MerchantStatusActive, Currency: money.USD},
+		}
+		m = &mockOrderStorage{}
+		m.SetOrder(o, nil)
+		mp = &mockPaymentTranasctionStorage{}
+		mt = &mockClock{}
+		mt.SetNow(time.Now().UTC())
+		cp = &mockChannelProvider{}
+		ch := channel.NewRegistry()
+		ch.Register(constant.PaymentChannelCredit, cp)
+		rp := &mockRateProvider{}
+		rp.SetRate(money.USD, money.THB, money.MustParseRate("36.25"))
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{HoldExpiry: time.Hour})
+		p = &storage.PaymentTranasction{
+			Model:           gorm.Model{ID: 3},
+			OrderID:         7,
+			Type:            constant.PaymentTranasctionTypePayment,
+			Channel:         constant.PaymentChannelCredit,
+			Status:          constant.PaymentTranasctionStatusAuthorized,
+			Amount:          money.MustFromInt(100),
+			Currency:        money.USD,
+			SettledAmount:   money.MustFromInt(3625),
+			SettledCurrency: money.THB,
+			Rate:            money.MustParseRate("36.25"),
+			ProviderRef:     "auth-1",
+		}
+		mp.SetByID(p, nil)
+		mp.SetHold(&storage.Hold{PaymentTranasctionID: 3, Status: constant.HoldStatusHeld, ExpiresAt: mt.t.Add(time.Hour)}, nil)
+	}
+
+	t.Run("credit payment should hold settled amount without capturing", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Payment(context.Background(), RequestPayment{OrderID: 7, Channel: constant.PaymentChannelCredit, Amount: money.MustFromInt(100)})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusAuthorized, actual.Status)
+		assert.Equal(t, []*storage.Hold{{Amount: money.MustFromInt(3625), Currency: money.THB, Status: constant.HoldStatusHeld, ExpiresAt: mt.t.Add(time.Hour)}}, mp.Holds)
+		assert.Equal(t, "auth-1", mp.Calls[0].ProviderRef)
+		assert.Equal(t, 1, len(cp.Authorizes))
+		assert.Equal(t, 0, len(cp.Captures))
+		assert.Equal(t, constant.PaymentTranasctionStatusAuthorized, decodePaymentMessage(t, mp.Events[0]).Status)
+	})
+
+	t.Run("credit payment failing to hold should void authorization and reject", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetConfirm(storage.ErrCustomerAmountNotEnough)
+
+		//Action
+		_, err := s.Payment(context.Background(), RequestPayment{OrderID: 7, Channel: constant.PaymentChannelCredit, Amount: money.MustFromInt(100)})
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, err)
+		assert.Equal(t, []string{"auth-1"}, cp.Voids)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, mp.Calls[0].Status)
+	})
+
+	t.Run("credit payment of request given up should fail without authorizing", func(t *testing.T) {
+		//Arrange
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		//Action
+		_, err := s.Payment(ctx, RequestPayment{OrderID: 7, Channel: constant.PaymentChannelCredit, Amount: money.MustFromInt(100)})
+
+		//Assert
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, len(cp.Authorizes))
+		assert.Equal(t, 0, len(mp.Holds))
+	})
+
+	t.Run("credit payment converting past the range of an amount should fail without holding", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Amount = money.MustParse("900000000000000")
+
+		//Action
+		_, err := s.Payment(context.Background(), RequestPayment{OrderID: 7, Channel: constant.PaymentChannelCredit, Amount: o.Amount})
+
+		//Assert
+		assert.Equal(t, ErrAmountOutOfRange, err)
+		assert.Equal(t, 0, len(mp.Holds))
+		assert.Equal(t, 0, len(cp.Authorizes))
+	})
+
+	t.Run("partial capture should charge fee on captured amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		ch := channel.NewRegistry()
+		ch.Register(constant.PaymentChannelCredit, cp)
+		s = NewService(m, mp, mt, &mockRateProvider{}, ch, PaymentConfig{Fees: fee.Schedule{
+			Channels: map[constant.PaymentChannel]fee.Rule{
+				constant.PaymentChannelCredit: {Rate: money.MustParseRate("0.03")},
+			},
+		}})
+
+		//Action
+		actual, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3, Amount: money.MustFromInt(40)})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParse("1.2"), actual.FeeAmount)
+		assert.Equal(t, money.MustParse("38.8"), actual.NetAmount)
+		assert.Equal(t, money.MustParse("1.2"), mp.Captured[0].FeeAmount)
+	})
+
+	t.Run("full capture should book authorized amount", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, actual.Status)
+		assert.Equal(t, money.MustFromInt(100), mp.Captured[0].Amount)
+		assert.Equal(t, money.MustFromInt(3625), mp.Captured[0].SettledAmount)
+		assert.Equal(t, []*storage.Order{o}, mp.Confirmed)
+		assert.Equal(t, []money.Amount{money.MustFromInt(3625)}, cp.Captures)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, decodePaymentMessage(t, mp.Events[0]).Status)
+	})
+
+	t.Run("partial capture should convert captured amount at authorized rate", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3, Amount: money.MustParse("40.5")})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParse("40.5"), actual.Amount)
+		assert.Equal(t, money.MustParse("1468.13"), actual.SettledAmount)
+		assert.Equal(t, []money.Amount{money.MustParse("1468.13")}, cp.Captures)
+	})
+
+	t.Run("capture should fail when", func(t *testing.T) {
+		data := []struct {
+			name     string
+			arrange  func()
+			r        RequestCapture
+			expected error
+		}{
+			{"amount exceeds authorized", func() {}, RequestCapture{PaymentID: 3, Amount: money.MustParse("100.01")}, ErrCaptureExceedsAuthorized},
+			{"amount is negative", func() {}, RequestCapture{PaymentID: 3, Amount: money.MustFromInt(-1)}, ErrInvalidCaptureAmount},
+			{"amount has too many decimals", func() {}, RequestCapture{PaymentID: 3, Amount: money.MustParse("1.001")}, ErrPaymentAmountPrecision},
+			{"payment is not authorized", func() { p.Status = constant.PaymentTranasctionStatusConfirm }, RequestCapture{PaymentID: 3}, ErrPaymentNotAuthorized},
+			{"payment is a refund", func() { p.Type = constant.PaymentTranasctionTypeRefund }, RequestCapture{PaymentID: 3}, ErrPaymentNotFound},
+			{"payment is unknown", func() { mp.SetByID(nil, gorm.ErrRecordNotFound) }, RequestCapture{PaymentID: 3}, ErrPaymentNotFound},
+			{"hold is expired", func() { mp.hold.ExpiresAt = mt.t }, RequestCapture{PaymentID: 3}, ErrAuthorizationExpired},
+			{"hold is released", func() { mp.SetHold(nil, gorm.ErrRecordNotFound) }, RequestCapture{PaymentID: 3}, ErrPaymentNotAuthorized},
+			{"order is not requesting payment", func() { o.Status = constant.OrderStatusConfirm }, RequestCapture{PaymentID: 3}, ErrOrderNotRequestPayment},
+			{"merchant is not active", func() { o.Merchant.Status = constant.MerchantStatusSuspend }, RequestCapture{PaymentID: 3}, ErrMerchantNotActive},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+				v.arrange()
+
+				//Action
+				_, err := s.Capture(context.Background(), v.r)
+
+				//Assert
+				assert.Equal(t, v.expected, err)
+				assert.Equal(t, 0, len(cp.Captures))
+			})
+		}
+	})
+
+	t.Run("capture refused by channel should fail without booking", func(t *testing.T) {
+		//Arrange
+		setup()
+		cp.SetCapture(channel.ErrPartialCaptureNotSupported)
+
+		//Action
+		_, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3, Amount: money.MustFromInt(40)})
+
+		//Assert
+		assert.Equal(t, ErrPartialCaptureNotSupported, err)
+		assert.Equal(t, 0, len(mp.Captured))
+		assert.Equal(t, 0, len(mp.Events))
+	})
+
+	t.Run("capture of authorization unknown to channel should fail without booking", func(t *testing.T) {
+		//Arrange
+		setup()
+		cp.SetCapture(channel.ErrAuthorizationNotFound)
+
+		//Action
+		_, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3})
+
+		//Assert
+		assert.Equal(t, ErrAuthorizationNotFound, err)
+		assert.Equal(t, 0, len(mp.Captured))
+	})
+
+	t.Run("capture failing to book should record capture for reconciliation when", func(t *testing.T) {
+		data := []struct {
+			name     string
+			err      error
+			expected error
+		}{
+			{"payment was captured concurrently", storage.ErrPaymentNotAuthorized, ErrPaymentNotAuthorized},
+			{"hold is expired", storage.ErrHoldExpired, ErrAuthorizationExpired},
+			{"hold was released concurrently", gorm.ErrRecordNotFound, ErrPaymentNotAuthorized},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+				mp.SetConfirm(v.err)
+
+				//Action
+				_, err := s.Capture(context.Background(), RequestCapture{PaymentID: 3})
+
+				//Assert
+				assert.Equal(t, v.expected, err)
+				assert.Equal(t, []money.Amount{money.MustFromInt(3625)}, cp.Captures)
+				assert.Equal(t, 1, len(mp.Reconciled))
+				r := mp.Reconciled[0]
+				assert.Equal(t, constant.ReconciliationKindCaptureNotBooked, r.Kind)
+				assert.Equal(t, uint(3), r.PaymentTranasctionID)
+				assert.Equal(t, "auth-1", r.ProviderRef)
+				assert.Equal(t, money.MustFromInt(3625), r.Amount)
+				assert.Equal(t, v.err.Error(), r.Reason)
+			})
+		}
+	})
+
+	t.Run("void should release hold and void channel authorization", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Void(context.Background(), 3)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusVoid, actual.Status)
+		assert.Equal(t, "authorization voided", mp.Voided[0].Reason)
+		assert.Equal(t, []string{"auth-1"}, cp.Voids)
+		assert.Equal(t, constant.PaymentTranasctionStatusVoid, decodePaymentMessage(t, mp.Events[0]).Status)
+	})
+
+	t.Run("void of payment that is not authorized should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		p.Status = constant.PaymentTranasctionStatusVoid
+
+		//Action
+		_, err := s.Void(context.Background(), 3)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotAuthorized, err)
+		assert.Equal(t, 0, len(cp.Voids))
+	})
+
+	t.Run("void of hold released concurrently should fail without voiding channel authorization", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetVoid(gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.Void(context.Background(), 3)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotAuthorized, err)
+		assert.Equal(t, 0, len(cp.Voids))
+	})
+
+	t.Run("expire authorizations should void expired holds", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpiredHolds([]storage.PaymentTranasction{*p})
+
+		//Action
+		actual, err := s.ExpireAuthorizations(context.Background(), mt.t, 10)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, actual)
+		assert.Equal(t, []time.Time{mt.t}, mp.Now)
+		assert.Equal(t, ErrAuthorizationExpired.Message, mp.Voided[0].Reason)
+		assert.Equal(t, []string{"auth-1"}, cp.Voids)
+	})
+
+	t.Run("expire authorizations should skip payments captured meanwhile", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpiredHolds([]storage.PaymentTranasction{*p})
+		mp.SetVoid(storage.ErrPaymentNotAuthorized)
+
+		//Action
+		actual, err := s.ExpireAuthorizations(context.Background(), mt.t, 10)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, actual)
+		assert.Equal(t, 0, len(cp.Voids))
+	})
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+type RequestCreateCustomer struct {
+	Name     string         `json:"name"`
+	Currency money.Currency `json:"currency"`
+}
+
+type RequestUpdateCustomerStatus struct {
+	Status constant.CustomerStatus `json:"status"`
+}
+
+type RequestTopUp struct {
+	Amount money.Amount `json:"amount"`
+}
+
+type CustomerResponse struct {
+	ID         uint                    `json:"id"`
+	Name       string                  `json:"name"`
+	Status     constant.CustomerStatus `json:"status"`
+	Amount     money.Amount            `json:"amount"`
+	HeldAmount money.Amount            `json:"heldAmount"`
+	Currency   money.Currency          `json:"currency"`
+	CreatedAt  time.Time               `json:"createdAt"`
+	UpdatedAt  time.Time               `json:"updatedAt"`
+}
+
+type CustomerService interface {
+	CreateCustomer(ctx context.Context, r RequestCreateCustomer) (*CustomerResponse, error)
+	GetCustomer(ctx context.Context, id uint) (*CustomerResponse, error)
+	ListCustomers(ctx context.Context, r RequestPage) (*PageResponse[CustomerResponse], error)
+	UpdateCustomerStatus(ctx context.Context, id uint, r RequestUpdateCustomerStatus) (*CustomerResponse, error)
+	TopUpCustomer(ctx context.Context, id uint, r RequestTopUp) (*CustomerResponse, error)
+}
+
+type customerService struct {
+	cs storage.CustomerStorage
+}
+
+func NewCustomerService(cs storage.CustomerStorage) CustomerService {
+	return &customerService{
+		cs: cs,
+	}
+}
+
+func toCustomerResponse(c *storage.CustomerProfile) *CustomerResponse {
+	return &CustomerResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		Status:     c.Status,
+		Amount:     c.Amount,
+		HeldAmount: c.HeldAmount,
+		Currency:   c.Currency,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
+
+func fromCustomerStorageError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCustomerNotFound
+	}
+	return err
+}
+
+func (s *customerService) CreateCustomer(ctx context.Context, r RequestCreateCustomer) (*CustomerResponse, error) {
+	if r.Name == "" || len(r.Name) > 100 {
+		return nil, ErrInvalidName
+	}
+	if r.Currency == "" {
+		r.Currency = money.DefaultCurrency
+	}
+	if !money.IsValidCurrency(r.Currency) {
+		return nil, ErrInvalidCurrency
+	}
+	c := &storage.CustomerProfile{
+		Name:     r.Name,
+		Status:   constant.CustomerStatusActive,
+		Currency: r.Currency,
+	}
+	if err := s.cs.CreateCustomer(ctx, c); err != nil {
+		return nil, err
+	}
+	return toCustomerResponse(c), nil
+}
+
+func (s *customerService) GetCustomer(ctx context.Context, id uint) (*CustomerResponse, error) {
+	c, err := s.cs.GetCustomer(ctx, id)
+	if err != nil {
+		return nil, fromCustomerStorageError(err)
+	}
+	return toCustomerResponse(c), nil
+}
+
+func (s *customerService) ListCustomers(ctx context.Context, r RequestPage) (*PageResponse[CustomerResponse], error) {
+	r = r.normalize()
+	c, total, err := s.cs.ListCustomers(ctx, r.offset(), r.Size)
+	if err != nil {
+		return nil, err
+	}
+	res := &PageResponse[CustomerResponse]{
+		Items: []CustomerResponse{},
+		Page:  r.Page,
+		Size:  r.Size,
+		Total: total,
+	}
+	for i := range c {
+		res.Items = append(res.Items, *toCustomerResponse(&c[i]))
+	}
+	return res, nil
+}
+
+func (s *customerService) UpdateCustomerStatus(ctx context.Context, id uint, r RequestUpdateCustomerStatus) (*CustomerResponse, error) {
+	if !constant.IsValidCustomerStatus(r.Status) {
+		return nil, ErrInvalidCustomerStatus
+	}
+	if err := s.cs.UpdateCustomerStatus(ctx, id, r.Status); err != nil {
+		return nil, fromCustomerStorageError(err)
+	}
+	return s.GetCustomer(ctx, id)
+}
+
+func (s *customerService) TopUpCustomer(ctx context.Context, id uint, r RequestTopUp) (*CustomerResponse, error) {
+	if !r.Amount.IsPositive() {
+		return nil, ErrInvalidTopUpAmount
+	}
+	c, err := s.cs.TopUpCustomer(ctx, id, r.Amount)
+	if err != nil {
+		return nil, fromCustomerStorageError(err)
+	}
+	return toCustomerResponse(c), nil
+}
@@ -0,0 +1,208 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type mockCustomerStorage struct {
+	c        *storage.CustomerProfile
+	list     []storage.CustomerProfile
+	total    int64
+	err      error
+	Created  []*storage.CustomerProfile
+	Statuses []constant.CustomerStatus
+	TopUps   []money.Amount
+	Offsets  []int
+}
+
+func (m *mockCustomerStorage) SetCustomer(c *storage.CustomerProfile, err error) {
+	m.c = c
+	m.err = err
+}
+
+func (m *mockCustomerStorage) GetCustomer(ctx context.Context, id uint) (*storage.CustomerProfile, error) {
+	return m.c, m.err
+}
+
+func (m *mockCustomerStorage) ListCustomers(ctx context.Context, offset, limit int) ([]storage.CustomerProfile, int64, error) {
+	m.Offsets = append(m.Offsets, offset, limit)
+	return m.list, m.total, m.err
+}
+
+func (m *mockCustomerStorage) CreateCustomer(ctx context.Context, c *storage.CustomerProfile) error {
+	m.Created = append(m.Created, c)
+	return m.err
+}
+
+func (m *mockCustomerStorage) UpdateCustomerStatus(ctx context.Context, id uint, status constant.CustomerStatus) error {
+	m.Statuses = append(m.Statuses, status)
+	return m.err
+}
+
+func (m *mockCustomerStorage) TopUpCustomer(ctx context.Context, id uint, amount money.Amount) (*storage.CustomerProfile, error) {
+	m.TopUps = append(m.TopUps, amount)
+	return m.c, m.err
+}
+
+func TestCustomerService(t *testing.T) {
+	var s CustomerService
+	var m *mockCustomerStorage
+
+	setup := func() {
+		m = &mockCustomerStorage{}
+		m.SetCustomer(&storage.CustomerProfile{Model: gorm.Model{ID: 1}, Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)}, nil)
+		s = NewCustomerService(m)
+	}
+
+	t.Run("create customer should create active customer", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CreateCustomer(context.Background(), RequestCreateCustomer{Name: "Madmax Drinkcola"})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.CustomerStatusActive, actual.Status)
+		assert.Equal(t, money.DefaultCurrency, actual.Currency)
+		assert.Equal(t, "Madmax Drinkcola", m.Created[0].Name)
+	})
+
+	t.Run("create customer should keep requested wallet currency", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CreateCustomer(context.Background(), RequestCreateCustomer{Name: "Madmax Drinkcola", Currency: money.USD})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.USD, actual.Currency)
+		assert.Equal(t, money.USD, m.Created[0].Currency)
+	})
+
+	t.Run("create customer with unknown currency should return invalid currency", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.CreateCustomer(context.Background(), RequestCreateCustomer{Name: "Madmax Drinkcola", Currency: "XXX"})
+
+		//Assert
+		assert.Equal(t, ErrInvalidCurrency, err)
+		assert.Equal(t, 0, len(m.Created))
+	})
+
+	t.Run("create customer without name should return invalid name", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.CreateCustomer(context.Background(), RequestCreateCustomer{})
+
+		//Assert
+		assert.Equal(t, ErrInvalidName, err)
+		assert.Equal(t, 0, len(m.Created))
+	})
+
+	t.Run("get customer not found should return customer not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.SetCustomer(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.GetCustomer(context.Background(), 1)
+
+		//Assert
+		assert.Equal(t, ErrCustomerNotFound, err)
+	})
+
+	t.Run("list customers should page with defaults", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.list = []storage.CustomerProfile{*m.c}
+		m.total = 21
+
+		//Action
+		actual, err := s.ListCustomers(context.Background(), RequestPage{Page: 2})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []int{20, 20}, m.Offsets)
+		assert.Equal(t, 2, actual.Page)
+		assert.Equal(t, 20, actual.Size)
+		assert.Equal(t, int64(21), actual.Total)
+		assert.Equal(t, 1, len(actual.Items))
+	})
+
+	t.Run("list customers should cap page size", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, _ := s.ListCustomers(context.Background(), RequestPage{Page: 1, Size: 1000})
+
+		//Assert
+		assert.Equal(t, []int{0, 100}, m.Offsets)
+		assert.Equal(t, []CustomerResponse{}, actual.Items)
+	})
+
+	t.Run("update customer status should reject unknown status", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.UpdateCustomerStatus(context.Background(), 1, RequestUpdateCustomerStatus{Status: "banned"})
+
+		//Assert
+		assert.Equal(t, ErrInvalidCustomerStatus, err)
+		assert.Equal(t, 0, len(m.Statuses))
+	})
+
+	t.Run("update customer status should change status", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.UpdateCustomerStatus(context.Background(), 1, RequestUpdateCustomerStatus{Status: constant.CustomerStatusInActive})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []constant.CustomerStatus{constant.CustomerStatusInActive}, m.Statuses)
+	})
+
+	t.Run("top up should reject non positive amount", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.TopUpCustomer(context.Background(), 1, RequestTopUp{Amount: money.MustFromInt(0)})
+
+		//Assert
+		assert.Equal(t, ErrInvalidTopUpAmount, err)
+		assert.Equal(t, 0, len(m.TopUps))
+	})
+
+	t.Run("top up should add amount to balance", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.TopUpCustomer(context.Background(), 1, RequestTopUp{Amount: money.MustFromInt(250)})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []money.Amount{money.MustFromInt(250)}, m.TopUps)
+		assert.Equal(t, money.MustFromInt(1000), actual.Amount)
+	})
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+)
+
+// Error is a domain error with everything the transport layer needs to report it.
+type Error struct {
+	Code       string
+	HTTPStatus int
+	Message    string
+	Retryable  bool
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrInvalidRequest                  = &Error{Code: "INVALID_REQUEST", HTTPStatus: http.StatusBadRequest, Message: "invalid request"}
+	ErrRequestTooLarge                 = &Error{Code: "REQUEST_TOO_LARGE", HTTPStatus: http.StatusRequestEntityTooLarge, Message: "request body is too large"}
+	ErrInvalidPaymentChannel           = &Error{Code: "INVALID_PAYMENT_CHANNEL", HTTPStatus: http.StatusUnprocessableEntity, Message: "invalid payment channel"}
+	ErrInvalidPaymentAmount            = &Error{Code: "INVALID_PAYMENT_AMOUNT", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment amount must be greater than zero"}
+	ErrPaymentAmountPrecision          = &Error{Code: "PAYMENT_AMOUNT_PRECISION", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment amount has too many decimal places"}
+	ErrPaymentAmountMismatch           = &Error{Code: "PAYMENT_AMOUNT_MISMATCH", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment amount does not match order amount"}
+	ErrPaymentAmountExceedsOutstanding = &Error{Code: "PAYMENT_AMOUNT_EXCEEDS_OUTSTANDING", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment amount exceeds outstanding order amount"}
+	ErrOrderNotFound                   = &Error{Code: "ORDER_NOT_FOUND", HTTPStatus: http.StatusNotFound, Message: "order not found"}
+	ErrOrderNotRequestPayment          = &Error{Code: "ORDER_NOT_REQUEST_PAYMENT", HTTPStatus: http.StatusUnprocessableEntity, Message: "order status is not request payment"}
+	ErrCustomerNotFound                = &Error{Code: "CUSTOMER_NOT_FOUND", HTTPStatus: http.StatusNotFound, Message: "customer not found"}
+	ErrMerchantNotFound                = &Error{Code: "MERCHANT_NOT_FOUND", HTTPStatus: http.StatusNotFound, Message: "merchant not found"}
+	ErrInvalidName                     = &Error{Code: "INVALID_NAME", HTTPStatus: http.StatusUnprocessableEntity, Message: "name must be between 1 and 100 characters"}
+	ErrInvalidCustomerStatus           = &Error{Code: "INVALID_CUSTOMER_STATUS", HTTPStatus: http.StatusUnprocessableEntity, Message: "invalid customer status"}
+	ErrInvalidMerchantStatus           = &Error{Code: "INVALID_MERCHANT_STATUS", HTTPStatus: http.StatusUnprocessableEntity, Message: "invalid merchant status"}
+	ErrInvalidTopUpAmount              = &Error{Code: "INVALID_TOP_UP_AMOUNT", HTTPStatus: http.StatusUnprocessableEntity, Message: "top up amount must be greater than zero"}
+	ErrCustomerNotActive               = &Error{Code: "CUSTOMER_NOT_ACTIVE", HTTPStatus: http.StatusUnprocessableEntity, Message: "customer status is not active"}
+	ErrCustomerAmountNotEnough         = &Error{Code: "CUSTOMER_AMOUNT_NOT_ENOUGH", HTTPStatus: http.StatusUnprocessableEntity, Message: "customer amount is not enough"}
+	ErrMerchantNotActive               = &Error{Code: "MERCHANT_NOT_ACTIVE", HTTPStatus: http.StatusUnprocessableEntity, Message: "merchant status is not active"}
+	ErrOrderIllegalTransition          = &Error{Code: "ORDER_ILLEGAL_TRANSITION", HTTPStatus: http.StatusConflict, Message: "order status cannot change to the requested status"}
+	ErrOrderStatusChanged              = &Error{Code: "ORDER_STATUS_CHANGED", HTTPStatus: http.StatusConflict, Message: "order status was changed concurrently", Retryable: true}
+	ErrOrderAmountInvalid              = &Error{Code: "ORDER_AMOUNT_INVALID", HTTPStatus: http.StatusUnprocessableEntity, Message: "order amount must be greater than zero"}
+	ErrOrderAmountPrecision            = &Error{Code: "ORDER_AMOUNT_PRECISION", HTTPStatus: http.StatusUnprocessableEntity, Message: "order amount has too many decimal places for its currency"}
+	ErrPaymentNotFound                 = &Error{Code: "PAYMENT_NOT_FOUND", HTTPStatus: http.StatusNotFound, Message: "payment transaction not found"}
+	ErrPaymentNotRefundable            = &Error{Code: "PAYMENT_NOT_REFUNDABLE", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment transaction is not refundable"}
+	ErrInvalidRefundAmount             = &Error{Code: "INVALID_REFUND_AMOUNT", HTTPStatus: http.StatusUnprocessableEntity, Message: "invalid refund amount"}
+	ErrRefundExceedsAmount             = &Error{Code: "REFUND_EXCEEDS_AMOUNT", HTTPStatus: http.StatusUnprocessableEntity, Message: "refund amount exceeds remaining amount"}
+	ErrMerchantAmountNotEnough         = &Error{Code: "MERCHANT_AMOUNT_NOT_ENOUGH", HTTPStatus: http.StatusUnprocessableEntity, Message: "merchant amount is not enough"}
+	ErrInvalidCurrency                 = &Error{Code: "INVALID_CURRENCY", HTTPStatus: http.StatusUnprocessableEntity, Message: "invalid currency"}
+	ErrCurrencyMismatch                = &Error{Code: "CURRENCY_MISMATCH", HTTPStatus: http.StatusUnprocessableEntity, Message: "currency does not match merchant or order currency"}
+	ErrExchangeRateUnavailable         = &Error{Code: "EXCHANGE_RATE_UNAVAILABLE", HTTPStatus: http.StatusServiceUnavailable, Message: "exchange rate is unavailable", Retryable: true}
+	ErrPaymentDeclined                 = &Error{Code: "PAYMENT_DECLINED", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment was declined by the channel"}
+	ErrInvalidPromptPayID              = &Error{Code: "INVALID_PROMPTPAY_ID", HTTPStatus: http.StatusUnprocessableEntity, Message: "promptpay id must be a phone number, tax id or e-wallet id"}
+	ErrMerchantPromptPayNotConfigured  = &Error{Code: "MERCHANT_PROMPTPAY_NOT_CONFIGURED", HTTPStatus: http.StatusUnprocessableEntity, Message: "merchant cannot receive payments through this channel"}
+	ErrPaymentNotPending               = &Error{Code: "PAYMENT_NOT_PENDING", HTTPStatus: http.StatusConflict, Message: "payment transaction is not pending"}
+	ErrPaymentExpired                  = &Error{Code: "PAYMENT_EXPIRED", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment was not completed in time"}
+	ErrPaymentNotAuthorized            = &Error{Code: "PAYMENT_NOT_AUTHORIZED", HTTPStatus: http.StatusConflict, Message: "payment transaction is not authorized"}
+	ErrInvalidCaptureAmount            = &Error{Code: "INVALID_CAPTURE_AMOUNT", HTTPStatus: http.StatusUnprocessableEntity, Message: "capture amount must not be negative"}
+	ErrCaptureExceedsAuthorized        = &Error{Code: "CAPTURE_EXCEEDS_AUTHORIZED", HTTPStatus: http.StatusUnprocessableEntity, Message: "capture amount exceeds authorized amount"}
+	ErrPartialCaptureNotSupported      = &Error{Code: "PARTIAL_CAPTURE_NOT_SUPPORTED", HTTPStatus: http.StatusUnprocessableEntity, Message: "payment channel does not support partial capture"}
+	ErrAuthorizationExpired            = &Error{Code: "AUTHORIZATION_EXPIRED", HTTPStatus: http.StatusUnprocessableEntity, Message: "authorization expired"}
+	ErrAuthorizationNotFound           = &Error{Code: "AUTHORIZATION_NOT_FOUND", HTTPStatus: http.StatusConflict, Message: "authorization is not known to the payment channel"}
+	ErrAmountOutOfRange                = &Error{Code: "AMOUNT_OUT_OF_RANGE", HTTPStatus: http.StatusUnprocessableEntity, Message: "amount is out of range"}
+	ErrInvalidCursor                   = &Error{Code: "INVALID_CURSOR", HTTPStatus: http.StatusBadRequest, Message: "invalid cursor"}
+	ErrInvalidSignature                = &Error{Code: "INVALID_SIGNATURE", HTTPStatus: http.StatusUnauthorized, Message: "invalid webhook signature"}
+	ErrInvalidSettlementWindow         = &Error{Code: "INVALID_SETTLEMENT_WINDOW", HTTPStatus: http.StatusUnprocessableEntity, Message: "settlement window must end after it starts"}
+	ErrIdempotencyKeyInvalid           = &Error{Code: "IDEMPOTENCY_KEY_INVALID", HTTPStatus: http.StatusBadRequest, Message: "idempotency key is invalid"}
+	ErrIdempotencyKeyReused            = &Error{Code: "IDEMPOTENCY_KEY_REUSED", HTTPStatus: http.StatusUnprocessableEntity, Message: "idempotency key was used with a different request"}
+	ErrIdempotencyKeyInProgress        = &Error{Code: "IDEMPOTENCY_KEY_IN_PROGRESS", HTTPStatus: http.StatusConflict, Message: "request with this idempotency key is in progress", Retryable: true}
+	ErrRequestTimeout                  = &Error{Code: "REQUEST_TIMEOUT", HTTPStatus: http.StatusGatewayTimeout, Message: "request timed out", Retryable: true}
+	ErrInternal                        = &Error{Code: "INTERNAL_ERROR", HTTPStatus: http.StatusInternalServerError, Message: "internal error", Retryable: true}
+)
+
+// fromStorageError translates storage sentinel errors into the catalogue and
+// leaves anything else untouched, gorm.ErrRecordNotFound included: only the
+// caller knows which record was not found.
+func fromStorageError(err error) error {
+	var te *constant.OrderTransitionError
+	switch {
+	case errors.As(err, &te):
+		return ErrOrderIllegalTransition
+	case errors.Is(err, storage.ErrOrderStatusChanged):
+		return ErrOrderStatusChanged
+	case errors.Is(err, storage.ErrOrderAmountInvalid):
+		return ErrOrderAmountInvalid
+	case errors.Is(err, storage.ErrOrderNotRequestPayment):
+		return ErrOrderNotRequestPayment
+	case errors.Is(err, storage.ErrCustomerAmountNotEnough):
+		return ErrCustomerAmountNotEnough
+	case errors.Is(err, storage.ErrMerchantNotActive):
+		return ErrMerchantNotActive
+	case errors.Is(err, storage.ErrPaymentExceedsOutstanding):
+		return ErrPaymentAmountExceedsOutstanding
+	case errors.Is(err, storage.ErrMerchantAmountNotEnough):
+		return ErrMerchantAmountNotEnough
+	case errors.Is(err, storage.ErrPaymentNotRefundable):
+		return ErrPaymentNotRefundable
+	case errors.Is(err, storage.ErrRefundExceedsAmount):
+		return ErrRefundExceedsAmount
+	case errors.Is(err, storage.ErrCurrencyMismatch):
+		return ErrCurrencyMismatch
+	case errors.Is(err, storage.ErrPaymentNotPending):
+		return ErrPaymentNotPending
+	case errors.Is(err, storage.ErrPaymentNotAuthorized):
+		return ErrPaymentNotAuthorized
+	case errors.Is(err, storage.ErrHoldExpired):
+		return ErrAuthorizationExpired
+	case errors.Is(err, money.ErrAmountOverflow):
+		return ErrAmountOutOfRange
+	default:
+		return err
+	}
+}
+
+// fromChannelError translates channel provider errors into the catalogue and
+// leaves anything else untouched.
+func fromChannelError(err error) error {
+	var pe *channel.ProviderNotFoundError
+	switch {
+	case errors.As(err, &pe):
+		return ErrInvalidPaymentChannel
+	case errors.Is(err, channel.ErrDeclined):
+		return ErrPaymentDeclined
+	case errors.Is(err, channel.ErrCaptureExceedsAuthorized):
+		return ErrCaptureExceedsAuthorized
+	case errors.Is(err, channel.ErrPartialCaptureNotSupported):
+		return ErrPartialCaptureNotSupported
+	case errors.Is(err, channel.ErrAuthorizationNotCapturable), errors.Is(err, channel.ErrAuthorizationNotVoidable):
+		return ErrPaymentNotAuthorized
+	case errors.Is(err, channel.ErrAuthorizationNotFound):
+		return ErrAuthorizationNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+)
+
+type LedgerDriftResponse struct {
+	AccountType   constant.LedgerAccountType `json:"accountType"`
+	OwnerID       uint                       `json:"ownerID"`
+	Currency      money.Currency             `json:"currency"`
+	ProfileAmount money.Amount               `json:"profileAmount"`
+	LedgerAmount  money.Amount               `json:"ledgerAmount"`
+}
+
+// LedgerReport lists what does not reconcile. An empty report means every
+// balance matches the ledger.
+type LedgerReport struct {
+	Drifts            []LedgerDriftResponse `json:"drifts"`
+	UnbalancedEntries []uint                `json:"unbalancedEntries"`
+}
+
+type LedgerService interface {
+	OpenAccounts(ctx context.Context) (int, error)
+	Reconcile(ctx context.Context) (*LedgerReport, error)
+}
+
+type ledgerService struct {
+	l storage.LedgerStorage
+	c clock.Clock
+}
+
+func NewLedgerService(l storage.LedgerStorage, c clock.Clock) LedgerService {
+	return &ledgerService{
+		l: l,
+		c: c,
+	}
+}
+
+// OpenAccounts brings balances from before the ledger existed into it. It is
+// meant to run once before payments are taken; running it later would hide
+// a balance changed behind the ledger's back instead of reporting it, so the
+// server never runs it and payment migrate open-accounts does.
+func (s *ledgerService) OpenAccounts(ctx context.Context) (int, error) {
+	return s.l.OpenAccounts(ctx, s.c.Now())
+}
+
+// Reconcile compares every customer and merchant balance with its ledger
+// balance and checks that every journal entry balances.
+func (s *ledgerService) Reconcile(ctx context.Context) (*LedgerReport, error) {
+	drifts, err := s.l.ListDrifts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unbalanced, err := s.l.ListUnbalancedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &LedgerReport{
+		Drifts:            make([]LedgerDriftResponse, 0, len(drifts)),
+		UnbalancedEntries: unbalanced,
+	}
+	for _, d := range drifts {
+		r.Drifts = append(r.Drifts, LedgerDriftResponse{
+			AccountType:   d.AccountType,
+			OwnerID:       d.OwnerID,
+			Currency:      d.Currency,
+			ProfileAmount: d.ProfileAmount,
+			LedgerAmount:  d.LedgerAmount,
+		})
+	}
+	return r, nil
+}
@@ -0,0 +1,113 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLedgerStorage struct {
+	Opened     []time.Time
+	drifts     []storage.LedgerDrift
+	unbalanced []uint
+	err        error
+}
+
+func (m *mockLedgerStorage) SetDrifts(drifts []storage.LedgerDrift, unbalanced []uint, err error) {
+	m.drifts = drifts
+	m.unbalanced = unbalanced
+	m.err = err
+}
+
+func (m *mockLedgerStorage) OpenAccounts(ctx context.Context, at time.Time) (int, error) {
+	m.Opened = append(m.Opened, at)
+	return 2, m.err
+}
+
+func (m *mockLedgerStorage) ListDrifts(ctx context.Context) ([]storage.LedgerDrift, error) {
+	return m.drifts, m.err
+}
+
+func (m *mockLedgerStorage) ListUnbalancedEntries(ctx context.Context) ([]uint, error) {
+	return m.unbalanced, m.err
+}
+
+func TestLedgerService(t *testing.T) {
+	var s LedgerService
+	var ml *mockLedgerStorage
+	var mt *mockClock
+
+	setup := func() {
+		ml = &mockLedgerStorage{}
+		mt = &mockClock{}
+		mt.SetNow(time.Now().UTC())
+		s = NewLedgerService(ml, mt)
+	}
+
+	t.Run("open accounts should open at current time", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.OpenAccounts(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, actual)
+		assert.Equal(t, []time.Time{mt.t}, ml.Opened)
+	})
+
+	t.Run("reconcile should report drifts and unbalanced entries", func(t *testing.T) {
+		//Arrange
+		setup()
+		ml.SetDrifts([]storage.LedgerDrift{
+			{AccountType: constant.LedgerAccountTypeCustomer, OwnerID: 3, Currency: money.THB, ProfileAmount: money.MustFromInt(500), LedgerAmount: money.MustFromInt(400)},
+		}, []uint{9}, nil)
+
+		//Action
+		actual, err := s.Reconcile(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, &LedgerReport{
+			Drifts: []LedgerDriftResponse{
+				{AccountType: constant.LedgerAccountTypeCustomer, OwnerID: 3, Currency: money.THB, ProfileAmount: money.MustFromInt(500), LedgerAmount: money.MustFromInt(400)},
+			},
+			UnbalancedEntries: []uint{9},
+		}, actual)
+	})
+
+	t.Run("reconcile without drift should return empty report", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Reconcile(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(actual.Drifts))
+		assert.Equal(t, 0, len(actual.UnbalancedEntries))
+	})
+
+	t.Run("reconcile storage failure should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		ml.SetDrifts(nil, nil, errors.New("unknown error"))
+
+		//Action
+		_, err := s.Reconcile(context.Background())
+
+		//Assert
+		assert.Equal(t, errors.New("unknown error"), err)
+	})
+}
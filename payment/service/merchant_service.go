@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/promptpay"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+type RequestCreateMerchant struct {
+	Name        string         `json:"name"`
+	Currency    money.Currency `json:"currency"`
+	PromptPayID string         `json:"promptPayID"`
+}
+
+type RequestUpdateMerchantStatus struct {
+	Status constant.MerchantStatus `json:"status"`
+}
+
+type MerchantResponse struct {
+	ID          uint                    `json:"id"`
+	Name        string                  `json:"name"`
+	Status      constant.MerchantStatus `json:"status"`
+	Amount      money.Amount            `json:"amount"`
+	Currency    money.Currency          `json:"currency"`
+	PromptPayID string                  `json:"promptPayID,omitempty"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	UpdatedAt   time.Time               `json:"updatedAt"`
+}
+
+type MerchantService interface {
+	CreateMerchant(ctx context.Context, r RequestCreateMerchant) (*MerchantResponse, error)
+	GetMerchant(ctx context.Context, id uint) (*MerchantResponse, error)
+	ListMerchants(ctx context.Context, r RequestPage) (*PageResponse[MerchantResponse], error)
+	UpdateMerchantStatus(ctx context.Context, id uint, r RequestUpdateMerchantStatus) (*MerchantResponse, error)
+	TopUpMerchant(ctx context.Context, id uint, r RequestTopUp) (*MerchantResponse, error)
+}
+
+type merchantService struct {
+	ms storage.MerchantStorage
+}
+
+func NewMerchantService(ms storage.MerchantStorage) MerchantService {
+	return &merchantService{
+		ms: ms,
+	}
+}
+
+func toMerchantResponse(m *storage.MerchantProfile) *MerchantResponse {
+	return &MerchantResponse{
+		ID:          m.ID,
+		Name:        m.Name,
+		Status:      m.Status,
+		Amount:      m.Amount,
+		Currency:    m.Currency,
+		PromptPayID: m.PromptPayID,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
+
+func fromMerchantStorageError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMerchantNotFound
+	}
+	return err
+}
+
+func (s *merchantService) CreateMerchant(ctx context.Context, r RequestCreateMerchant) (*MerchantResponse, error) {
+	if r.Name == "" || len(r.Name) > 100 {
+		return nil, ErrInvalidName
+	}
+	if r.Currency == "" {
+		r.Currency = money.DefaultCurrency
+	}
+	if !money.IsValidCurrency(r.Currency) {
+		return nil, ErrInvalidCurrency
+	}
+	if r.PromptPayID != "" {
+		if _, _, err := promptpay.ParseTarget(r.PromptPayID); err != nil {
+			return nil, ErrInvalidPromptPayID
+		}
+	}
+	m := &storage.MerchantProfile{
+		Name:        r.Name,
+		Status:      constant.MerchantStatusActive,
+		Currency:    r.Currency,
+		PromptPayID: r.PromptPayID,
+	}
+	if err := s.ms.CreateMerchant(ctx, m); err != nil {
+		return nil, err
+	}
+	return toMerchantResponse(m), nil
+}
+
+func (s *merchantService) GetMerchant(ctx context.Context, id uint) (*MerchantResponse, error) {
+	m, err := s.ms.GetMerchant(ctx, id)
+	if err != nil {
+		return nil, fromMerchantStorageError(err)
+	}
+	return toMerchantResponse(m), nil
+}
+
+func (s *merchantService) ListMerchants(ctx context.Context, r RequestPage) (*PageResponse[MerchantResponse], error) {
+	r = r.normalize()
+	m, total, err := s.ms.ListMerchants(ctx, r.offset(), r.Size)
+	if err != nil {
+		return nil, err
+	}
+	res := &PageResponse[MerchantResponse]{
+		Items: []MerchantResponse{},
+		Page:  r.Page,
+		Size:  r.Size,
+		Total: total,
+	}
+	for i := range m {
+		res.Items = append(res.Items, *toMerchantResponse(&m[i]))
+	}
+	return res, nil
+}
+
+func (s *merchantService) UpdateMerchantStatus(ctx context.Context, id uint, r RequestUpdateMerchantStatus) (*MerchantResponse, error) {
+	if !constant.IsValidMerchantStatus(r.Status) {
+		return nil, ErrInvalidMerchantStatus
+	}
+	if err := s.ms.UpdateMerchantStatus(ctx, id, r.Status); err != nil {
+		return nil, fromMerchantStorageError(err)
+	}
+	return s.GetMerchant(ctx, id)
+}
+
+func (s *merchantService) TopUpMerchant(ctx context.Context, id uint, r RequestTopUp) (*MerchantResponse, error) {
+	if !r.Amount.IsPositive() {
+		return nil, ErrInvalidTopUpAmount
+	}
+	m, err := s.ms.TopUpMerchant(ctx, id, r.Amount)
+	if err != nil {
+		return nil, fromMerchantStorageError(err)
+	}
+	return toMerchantResponse(m), nil
+}
@@ -0,0 +1,122 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type mockMerchantStorage struct {
+	m        *storage.MerchantProfile
+	err      error
+	Created  []*storage.MerchantProfile
+	Statuses []constant.MerchantStatus
+}
+
+func (m *mockMerchantStorage) SetMerchant(mp *storage.MerchantProfile, err error) {
+	m.m = mp
+	m.err = err
+}
+
+func (m *mockMerchantStorage) GetMerchant(ctx context.Context, id uint) (*storage.MerchantProfile, error) {
+	return m.m, m.err
+}
+
+func (m *mockMerchantStorage) ListMerchants(ctx context.Context, offset, limit int) ([]storage.MerchantProfile, int64, error) {
+	return nil, 0, m.err
+}
+
+func (m *mockMerchantStorage) CreateMerchant(ctx context.Context, mp *storage.MerchantProfile) error {
+	m.Created = append(m.Created, mp)
+	return m.err
+}
+
+func (m *mockMerchantStorage) UpdateMerchantStatus(ctx context.Context, id uint, status constant.MerchantStatus) error {
+	m.Statuses = append(m.Statuses, status)
+	return m.err
+}
+
+func (m *mockMerchantStorage) TopUpMerchant(ctx context.Context, id uint, amount money.Amount) (*storage.MerchantProfile, error) {
+	return m.m, m.err
+}
+
+func TestMerchantService(t *testing.T) {
+	var s MerchantService
+	var m *mockMerchantStorage
+
+	setup := func() {
+		m = &mockMerchantStorage{}
+		m.SetMerchant(&storage.MerchantProfile{Model: gorm.Model{ID: 1}, Name: "Rabit Cart", Status: constant.MerchantStatusActive}, nil)
+		s = NewMerchantService(m)
+	}
+
+	t.Run("create merchant should create active merchant", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CreateMerchant(context.Background(), RequestCreateMerchant{Name: "Rabit Cart"})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.MerchantStatusActive, actual.Status)
+		assert.Equal(t, 1, len(m.Created))
+	})
+
+	t.Run("create merchant with promptpay id should keep it", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CreateMerchant(context.Background(), RequestCreateMerchant{Name: "Rabit Cart", PromptPayID: "0812345678"})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, "0812345678", actual.PromptPayID)
+		assert.Equal(t, "0812345678", m.Created[0].PromptPayID)
+	})
+
+	t.Run("create merchant with invalid promptpay id should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.CreateMerchant(context.Background(), RequestCreateMerchant{Name: "Rabit Cart", PromptPayID: "12345"})
+
+		//Assert
+		assert.Equal(t, ErrInvalidPromptPayID, err)
+		assert.Equal(t, 0, len(m.Created))
+	})
+
+	t.Run("suspend merchant should update status", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.UpdateMerchantStatus(context.Background(), 1, RequestUpdateMerchantStatus{Status: constant.MerchantStatusSuspend})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []constant.MerchantStatus{constant.MerchantStatusSuspend}, m.Statuses)
+	})
+
+	t.Run("update status of unknown merchant should return merchant not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		m.SetMerchant(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.UpdateMerchantStatus(context.Background(), 9, RequestUpdateMerchantStatus{Status: constant.MerchantStatusSuspend})
+
+		//Assert
+		assert.Equal(t, ErrMerchantNotFound, err)
+	})
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+type RequestCreateOrder struct {
+	CustomerID uint           `json:"customerID"`
+	MerchantID uint           `json:"merchantID"`
+	Amount     money.Amount   `json:"amount"`
+	Currency   money.Currency `json:"currency"`
+}
+
+type OrderResponse struct {
+	ID         uint                 `json:"id"`
+	CustomerID uint                 `json:"customerID"`
+	MerchantID uint                 `json:"merchantID"`
+	Amount     money.Amount         `json:"amount"`
+	Currency   money.Currency       `json:"currency"`
+	Status     constant.OrderStatus `json:"status"`
+	CreatedAt  time.Time            `json:"createdAt"`
+	UpdatedAt  time.Time            `json:"updatedAt"`
+}
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, r RequestCreateOrder) (*OrderResponse, error)
+	GetOrder(ctx context.Context, id uint) (*OrderResponse, error)
+	RequestPayment(ctx context.Context, id uint) (*OrderResponse, error)
+}
+
+type orderService struct {
+	o  storage.OrderStorage
+	cs storage.CustomerStorage
+	ms storage.MerchantStorage
+	c  clock.Clock
+}
+
+func NewOrderService(o storage.OrderStorage, cs storage.CustomerStorage, ms storage.MerchantStorage, c clock.Clock) OrderService {
+	return &orderService{
+		o:  o,
+		cs: cs,
+		ms: ms,
+		c:  c,
+	}
+}
+
+func toOrderResponse(o *storage.Order) *OrderResponse {
+	return &OrderResponse{
+		ID:         o.ID,
+		CustomerID: o.CustomerID,
+		MerchantID: o.MerchantID,
+		Amount:     o.Amount,
+		Currency:   o.Currency,
+		Status:     o.Status,
+		CreatedAt:  o.CreatedAt,
+		UpdatedAt:  o.UpdatedAt,
+	}
+}
+
+// validateCreateOrder also defaults the order currency to the merchant's,
+// which is the only currency the merchant can be paid in.
+func (s *orderService) validateCreateOrder(ctx context.Context, r *RequestCreateOrder) error {
+	if !r.Amount.IsPositive() {
+		return ErrOrderAmountInvalid
+	}
+	c, err := s.cs.GetCustomer(ctx, r.CustomerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCustomerNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !constant.IsActiveCustomer(c.Status) {
+		return ErrCustomerNotActive
+	}
+	m, err := s.ms.GetMerchant(ctx, r.MerchantID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMerchantNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !constant.IsActiveMerchant(m.Status) {
+		return ErrMerchantNotActive
+	}
+	if r.Currency == "" {
+		r.Currency = m.Currency
+	}
+	if !money.IsValidCurrency(r.Currency) {
+		return ErrInvalidCurrency
+	}
+	if r.Currency != m.Currency {
+		return ErrCurrencyMismatch
+	}
+	if !r.Amount.HasPrecision(r.Currency.Precision()) {
+		return ErrOrderAmountPrecision
+	}
+	return nil
+}
+
+func (s *orderService) CreateOrder(ctx context.Context, r RequestCreateOrder) (*OrderResponse, error) {
+	if err := s.validateCreateOrder(ctx, &r); err != nil {
+		return nil, err
+	}
+	n := s.c.Now()
+	o := &storage.Order{
+		Model: gorm.Model{
+			CreatedAt: n,
+			UpdatedAt: n,
+		},
+		CustomerID: r.CustomerID,
+		MerchantID: r.MerchantID,
+		Amount:     r.Amount,
+		Currency:   r.Currency,
+		Status:     constant.OrderStatusOpen,
+	}
+	if err := s.o.Save(ctx, o); err != nil {
+		return nil, fromStorageError(err)
+	}
+	return toOrderResponse(o), nil
+}
+
+func (s *orderService) GetOrder(ctx context.Context, id uint) (*OrderResponse, error) {
+	o, err := s.o.GetOrder(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toOrderResponse(o), nil
+}
+
+func (s *orderService) RequestPayment(ctx context.Context, id uint) (*OrderResponse, error) {
+	err := s.o.Transit(ctx, id, constant.OrderStatusRequestPayment, "payment requested")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fromStorageError(err)
+	}
+	return s.GetOrder(ctx, id)
+}
@@ -0,0 +1,142 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOrderService(t *testing.T) {
+	var s OrderService
+	var mo *mockOrderStorage
+	var mc *mockCustomerStorage
+	var mm *mockMerchantStorage
+	var mt *mockClock
+	var r RequestCreateOrder
+
+	setup := func() {
+		mo = &mockOrderStorage{}
+		mc = &mockCustomerStorage{}
+		mm = &mockMerchantStorage{}
+		mt = &mockClock{}
+		mt.SetNow(time.Now().UTC())
+		mc.SetCustomer(&storage.CustomerProfile{Model: gorm.Model{ID: 1}, Status: constant.CustomerStatusActive}, nil)
+		mm.SetMerchant(&storage.MerchantProfile{Model: gorm.Model{ID: 2}, Status: constant.MerchantStatusActive, Currency: money.THB}, nil)
+		s = NewOrderService(mo, mc, mm, mt)
+		r = RequestCreateOrder{CustomerID: 1, MerchantID: 2, Amount: money.MustFromInt(1200)}
+	}
+
+	t.Run("create order should save open order", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CreateOrder(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, &OrderResponse{
+			CustomerID: 1,
+			MerchantID: 2,
+			Amount:     money.MustFromInt(1200),
+			Currency:   money.THB,
+			Status:     constant.OrderStatusOpen,
+			CreatedAt:  mt.t,
+			UpdatedAt:  mt.t,
+		}, actual)
+		assert.Equal(t, 1, len(mo.Saved))
+		assert.Equal(t, uint(1), mo.Saved[0].CustomerID)
+		assert.Equal(t, uint(2), mo.Saved[0].MerchantID)
+	})
+
+	t.Run("create order invalid should return error and not save when", func(t *testing.T) {
+		data := []struct {
+			name     string
+			arrange  func()
+			expected error
+		}{
+			{"amount is zero", func() { r.Amount = money.MustFromInt(0) }, ErrOrderAmountInvalid},
+			{"customer not found", func() { mc.SetCustomer(nil, gorm.ErrRecordNotFound) }, ErrCustomerNotFound},
+			{"customer not active", func() { mc.c.Status = constant.CustomerStatusInActive }, ErrCustomerNotActive},
+			{"merchant not found", func() { mm.SetMerchant(nil, gorm.ErrRecordNotFound) }, ErrMerchantNotFound},
+			{"merchant suspended", func() { mm.m.Status = constant.MerchantStatusSuspend }, ErrMerchantNotActive},
+			{"currency unknown", func() { r.Currency = "XXX" }, ErrInvalidCurrency},
+			{"currency differs from merchant", func() { r.Currency = money.USD }, ErrCurrencyMismatch},
+			{"amount has more decimals than currency", func() { mm.m.Currency = money.JPY; r.Amount = money.MustParse("1200.5") }, ErrOrderAmountPrecision},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+				v.arrange()
+
+				//Action
+				_, err := s.CreateOrder(context.Background(), r)
+
+				//Assert
+				assert.Equal(t, v.expected, err)
+				assert.Equal(t, 0, len(mo.Saved))
+			})
+		}
+	})
+
+	t.Run("get order not found should return order not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetOrder(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.GetOrder(context.Background(), 1)
+
+		//Assert
+		assert.Equal(t, ErrOrderNotFound, err)
+	})
+
+	t.Run("request payment should transit order to request payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetOrder(&storage.Order{Model: gorm.Model{ID: 1}, Amount: money.MustFromInt(1200), Status: constant.OrderStatusRequestPayment}, nil)
+
+		//Action
+		actual, err := s.RequestPayment(context.Background(), 1)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []constant.OrderStatus{constant.OrderStatusRequestPayment}, mo.Transitions)
+		assert.Equal(t, constant.OrderStatusRequestPayment, actual.Status)
+	})
+
+	t.Run("request payment illegal transition should return illegal transition", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetOrder(nil, &constant.OrderTransitionError{From: constant.OrderStatusConfirm, To: constant.OrderStatusRequestPayment})
+
+		//Action
+		_, err := s.RequestPayment(context.Background(), 1)
+
+		//Assert
+		assert.Equal(t, ErrOrderIllegalTransition, err)
+	})
+
+	t.Run("create order save fail should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetOrder(nil, errors.New("unknown error"))
+
+		//Action
+		_, err := s.CreateOrder(context.Background(), r)
+
+		//Assert
+		assert.EqualError(t, err, "unknown error")
+	})
+}
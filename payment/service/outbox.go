@@ -0,0 +1,23 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+)
+
+func newOutbox(topic, key string, message any, n time.Time) (*storage.Outbox, error) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Outbox{
+		Topic:         topic,
+		Key:           key,
+		Payload:       string(b),
+		Status:        constant.OutboxStatusPending,
+		NextAttemptAt: n,
+	}, nil
+}
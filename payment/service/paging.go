@@ -0,0 +1,44 @@
+package service
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type RequestPage struct {
+	Page int `json:"page"`
+	Size int `json:"size"`
+}
+
+type PageResponse[T any] struct {
+	Items []T   `json:"items"`
+	Page  int   `json:"page"`
+	Size  int   `json:"size"`
+	Total int64 `json:"total"`
+}
+
+// CursorPageResponse is a page of a list that is read by following
+// NextCursor until it is empty.
+type CursorPageResponse[T any] struct {
+	Items      []T    `json:"items"`
+	Size       int    `json:"size"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// normalize fills in defaults and caps the page size.
+func (r RequestPage) normalize() RequestPage {
+	if r.Page < 1 {
+		r.Page = 1
+	}
+	if r.Size < 1 {
+		r.Size = defaultPageSize
+	}
+	if r.Size > maxPageSize {
+		r.Size = maxPageSize
+	}
+	return r
+}
+
+func (r RequestPage) offset() int {
+	return (r.Page - 1) * r.Size
+}
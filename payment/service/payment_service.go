@@ -1,13 +1,19 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"log"
 	"strconv"
 	"time"
 
+	"github.com/kaweel/workshop-tdd/payment/channel"
 	"github.com/kaweel/workshop-tdd/payment/clock"
 	"github.com/kaweel/workshop-tdd/payment/constant"
-	"github.com/kaweel/workshop-tdd/payment/messaging"
+	"github.com/kaweel/workshop-tdd/payment/fee"
+	"github.com/kaweel/workshop-tdd/payment/fx"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/promptpay"
 	"gorm.io/gorm"
 
 	"github.com/kaweel/workshop-tdd/payment/storage"
@@ -16,106 +22,469 @@ import (
 type RequestPayment struct {
 	OrderID uint                    `json:"orderID"`
 	Channel constant.PaymentChannel `json:"channel"`
-	Amount  float64                 `json:"amount"`
+	Amount  money.Amount            `json:"amount"`
 }
 
 type Service interface {
-	Payment(r RequestPayment) error
+	Payment(ctx context.Context, r RequestPayment) (*PaymentResponse, error)
+	PaymentQR(ctx context.Context, orderID uint) (*PaymentResponse, error)
+	CompletePayment(ctx context.Context, r RequestCompletePayment) (*PaymentResponse, error)
+	ExpirePending(ctx context.Context, before time.Time, limit int) (int, error)
+	Capture(ctx context.Context, r RequestCapture) (*PaymentResponse, error)
+	Void(ctx context.Context, paymentID uint) (*PaymentResponse, error)
+	ExpireAuthorizations(ctx context.Context, now time.Time, limit int) (int, error)
+	Refund(ctx context.Context, r RequestRefund) (*RefundMessage, error)
+	GetPayment(ctx context.Context, id uint) (*PaymentTransactionResponse, error)
+	ListOrderPayments(ctx context.Context, orderID uint) ([]PaymentTransactionResponse, error)
+	ListPayments(ctx context.Context, r RequestListPayments) (*CursorPageResponse[PaymentTransactionResponse], error)
+}
+
+type PaymentConfig struct {
+	AmountPolicy constant.PaymentAmountPolicy
+	// Precision is the number of decimal places an amount may carry.
+	Precision int
+	// HoldExpiry is how long an authorization holds the customer's amount
+	// before it is voided unless captured.
+	HoldExpiry time.Duration
+	// Fees are charged to the merchant on every confirmed payment.
+	Fees fee.Schedule
+}
+
+func (c PaymentConfig) withDefaults() PaymentConfig {
+	if c.AmountPolicy == "" {
+		c.AmountPolicy = constant.PaymentAmountPolicyExact
+	}
+	if c.Precision == 0 {
+		c.Precision = 2
+	}
+	if c.HoldExpiry == 0 {
+		c.HoldExpiry = 7 * 24 * time.Hour
+	}
+	return c
 }
 
 type service struct {
-	o storage.OrderStorage
-	p storage.PaymentTranasctionStorage
-	m messaging.KafkaProducer
-	c clock.Clock
+	o   storage.OrderStorage
+	p   storage.PaymentTranasctionStorage
+	c   clock.Clock
+	fx  fx.RateProvider
+	ch  channel.Registry
+	cfg PaymentConfig
 }
 
-func NewService(o storage.OrderStorage, p storage.PaymentTranasctionStorage, m messaging.KafkaProducer, c clock.Clock) Service {
+func NewService(o storage.OrderStorage, p storage.PaymentTranasctionStorage, c clock.Clock, r fx.RateProvider, ch channel.Registry, cfg PaymentConfig) Service {
 	return &service{
-		o: o,
-		p: p,
-		m: m,
-		c: c,
+		o:   o,
+		p:   p,
+		c:   c,
+		fx:  r,
+		ch:  ch,
+		cfg: cfg.withDefaults(),
 	}
 }
 
 type PaymentMessage struct {
-	OrderID   uint                              `json:"orderID"`
-	Status    constant.PaymentTranasctionStatus `json:"status"`
-	Amount    float64                           `json:"amount"`
-	Reason    string                            `json:"reason"`
-	CreatedAt time.Time                         `json:"createdAt"`
+	OrderID         uint                              `json:"orderID"`
+	Status          constant.PaymentTranasctionStatus `json:"status"`
+	Amount          money.Amount                      `json:"amount"`
+	Currency        money.Currency                    `json:"currency"`
+	SettledAmount   money.Amount                      `json:"settledAmount"`
+	SettledCurrency money.Currency                    `json:"settledCurrency"`
+	Rate            money.Rate                        `json:"rate"`
+	FeeAmount       money.Amount                      `json:"feeAmount"`
+	NetAmount       money.Amount                      `json:"netAmount"`
+	Reason          string                            `json:"reason"`
+	CreatedAt       time.Time                         `json:"createdAt"`
 }
 
-func validateOrderPayment(r RequestPayment, getOrderByID func(id uint) (*storage.Order, error)) error {
+type PaymentResponse struct {
+	TransactionID   uint                              `json:"transactionID"`
+	OrderID         uint                              `json:"orderID"`
+	Channel         constant.PaymentChannel           `json:"channel"`
+	Status          constant.PaymentTranasctionStatus `json:"status"`
+	Amount          money.Amount                      `json:"amount"`
+	Currency        money.Currency                    `json:"currency"`
+	SettledAmount   money.Amount                      `json:"settledAmount"`
+	SettledCurrency money.Currency                    `json:"settledCurrency"`
+	FeeAmount       money.Amount                      `json:"feeAmount"`
+	NetAmount       money.Amount                      `json:"netAmount"`
+	Reason          string                            `json:"reason,omitempty"`
+	QRPayload       string                            `json:"qrPayload,omitempty"`
+}
+
+func toPaymentResponse(t *storage.PaymentTranasction, qr string) *PaymentResponse {
+	return &PaymentResponse{
+		TransactionID:   t.ID,
+		OrderID:         t.OrderID,
+		Channel:         t.Channel,
+		Status:          t.Status,
+		Amount:          t.Amount,
+		Currency:        t.Currency,
+		SettledAmount:   t.SettledAmount,
+		SettledCurrency: t.SettledCurrency,
+		FeeAmount:       t.FeeAmount,
+		NetAmount:       t.NetAmount,
+		Reason:          t.Reason,
+		QRPayload:       qr,
+	}
+}
+
+func validatePaymentAmount(r RequestPayment, o *storage.Order, cfg PaymentConfig) error {
+	switch cfg.AmountPolicy {
+	case constant.PaymentAmountPolicyPartial:
+		if r.Amount.Cmp(o.Amount) > 0 {
+			return ErrPaymentAmountExceedsOutstanding
+		}
+	default:
+		if r.Amount != o.Amount {
+			return ErrPaymentAmountMismatch
+		}
+	}
+	return nil
+}
+
+// validateOrderPayment checks the payment against the order and fills t with
+// the order currency and the amount converted into the currency it settles
+// in: the customer wallet currency, or THB for QR payments which the customer
+// pays from their bank account instead of the wallet.
+func validateOrderPayment(ctx context.Context, r RequestPayment, t *storage.PaymentTranasction, cfg PaymentConfig, getOrderByID func(ctx context.Context, id uint) (*storage.Order, error), getRate func(from, to money.Currency) (money.Rate, error)) (*storage.Order, error) {
 	v := constant.IsValidPaymentChannel(r.Channel)
 	if !v {
-		return errors.New("invalid payment channel")
+		return nil, ErrInvalidPaymentChannel
+	}
+	if !r.Amount.IsPositive() {
+		return nil, ErrInvalidPaymentAmount
+	}
+	if !r.Amount.HasPrecision(cfg.Precision) {
+		return nil, ErrPaymentAmountPrecision
+	}
+	o, err := getOrderByID(ctx, r.OrderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
 	}
-	o, err := getOrderByID(r.OrderID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	v = constant.IsOrderRequestPayment(o.Status)
+	t.Currency = o.Currency
+	v = constant.CanTransitOrder(o.Status, constant.OrderStatusConfirm)
 	if !v {
-		return errors.New("order status is not request payment")
+		return nil, ErrOrderNotRequestPayment
+	}
+	if !r.Amount.HasPrecision(o.Currency.Precision()) {
+		return nil, ErrPaymentAmountPrecision
+	}
+	if err := validatePaymentAmount(r, o, cfg); err != nil {
+		return nil, err
 	}
 	v = constant.IsActiveCustomer(o.Customer.Status)
 	if !v {
-		return errors.New("customer status is not active")
+		return nil, ErrCustomerNotActive
+	}
+	qr := constant.IsQRPaymentChannel(r.Channel)
+	settle := o.Customer.Currency
+	if qr {
+		settle = money.THB
+	}
+	rate, err := getRate(o.Currency, settle)
+	if err != nil {
+		return nil, ErrExchangeRateUnavailable
+	}
+	t.Rate = rate
+	t.SettledCurrency = settle
+	t.SettledAmount, err = r.Amount.Convert(rate, settle)
+	if err != nil {
+		return nil, ErrAmountOutOfRange
 	}
-	if o.Customer.Amount < o.Amount {
-		return errors.New("customer amount is not enough")
+	if !t.SettledAmount.IsPositive() {
+		return nil, ErrInvalidPaymentAmount
+	}
+	if !qr {
+		available, err := o.Customer.Amount.Sub(o.Customer.HeldAmount)
+		if err != nil {
+			return nil, ErrAmountOutOfRange
+		}
+		if available.Cmp(t.SettledAmount) < 0 {
+			return nil, ErrCustomerAmountNotEnough
+		}
 	}
 	v = constant.IsActiveMerchant(o.Merchant.Status)
 	if !v {
-		return errors.New("merchant status is not active")
+		return nil, ErrMerchantNotActive
 	}
-	return nil
+	if qr {
+		if _, err := qrPayload(o, t); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
 }
 
-func (s *service) Payment(r RequestPayment) error {
+func (s *service) Payment(ctx context.Context, r RequestPayment) (*PaymentResponse, error) {
 	n := s.c.Now()
 	t := &storage.PaymentTranasction{
 		Model: gorm.Model{
 			UpdatedAt: n,
 		},
 		OrderID: r.OrderID,
+		Type:    constant.PaymentTranasctionTypePayment,
 		Amount:  r.Amount,
 		Channel: r.Channel,
 		Status:  constant.PaymentTranasctionStatusConfirm,
 	}
 
-	l := PaymentMessage{
-		OrderID:   r.OrderID,
-		Amount:    r.Amount,
-		CreatedAt: n,
-		Status:    constant.PaymentTranasctionStatusConfirm,
+	o, err := validateOrderPayment(ctx, r, t, s.cfg, s.o.GetOrder, s.fx.Rate)
+	if err == nil && constant.IsQRPaymentChannel(t.Channel) {
+		return s.pending(ctx, o, t, n)
+	}
+	if err == nil {
+		if constant.IsTwoPhasePaymentChannel(t.Channel) {
+			err = s.authorize(ctx, o, t, n)
+		} else {
+			err = s.confirm(ctx, o, t, n)
+		}
+		if err == nil {
+			return toPaymentResponse(t, ""), nil
+		}
+		// A concurrent change may have made the payment invalid after validation.
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = ErrOrderNotFound
+		}
+		err = fromStorageError(err)
 	}
 
-	u := messaging.RequestPublish{
-		Topic:   constant.KafkaTopicPaymentTransaction,
-		Key:     strconv.FormatUint(uint64(r.OrderID), 10),
-		Message: l,
+	var de *Error
+	if !errors.As(err, &de) {
+		return nil, err
+	}
+	// A rejected payment cannot be recorded against an order that is not there
+	if de == ErrOrderNotFound {
+		return nil, de
 	}
+	return nil, s.reject(ctx, t, de, n)
+}
 
-	validateOrderErr := validateOrderPayment(r, s.o.GetOrder)
-	if validateOrderErr != nil {
-		t.Status = constant.PaymentTranasctionStatusReject
-		t.Reason = validateOrderErr.Error()
-		l.Status = t.Status
-		l.Reason = t.Reason
-		u.Message = l
+// pending books a QR payment as pending and returns the QR payload the
+// customer scans. Nothing moves until the bank tells us the transfer arrived.
+func (s *service) pending(ctx context.Context, o *storage.Order, t *storage.PaymentTranasction, n time.Time) (*PaymentResponse, error) {
+	t.Status = constant.PaymentTranasctionStatusPending
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.p.Save(ctx, t, e); err != nil {
+		return nil, err
+	}
+	qr, err := qrPayload(o, t)
+	if err != nil {
+		return nil, err
 	}
+	return toPaymentResponse(t, qr), nil
+}
 
-	err := s.p.Save(t)
+// PaymentQR returns the QR payload of the order's latest pending payment.
+func (s *service) PaymentQR(ctx context.Context, orderID uint) (*PaymentResponse, error) {
+	t, err := s.p.GetPending(ctx, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
 	if err != nil {
+		return nil, err
+	}
+	o, err := s.o.GetOrder(ctx, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	qr, err := qrPayload(o, t)
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentResponse(t, qr), nil
+}
+
+// qrPayload builds the payload paying t to the order's merchant. PromptPay
+// transfers to the merchant's PromptPay ID; QR bill payments go to the biller
+// ID, which is the merchant's tax ID with a 00 suffix unless a full 15 digit
+// biller ID is configured, and carry the order and transaction as references.
+func qrPayload(o *storage.Order, t *storage.PaymentTranasction) (string, error) {
+	typ, id, err := promptpay.ParseTarget(o.Merchant.PromptPayID)
+	if err != nil {
+		return "", ErrMerchantPromptPayNotConfigured
+	}
+	ref := strconv.FormatUint(uint64(t.ID), 10)
+	switch {
+	case t.Channel == constant.PaymentChannelPromptPay:
+		return promptpay.Payload(o.Merchant.PromptPayID, t.SettledAmount, ref)
+	case typ == promptpay.TargetTaxID:
+		id += "00"
+	case typ != promptpay.TargetEWallet:
+		return "", ErrMerchantPromptPayNotConfigured
+	}
+	return promptpay.BillPaymentPayload(id, strconv.FormatUint(uint64(o.ID), 10), ref, t.SettledAmount)
+}
+
+// confirm authorizes the customer's amount with the channel, books the
+// payment and only then captures, so a failed booking releases the hold
+// instead of leaving money taken for a payment we never recorded.
+func (s *service) confirm(ctx context.Context, o *storage.Order, t *storage.PaymentTranasction, n time.Time) error {
+	if err := s.charge(ctx, o, t, n); err != nil {
 		return err
 	}
+	cp, a, err := s.authorizeChannel(ctx, o, t)
+	if err != nil {
+		return err
+	}
+
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return err
+	}
+	if err := s.p.Confirm(ctx, o, t, e); err != nil {
+		voidChannel(ctx, cp, a.ID)
+		return err
+	}
+	// The payment is already booked, so the capture goes ahead even if the
+	// request has given up meanwhile
+	if _, err := cp.Capture(context.WithoutCancel(ctx), a.ID, t.SettledAmount); err != nil {
+		// It must not turn into a rejection or an error a retry would pay again
+		// for. The capture is left to reconciliation.
+		s.reconcile(ctx, constant.ReconciliationKindCaptureFailed, t, err)
+	}
+	return nil
+}
 
-	if err = s.m.Publish(u); err != nil {
+// authorize holds the customer's amount for a two-phase payment which is
+// captured or voided later.
+func (s *service) authorize(ctx context.Context, o *storage.Order, t *storage.PaymentTranasction, n time.Time) error {
+	cp, a, err := s.authorizeChannel(ctx, o, t)
+	if err != nil {
 		return err
 	}
+	t.Status = constant.PaymentTranasctionStatusAuthorized
+	h := &storage.Hold{
+		Amount:    t.SettledAmount,
+		Currency:  t.SettledCurrency,
+		Status:    constant.HoldStatusHeld,
+		ExpiresAt: n.Add(s.cfg.HoldExpiry),
+	}
+
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return err
+	}
+	if err := s.p.Authorize(ctx, o, t, h, e); err != nil {
+		voidChannel(ctx, cp, a.ID)
+		return err
+	}
+	return nil
+}
+
+// charge works out the fee the merchant pays on t and the net amount it is
+// credited. Tiered fees are picked by the merchant's volume since the start
+// of the month, not counting t.
+func (s *service) charge(ctx context.Context, o *storage.Order, t *storage.PaymentTranasction, n time.Time) error {
+	t.FeeAmount = money.Amount{}
+	if r, ok := s.cfg.Fees.Rule(o.MerchantID, t.Channel); ok {
+		var volume money.Amount
+		if r.Tiered() {
+			v, err := s.p.MerchantVolume(ctx, o.MerchantID, time.Date(n.Year(), n.Month(), 1, 0, 0, 0, 0, n.Location()))
+			if err != nil {
+				return err
+			}
+			volume = v
+		}
+		f, err := r.Fee(t.Amount, t.Currency, volume)
+		if err != nil {
+			return ErrAmountOutOfRange
+		}
+		t.FeeAmount = f
+	}
+	net, err := t.Amount.Sub(t.FeeAmount)
+	if err != nil {
+		return ErrAmountOutOfRange
+	}
+	t.NetAmount = net
+	return nil
+}
 
-	return validateOrderErr
+func (s *service) authorizeChannel(ctx context.Context, o *storage.Order, t *storage.PaymentTranasction) (channel.ChannelProvider, *channel.Authorization, error) {
+	cp, err := s.ch.Provider(t.Channel)
+	if err != nil {
+		return nil, nil, fromChannelError(err)
+	}
+	a, err := cp.Authorize(ctx, channel.RequestAuthorize{
+		Reference: strconv.FormatUint(uint64(o.ID), 10),
+		Amount:    t.SettledAmount,
+		Currency:  t.SettledCurrency,
+	})
+	if err != nil {
+		return nil, nil, fromChannelError(err)
+	}
+	t.ProviderRef = a.ID
+	return cp, a, nil
+}
+
+// reconcile records that the channel and our books disagree about t because
+// of cause. Failing to record it leaves only the log line.
+func (s *service) reconcile(ctx context.Context, kind constant.ReconciliationKind, t *storage.PaymentTranasction, cause error) {
+	r := &storage.Reconciliation{
+		PaymentTranasctionID: t.ID,
+		Kind:                 kind,
+		Channel:              t.Channel,
+		ProviderRef:          t.ProviderRef,
+		Amount:               t.SettledAmount,
+		Currency:             t.SettledCurrency,
+		Reason:               cause.Error(),
+	}
+	if err := s.p.Reconcile(context.WithoutCancel(ctx), r); err != nil {
+		log.Printf("reconcile %s of payment %d: %v: %v", kind, t.ID, cause, err)
+	}
+}
+
+// voidChannel releases an authorization we no longer book. It runs even if
+// the request has given up, as nothing else would release it.
+func voidChannel(ctx context.Context, cp channel.ChannelProvider, id string) {
+	if _, err := cp.Void(context.WithoutCancel(ctx), id); err != nil {
+		log.Printf("void authorization %s: %v", id, err)
+	}
+}
+
+func (s *service) reject(ctx context.Context, t *storage.PaymentTranasction, reason *Error, n time.Time) error {
+	t.Status = constant.PaymentTranasctionStatusReject
+	t.Reason = reason.Message
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return err
+	}
+
+	err = s.p.Save(ctx, t, e)
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		// The request failed validation before the order was looked up and
+		// names an order that does not exist either
+		return reason
+	}
+	if err != nil {
+		return err
+	}
+
+	return reason
+}
+
+func newPaymentOutbox(t *storage.PaymentTranasction, n time.Time) (*storage.Outbox, error) {
+	l := PaymentMessage{
+		OrderID:         t.OrderID,
+		Status:          t.Status,
+		Amount:          t.Amount,
+		Currency:        t.Currency,
+		SettledAmount:   t.SettledAmount,
+		SettledCurrency: t.SettledCurrency,
+		Rate:            t.Rate,
+		FeeAmount:       t.FeeAmount,
+		NetAmount:       t.NetAmount,
+		Reason:          t.Reason,
+		CreatedAt:       n,
+	}
+	return newOutbox(constant.KafkaTopicPaymentTransaction, strconv.FormatUint(uint64(t.OrderID), 10), l, n)
 }
@@ -4,20 +4,27 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
+	"github.com/kaweel/workshop-tdd/payment/channel"
 	"github.com/kaweel/workshop-tdd/payment/constant"
-	"github.com/kaweel/workshop-tdd/payment/messaging"
+	"github.com/kaweel/workshop-tdd/payment/fee"
+	"github.com/kaweel/workshop-tdd/payment/fx"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"github.com/kaweel/workshop-tdd/payment/storage"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
 
 type mockOrderStorage struct {
-	o   *storage.Order
-	err error
+	o           *storage.Order
+	err         error
+	Saved       []*storage.Order
+	Transitions []constant.OrderStatus
 }
 
 func (m *mockOrderStorage) SetOrder(o *storage.Order, err error) {
@@ -25,40 +32,326 @@ func (m *mockOrderStorage) SetOrder(o *storage.Order, err error) {
 	m.err = err
 }
 
-func (m *mockOrderStorage) GetOrder(id uint) (*storage.Order, error) {
+func (m *mockOrderStorage) GetOrder(ctx context.Context, id uint) (*storage.Order, error) {
 	return m.o, m.err
 }
 
-func (m *mockOrderStorage) Save(o *storage.Order) error {
+func (m *mockOrderStorage) Save(ctx context.Context, o *storage.Order) error {
+	m.Saved = append(m.Saved, o)
 	return m.err
 }
 
+func (m *mockOrderStorage) Transit(ctx context.Context, id uint, to constant.OrderStatus, reason string) error {
+	m.Transitions = append(m.Transitions, to)
+	return m.err
+}
+
+func (m *mockOrderStorage) History(ctx context.Context, id uint) ([]storage.OrderStatusHistory, error) {
+	return nil, m.err
+}
+
 type mockPaymentTranasctionStorage struct {
-	Calls []*storage.PaymentTranasction
-	err   error
+	Calls      []*storage.PaymentTranasction
+	Events     []*storage.Outbox
+	Confirmed  []*storage.Order
+	Rejected   []*storage.PaymentTranasction
+	Holds      []*storage.Hold
+	Captured   []*storage.PaymentTranasction
+	Voided     []*storage.PaymentTranasction
+	Now        []time.Time
+	expiredAt  []storage.PaymentTranasction
+	voidErr    error
+	Filters    []listCall
+	listed     []storage.PaymentTranasction
+	Before     []time.Time
+	Since      []time.Time
+	volume     money.Amount
+	pending    *storage.PaymentTranasction
+	byID       *storage.PaymentTranasction
+	byIDQueue  []*storage.PaymentTranasction
+	expired    []storage.PaymentTranasction
+	err        error
+	confirmErr error
+	refundErr  error
+	pendingErr error
+	byIDErr    error
+	rejectErr  error
+	hold       *storage.Hold
+	holdErr    error
+	Reconciled []*storage.Reconciliation
+}
+
+func (m *mockPaymentTranasctionStorage) SetHold(h *storage.Hold, err error) {
+	m.hold = h
+	m.holdErr = err
+}
+
+func (m *mockPaymentTranasctionStorage) GetHold(ctx context.Context, paymentID uint) (*storage.Hold, error) {
+	return m.hold, m.holdErr
+}
+
+func (m *mockPaymentTranasctionStorage) Reconcile(ctx context.Context, r *storage.Reconciliation) error {
+	m.Reconciled = append(m.Reconciled, r)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) SetByID(p *storage.PaymentTranasction, err error) {
+	m.byID = p
+	m.byIDErr = err
+}
+
+// QueueByID makes the next calls to GetByID return rows in turn before
+// falling back to SetByID.
+func (m *mockPaymentTranasctionStorage) QueueByID(rows ...*storage.PaymentTranasction) {
+	m.byIDQueue = rows
+}
+
+func (m *mockPaymentTranasctionStorage) GetByID(ctx context.Context, id uint) (*storage.PaymentTranasction, error) {
+	if len(m.byIDQueue) > 0 {
+		p := m.byIDQueue[0]
+		m.byIDQueue = m.byIDQueue[1:]
+		return p, nil
+	}
+	return m.byID, m.byIDErr
+}
+
+func (m *mockPaymentTranasctionStorage) ConfirmPending(ctx context.Context, o *storage.Order, p *storage.PaymentTranasction, e *storage.Outbox) error {
+	if m.confirmErr != nil {
+		return m.confirmErr
+	}
+	m.Confirmed = append(m.Confirmed, o)
+	m.Calls = append(m.Calls, p)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) SetRejectPending(err error) {
+	m.rejectErr = err
+}
+
+func (m *mockPaymentTranasctionStorage) RejectPending(ctx context.Context, p *storage.PaymentTranasction, e *storage.Outbox) error {
+	if m.rejectErr != nil {
+		return m.rejectErr
+	}
+	m.Rejected = append(m.Rejected, p)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) Authorize(ctx context.Context, o *storage.Order, p *storage.PaymentTranasction, h *storage.Hold, e *storage.Outbox) error {
+	if m.confirmErr != nil {
+		return m.confirmErr
+	}
+	m.Calls = append(m.Calls, p)
+	m.Holds = append(m.Holds, h)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) Capture(ctx context.Context, o *storage.Order, p *storage.PaymentTranasction, e *storage.Outbox) error {
+	if m.confirmErr != nil {
+		return m.confirmErr
+	}
+	m.Confirmed = append(m.Confirmed, o)
+	m.Captured = append(m.Captured, p)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) SetVoid(err error) {
+	m.voidErr = err
+}
+
+func (m *mockPaymentTranasctionStorage) Void(ctx context.Context, p *storage.PaymentTranasction, e *storage.Outbox) error {
+	if m.voidErr != nil {
+		return m.voidErr
+	}
+	m.Voided = append(m.Voided, p)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *mockPaymentTranasctionStorage) SetExpiredHolds(rows []storage.PaymentTranasction) {
+	m.expiredAt = rows
+}
+
+func (m *mockPaymentTranasctionStorage) ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]storage.PaymentTranasction, error) {
+	m.Now = append(m.Now, now)
+	return m.expiredAt, m.err
+}
+
+type listCall struct {
+	Filter storage.PaymentTranasctionFilter
+	Before uint
+	Limit  int
+}
+
+func (m *mockPaymentTranasctionStorage) SetList(rows []storage.PaymentTranasction, err error) {
+	m.listed = rows
+	m.err = err
+}
+
+func (m *mockPaymentTranasctionStorage) ListByOrder(ctx context.Context, orderID uint) ([]storage.PaymentTranasction, error) {
+	return m.listed, m.err
+}
+
+func (m *mockPaymentTranasctionStorage) List(ctx context.Context, f storage.PaymentTranasctionFilter, before uint, limit int) ([]storage.PaymentTranasction, error) {
+	m.Filters = append(m.Filters, listCall{Filter: f, Before: before, Limit: limit})
+	return m.listed, m.err
+}
+
+func (m *mockPaymentTranasctionStorage) SetVolume(v money.Amount, err error) {
+	m.volume = v
+	m.err = err
+}
+
+func (m *mockPaymentTranasctionStorage) MerchantVolume(ctx context.Context, merchantID uint, since time.Time) (money.Amount, error) {
+	m.Since = append(m.Since, since)
+	return m.volume, m.err
+}
+
+func (m *mockPaymentTranasctionStorage) SetPendingBefore(rows []storage.PaymentTranasction) {
+	m.expired = rows
+}
+
+func (m *mockPaymentTranasctionStorage) ListPendingBefore(ctx context.Context, before time.Time, limit int) ([]storage.PaymentTranasction, error) {
+	m.Before = append(m.Before, before)
+	return m.expired, m.err
+}
+
+func (m *mockPaymentTranasctionStorage) SetPending(p *storage.PaymentTranasction, err error) {
+	m.pending = p
+	m.pendingErr = err
+}
+
+func (m *mockPaymentTranasctionStorage) GetPending(ctx context.Context, orderID uint) (*storage.PaymentTranasction, error) {
+	return m.pending, m.pendingErr
+}
+
+func (m *mockPaymentTranasctionStorage) SetRefund(err error) {
+	m.refundErr = err
+}
+
+// Refund acts like a payment of 300 on order 7 that nothing was refunded from yet.
+func (m *mockPaymentTranasctionStorage) Refund(ctx context.Context, p *storage.PaymentTranasction, event func(*storage.PaymentTranasction) (*storage.Outbox, error)) error {
+	if m.refundErr != nil {
+		return m.refundErr
+	}
+	p.ID = 99
+	p.OrderID = 7
+	p.Status = constant.PaymentTranasctionStatusConfirm
+	if p.Amount.IsZero() {
+		p.Amount = money.MustFromInt(300)
+	}
+	e, err := event(p)
+	if err != nil {
+		return err
+	}
+	m.Calls = append(m.Calls, p)
+	m.Events = append(m.Events, e)
+	return nil
 }
 
 func (m *mockPaymentTranasctionStorage) SetSave(err error) {
 	m.err = err
 }
 
-func (m *mockPaymentTranasctionStorage) Save(o *storage.PaymentTranasction) error {
+func (m *mockPaymentTranasctionStorage) SetConfirm(err error) {
+	m.confirmErr = err
+}
+
+// Save hands out the next ID like the database would.
+func (m *mockPaymentTranasctionStorage) Save(ctx context.Context, o *storage.PaymentTranasction, e *storage.Outbox) error {
+	o.ID = uint(len(m.Calls) + 1)
 	m.Calls = append(m.Calls, o)
+	m.Events = append(m.Events, e)
 	return m.err
 }
 
-type mockKafkaProducer struct {
-	Calls []messaging.RequestPublish
+func (m *mockPaymentTranasctionStorage) Confirm(ctx context.Context, o *storage.Order, p *storage.PaymentTranasction, e *storage.Outbox) error {
+	if m.confirmErr != nil {
+		return m.confirmErr
+	}
+	m.Confirmed = append(m.Confirmed, o)
+	m.Calls = append(m.Calls, p)
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+type mockRateProvider struct {
+	rates map[[2]money.Currency]money.Rate
 	err   error
 }
 
-func (m *mockKafkaProducer) SetPublish(err error) {
+func (m *mockRateProvider) SetRate(from, to money.Currency, r money.Rate) {
+	if m.rates == nil {
+		m.rates = map[[2]money.Currency]money.Rate{}
+	}
+	m.rates[[2]money.Currency{from, to}] = r
+}
+
+func (m *mockRateProvider) SetErr(err error) {
 	m.err = err
 }
 
-func (m *mockKafkaProducer) Publish(r messaging.RequestPublish) error {
-	m.Calls = append(m.Calls, r)
-	return m.err
+func (m *mockRateProvider) Rate(from, to money.Currency) (money.Rate, error) {
+	if m.err != nil {
+		return money.Rate{}, m.err
+	}
+	if from == to {
+		return money.One, nil
+	}
+	r, ok := m.rates[[2]money.Currency{from, to}]
+	if !ok {
+		return money.Rate{}, &fx.RateNotFoundError{From: from, To: to}
+	}
+	return r, nil
+}
+
+type mockChannelProvider struct {
+	Authorizes   []channel.RequestAuthorize
+	Captures     []money.Amount
+	Voids        []string
+	authorizeErr error
+	captureErr   error
+}
+
+func (m *mockChannelProvider) SetAuthorize(err error) {
+	m.authorizeErr = err
+}
+
+func (m *mockChannelProvider) SetCapture(err error) {
+	m.captureErr = err
+}
+
+func (m *mockChannelProvider) Authorize(ctx context.Context, r channel.RequestAuthorize) (*channel.Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.authorizeErr != nil {
+		return nil, m.authorizeErr
+	}
+	m.Authorizes = append(m.Authorizes, r)
+	return &channel.Authorization{ID: "auth-1", Status: channel.AuthorizationStatusAuthorized, Amount: r.Amount, Currency: r.Currency}, nil
+}
+
+func (m *mockChannelProvider) Capture(ctx context.Context, id string, amount money.Amount) (*channel.Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.captureErr != nil {
+		return nil, m.captureErr
+	}
+	m.Captures = append(m.Captures, amount)
+	return &channel.Authorization{ID: id, Status: channel.AuthorizationStatusCaptured, Captured: amount}, nil
+}
+
+func (m *mockChannelProvider) Void(ctx context.Context, id string) (*channel.Authorization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.Voids = append(m.Voids, id)
+	return &channel.Authorization{ID: id, Status: channel.AuthorizationStatusVoided}, nil
 }
 
 type mockClock struct {
@@ -77,59 +370,69 @@ func TestPaymentService(t *testing.T) {
 	var s Service
 	var m *mockOrderStorage
 	var mp *mockPaymentTranasctionStorage
-	var mk *mockKafkaProducer
 	var mt *mockClock
+	var rp *mockRateProvider
+	var cp *mockChannelProvider
+	var ch channel.Registry
 	var o *storage.Order
 	var err error
 	var prr error
-	var krr error
 	var r RequestPayment
 	var pm PaymentMessage
 
 	setup := func() {
 		m = &mockOrderStorage{}
 		mp = &mockPaymentTranasctionStorage{}
-		mk = &mockKafkaProducer{}
 		mt = &mockClock{}
+		rp = &mockRateProvider{}
+		cp = &mockChannelProvider{}
+		ch = channel.NewRegistry()
+		ch.Register(constant.PaymentChannelDebit, cp)
 		o = &storage.Order{
 			Model: gorm.Model{
 				ID: 1,
 			},
-			Amount:     100,
+			Amount:     money.MustFromInt(100),
+			Currency:   money.THB,
 			Status:     constant.OrderStatusRequestPayment,
 			CustomerID: 1,
 			Customer: storage.CustomerProfile{
 				Model: gorm.Model{
 					ID: 1,
 				},
-				Status: constant.CustomerStatusActive,
-				Amount: 1000,
+				Status:   constant.CustomerStatusActive,
+				Amount:   money.MustFromInt(1000),
+				Currency: money.THB,
 			},
 			MerchantID: 1,
 			Merchant: storage.MerchantProfile{
 				Model: gorm.Model{
 					ID: 1,
 				},
-				Status: constant.MerchantStatusActive,
+				Status:   constant.MerchantStatusActive,
+				Currency: money.THB,
 			},
 		}
 		err = nil
 		prr = nil
-		krr = nil
 		m.SetOrder(o, err)
 		mp.SetSave(prr)
-		mk.SetPublish(krr)
-		mt.SetNow(time.Now())
-		s = NewService(m, mp, mk, mt)
+		mt.SetNow(time.Now().UTC())
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{})
 		r = RequestPayment{
 			OrderID: 1,
 			Channel: constant.PaymentChannelDebit,
+			Amount:  money.MustFromInt(100),
 		}
 		pm = PaymentMessage{
-			OrderID:   r.OrderID,
-			Amount:    r.Amount,
-			CreatedAt: mt.Now(),
-			Status:    constant.PaymentTranasctionStatusConfirm,
+			OrderID:         r.OrderID,
+			Amount:          r.Amount,
+			Currency:        money.THB,
+			SettledAmount:   r.Amount,
+			SettledCurrency: money.THB,
+			Rate:            money.One,
+			CreatedAt:       mt.Now(),
+			Status:          constant.PaymentTranasctionStatusConfirm,
 		}
 	}
 
@@ -141,25 +444,38 @@ func TestPaymentService(t *testing.T) {
 		pm.Reason = "invalid payment channel"
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assertTransactionRejected(t, pm, actual, mp)
 	})
 
-	t.Run("order not found should reject transaction and publish reject event", func(t *testing.T) {
+	t.Run("order not found should return order not found without saving transaction", func(t *testing.T) {
 		//Arrange
 		setup()
-		pm.Status = constant.PaymentTranasctionStatusReject
-		pm.Reason = "order status not found"
-		err = errors.New("order status not found")
+		m.SetOrder(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrOrderNotFound, actual)
+		assert.Equal(t, 0, len(mp.Calls))
+		assert.Equal(t, 0, len(mp.Events))
+	})
+
+	t.Run("get order fail should return error without saving transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		err = errors.New("connection reset")
 		m.SetOrder(nil, err)
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assert.Equal(t, err, actual)
+		assert.Equal(t, 0, len(mp.Calls))
 	})
 
 	t.Run("order status is not request payment should reject transaction and publish reject event", func(t *testing.T) {
@@ -171,10 +487,10 @@ func TestPaymentService(t *testing.T) {
 		m.SetOrder(o, nil)
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assertTransactionRejected(t, pm, actual, mp)
 	})
 
 	t.Run("customer status is not active should reject transaction and publish reject event", func(t *testing.T) {
@@ -186,10 +502,10 @@ func TestPaymentService(t *testing.T) {
 		m.SetOrder(o, nil)
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assertTransactionRejected(t, pm, actual, mp)
 	})
 
 	t.Run("customer amount is not enough should reject transaction and publish reject event", func(t *testing.T) {
@@ -197,14 +513,29 @@ func TestPaymentService(t *testing.T) {
 		setup()
 		pm.Status = constant.PaymentTranasctionStatusReject
 		pm.Reason = "customer amount is not enough"
-		o.Customer.Amount = 0
+		o.Customer.Amount = money.MustFromInt(0)
 		m.SetOrder(o, nil)
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("customer amount held by authorizations should not be spendable", func(t *testing.T) {
+		//Arrange
+		setup()
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = "customer amount is not enough"
+		o.Customer.HeldAmount = money.MustFromInt(950)
+		m.SetOrder(o, nil)
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assertTransactionRejected(t, pm, actual, mp)
 	})
 
 	t.Run("merchant status is not active should reject transaction and publish reject event", func(t *testing.T) {
@@ -216,71 +547,529 @@ func TestPaymentService(t *testing.T) {
 		m.SetOrder(o, nil)
 
 		//Action
-		actual := s.Payment(r)
+		_, actual := s.Payment(context.Background(), r)
 
 		//Assert
-		assertTransactionRejected(t, pm, actual, mp, mk)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("invalid payment amount should reject transaction and publish reject event when", func(t *testing.T) {
+		data := []struct {
+			amount   money.Amount
+			expected *Error
+		}{
+			{money.MustFromInt(-1), ErrInvalidPaymentAmount},
+			{money.Amount{}, ErrInvalidPaymentAmount},
+			{money.MustParse("100.001"), ErrPaymentAmountPrecision},
+			{money.MustFromInt(1), ErrPaymentAmountMismatch},
+			{money.MustFromInt(150), ErrPaymentAmountMismatch},
+		}
+		for _, v := range data {
+			t.Run(v.amount.String(), func(t *testing.T) {
+				//Arrange
+				setup()
+				r.Amount = v.amount
+				pm.Status = constant.PaymentTranasctionStatusReject
+				pm.Reason = v.expected.Message
+
+				//Action
+				_, actual := s.Payment(context.Background(), r)
+
+				//Assert
+				assert.Equal(t, v.expected, actual)
+				assertTransactionRejected(t, pm, actual, mp)
+			})
+		}
 	})
 
-	t.Run("make transaction fail should not publish reject event", func(t *testing.T) {
+	t.Run("order in another currency should debit customer converted amount and record rate", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Currency = money.USD
+		o.Merchant.Currency = money.USD
+		o.Customer.Amount = money.MustFromInt(5000)
+		rp.SetRate(money.USD, money.THB, money.MustParseRate("36.25"))
+		r.Amount = money.MustFromInt(100)
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, money.MustFromInt(100), mp.Calls[0].Amount)
+		assert.Equal(t, money.USD, mp.Calls[0].Currency)
+		assert.Equal(t, money.MustFromInt(3625), mp.Calls[0].SettledAmount)
+		assert.Equal(t, money.THB, mp.Calls[0].SettledCurrency)
+		assert.Equal(t, money.MustParseRate("36.25"), mp.Calls[0].Rate)
+		assert.Equal(t, money.MustParseRate("36.25"), decodePaymentMessage(t, mp.Events[0]).Rate)
+	})
+
+	t.Run("converted amount over customer balance should reject transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Currency = money.USD
+		rp.SetRate(money.USD, money.THB, money.MustParseRate("36.25"))
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrCustomerAmountNotEnough.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("held amount past the range of an amount should reject transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Customer.Amount = money.MustParse("-922337203685477.5807")
+		o.Customer.HeldAmount = money.MustParse("0.0002")
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrAmountOutOfRange.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrAmountOutOfRange, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("exchange rate unavailable should reject transaction and publish reject event", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Currency = money.SGD
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrExchangeRateUnavailable.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrExchangeRateUnavailable, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("amount with more decimals than order currency should reject transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Currency = money.JPY
+		r.Amount = money.MustParse("99.5")
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentAmountPrecision, actual)
+	})
+
+	t.Run("partial amount policy should accept amount below order amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{AmountPolicy: constant.PaymentAmountPolicyPartial})
+		r.Amount = money.MustParse("40.25")
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, money.MustParse("40.25"), mp.Calls[0].Amount)
+	})
+
+	t.Run("partial amount policy should reject amount above order amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{AmountPolicy: constant.PaymentAmountPolicyPartial})
+		r.Amount = money.MustParse("100.01")
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentAmountExceedsOutstanding, actual)
+	})
+
+	t.Run("partial amount over outstanding at confirm should reject transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{AmountPolicy: constant.PaymentAmountPolicyPartial})
+		r.Amount = money.MustFromInt(60)
+		mp.SetConfirm(storage.ErrPaymentExceedsOutstanding)
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrPaymentAmountExceedsOutstanding.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentAmountExceedsOutstanding, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("channel without provider should reject transaction as invalid channel", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Channel = constant.PaymentChannelCredit
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrInvalidPaymentChannel.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrInvalidPaymentChannel, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("declined by channel should reject transaction without booking", func(t *testing.T) {
+		//Arrange
+		setup()
+		cp.SetAuthorize(channel.ErrDeclined)
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrPaymentDeclined.Message
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentDeclined, actual)
+		assert.Equal(t, 0, len(mp.Confirmed))
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("booking fail should void authorization", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetConfirm(storage.ErrCustomerAmountNotEnough)
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, actual)
+		assert.Equal(t, []string{"auth-1"}, cp.Voids)
+		assert.Equal(t, 0, len(cp.Captures))
+	})
+
+	t.Run("capture fail after booking should return booked payment and record it for reconciliation", func(t *testing.T) {
+		//Arrange
+		setup()
+		cp.SetCapture(channel.ErrAuthorizationNotCapturable)
+
+		//Action
+		actual, err := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, actual.Status)
+		assert.Equal(t, 1, len(mp.Calls))
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, mp.Calls[0].Status)
+		assert.Equal(t, 1, len(mp.Reconciled))
+		assert.Equal(t, constant.ReconciliationKindCaptureFailed, mp.Reconciled[0].Kind)
+		assert.Equal(t, mp.Calls[0].ProviderRef, mp.Reconciled[0].ProviderRef)
+		assert.Equal(t, channel.ErrAuthorizationNotCapturable.Error(), mp.Reconciled[0].Reason)
+	})
+
+	t.Run("confirm transaction fail should not publish reject event", func(t *testing.T) {
 		//Arrange
 		setup()
 		prr = errors.New("unknown error")
-		mp.SetSave(prr)
+		mp.SetConfirm(prr)
 
 		//Action
-		expected := s.Payment(r)
+		_, expected := s.Payment(context.Background(), r)
 
 		//Assert
 		assert.EqualError(t, expected, "unknown error")
+		assert.Equal(t, 0, len(mp.Calls))
 	})
 
-	t.Run("publish transaction fail should not publish reject event", func(t *testing.T) {
+	t.Run("customer balance spent concurrently should reject transaction and publish reject event", func(t *testing.T) {
 		//Arrange
 		setup()
-		krr = errors.New("publish complete payment transaction fail")
-		mk.SetPublish(krr)
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = "customer amount is not enough"
+		mp.SetConfirm(storage.ErrCustomerAmountNotEnough)
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("illegal order transition on confirm should reject transaction and publish reject event", func(t *testing.T) {
+		//Arrange
+		setup()
+		pm.Status = constant.PaymentTranasctionStatusReject
+		pm.Reason = ErrOrderIllegalTransition.Message
+		mp.SetConfirm(&constant.OrderTransitionError{From: constant.OrderStatusConfirm, To: constant.OrderStatusConfirm})
+
+		//Action
+		_, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrOrderIllegalTransition, actual)
+		assertTransactionRejected(t, pm, actual, mp)
+	})
+
+	t.Run("make reject transaction fail should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Status = constant.OrderStatusOpen
+		m.SetOrder(o, nil)
+		prr = errors.New("unknown error")
+		mp.SetSave(prr)
+
 		//Action
-		expected := s.Payment(r)
+		_, expected := s.Payment(context.Background(), r)
 
 		//Assert
-		assert.EqualError(t, expected, "publish complete payment transaction fail")
+		assert.EqualError(t, expected, "unknown error")
 	})
 
 	t.Run("success transaction should publish completed event", func(t *testing.T) {
 		//Arrange
 		setup()
-		mk.SetPublish(krr)
 		pt := &storage.PaymentTranasction{
 			Model: gorm.Model{
 				UpdatedAt: mt.t,
 			},
-			OrderID: r.OrderID,
-			Amount:  r.Amount,
-			Channel: r.Channel,
-			Status:  constant.PaymentTranasctionStatusConfirm,
+			OrderID:         r.OrderID,
+			Type:            constant.PaymentTranasctionTypePayment,
+			Amount:          r.Amount,
+			Currency:        money.THB,
+			SettledAmount:   r.Amount,
+			SettledCurrency: money.THB,
+			Rate:            money.One,
+			NetAmount:       r.Amount,
+			Channel:         r.Channel,
+			Status:          constant.PaymentTranasctionStatusConfirm,
+			ProviderRef:     "auth-1",
 		}
 
 		//Action
-		expected := s.Payment(r)
+		res, expected := s.Payment(context.Background(), r)
 
-		//Assert save txn
+		//Assert confirm txn
 		assert.Nil(t, expected)
+		assert.Equal(t, toPaymentResponse(pt, ""), res)
 		assert.Equal(t, 1, len(mp.Calls))
 		assert.Equal(t, pt, mp.Calls[0])
+		assert.Equal(t, []*storage.Order{o}, mp.Confirmed)
+		assert.Equal(t, []channel.RequestAuthorize{{Reference: "1", Amount: r.Amount, Currency: money.THB}}, cp.Authorizes)
+		assert.Equal(t, []money.Amount{r.Amount}, cp.Captures)
+		assert.Equal(t, 0, len(cp.Voids))
+
+		//Assert outbox event
+		assert.Equal(t, 1, len(mp.Events))
+		assert.Equal(t, constant.KafkaTopicPaymentTransaction, mp.Events[0].Topic)
+		assert.Equal(t, "1", mp.Events[0].Key)
+		assert.Equal(t, constant.OutboxStatusPending, mp.Events[0].Status)
+		assert.Equal(t, mt.t, mp.Events[0].NextAttemptAt)
+		pm.NetAmount = r.Amount
+		assert.Equal(t, pm, decodePaymentMessage(t, mp.Events[0]))
+	})
+	t.Run("payment with fee should store fee and net amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{Fees: fee.Schedule{
+			Channels: map[constant.PaymentChannel]fee.Rule{
+				constant.PaymentChannelDebit: {Rate: money.MustParseRate("0.02"), Fixed: money.MustFromInt(1)},
+			},
+		}})
+
+		//Action
+		res, err := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(3), res.FeeAmount)
+		assert.Equal(t, money.MustFromInt(97), res.NetAmount)
+		assert.Equal(t, money.MustFromInt(3), mp.Calls[0].FeeAmount)
+		assert.Equal(t, 0, len(mp.Since))
+		pm.FeeAmount = money.MustFromInt(3)
+		pm.NetAmount = money.MustFromInt(97)
+		assert.Equal(t, pm, decodePaymentMessage(t, mp.Events[0]))
+	})
+
+	t.Run("tiered fee should use merchant volume since start of month", func(t *testing.T) {
+		//Arrange
+		setup()
+		mt.SetNow(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC))
+		mp.SetVolume(money.MustFromInt(5000), nil)
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{Fees: fee.Schedule{
+			Channels: map[constant.PaymentChannel]fee.Rule{
+				constant.PaymentChannelDebit: {
+					Rate:  money.MustParseRate("0.05"),
+					Tiers: []fee.Tier{{MinVolume: money.MustFromInt(1000), Rate: money.MustParseRate("0.01")}},
+				},
+			},
+		}})
+
+		//Action
+		res, err := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Time{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, mp.Since)
+		assert.Equal(t, money.MustFromInt(1), res.FeeAmount)
+		assert.Equal(t, money.MustFromInt(99), res.NetAmount)
+	})
 
-		//Assert publish msg
-		assert.Equal(t, 1, len(mk.Calls))
-		assert.Equal(t, constant.KafkaTopicPaymentTransaction, mk.Calls[0].Topic)
-		assert.Equal(t, "1", mk.Calls[0].Key)
-		assert.Equal(t, pm, mk.Calls[0].Message)
+	t.Run("merchant volume failure should return error without charging customer", func(t *testing.T) {
+		//Arrange
+		setup()
+		s = NewService(m, mp, mt, rp, ch, PaymentConfig{Fees: fee.Schedule{
+			Channels: map[constant.PaymentChannel]fee.Rule{
+				constant.PaymentChannelDebit: {Tiers: []fee.Tier{{MinVolume: money.MustFromInt(1000)}}},
+			},
+		}})
+		mp.SetVolume(money.Amount{}, errors.New("unknown error"))
+
+		//Action
+		_, err := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.EqualError(t, err, "unknown error")
+		assert.Equal(t, 0, len(cp.Authorizes))
+		assert.Equal(t, 0, len(mp.Calls))
+	})
+
+	t.Run("promptpay should save pending transaction and return qr payload without touching customer amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Channel = constant.PaymentChannelPromptPay
+		o.Customer.Amount = money.Amount{}
+		o.Merchant.PromptPayID = "0812345678"
+		pm.Status = constant.PaymentTranasctionStatusPending
+
+		//Action
+		res, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, constant.PaymentTranasctionStatusPending, res.Status)
+		assert.Equal(t, uint(1), res.TransactionID)
+		assert.Equal(t, "00020101021229370016A0000006770101110113006681234567853037645406100.005802TH620505011630461B5", res.QRPayload)
+		assert.Equal(t, 1, len(mp.Calls))
+		assert.Equal(t, constant.PaymentTranasctionStatusPending, mp.Calls[0].Status)
+		assert.Equal(t, 0, len(mp.Confirmed))
+		assert.Equal(t, 0, len(cp.Authorizes))
+		assert.Equal(t, pm, decodePaymentMessage(t, mp.Events[0]))
+	})
+
+	t.Run("qr payment should pay merchant biller id with order and transaction as references", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Channel = constant.PaymentChannelQRPayment
+		o.Merchant.PromptPayID = "0105555123456"
+
+		//Action
+		res, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, "00020101021230490016A0000006770101120115010555512345600020110301153037645406100.005802TH63045CF7", res.QRPayload)
+	})
+
+	t.Run("promptpay for order in another currency should ask for converted thb amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Channel = constant.PaymentChannelPromptPay
+		o.Currency = money.USD
+		o.Customer.Currency = money.USD
+		o.Merchant.PromptPayID = "0812345678"
+		rp.SetRate(money.USD, money.THB, money.MustParseRate("36.25"))
+
+		//Action
+		res, actual := s.Payment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, money.MustFromInt(3625), res.SettledAmount)
+		assert.Equal(t, money.THB, res.SettledCurrency)
+		assert.Contains(t, res.QRPayload, "54073625.00")
+	})
+
+	t.Run("qr channel without merchant promptpay id should reject transaction", func(t *testing.T) {
+		data := []struct {
+			channel constant.PaymentChannel
+			id      string
+		}{
+			{constant.PaymentChannelPromptPay, ""},
+			{constant.PaymentChannelQRPayment, ""},
+			{constant.PaymentChannelQRPayment, "0812345678"},
+		}
+		for _, v := range data {
+			t.Run(string(v.channel)+" "+v.id, func(t *testing.T) {
+				//Arrange
+				setup()
+				r.Channel = v.channel
+				o.Merchant.PromptPayID = v.id
+				pm.Status = constant.PaymentTranasctionStatusReject
+				pm.Reason = ErrMerchantPromptPayNotConfigured.Message
+
+				//Action
+				_, actual := s.Payment(context.Background(), r)
+
+				//Assert
+				assert.Equal(t, ErrMerchantPromptPayNotConfigured, actual)
+				assertTransactionRejected(t, pm, actual, mp)
+			})
+		}
+	})
+
+	t.Run("payment qr should rebuild payload of pending transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+		o.Merchant.PromptPayID = "0812345678"
+		mp.SetPending(&storage.PaymentTranasction{
+			Model:           gorm.Model{ID: 1},
+			OrderID:         1,
+			Channel:         constant.PaymentChannelPromptPay,
+			Status:          constant.PaymentTranasctionStatusPending,
+			Amount:          money.MustFromInt(100),
+			SettledAmount:   money.MustFromInt(100),
+			SettledCurrency: money.THB,
+		}, nil)
+
+		//Action
+		res, actual := s.PaymentQR(context.Background(), 1)
+
+		//Assert
+		assert.Nil(t, actual)
+		assert.Equal(t, "00020101021229370016A0000006770101110113006681234567853037645406100.005802TH620505011630461B5", res.QRPayload)
+	})
+
+	t.Run("payment qr without pending transaction should return payment not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetPending(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, actual := s.PaymentQR(context.Background(), 1)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotFound, actual)
 	})
 }
 
-func assertTransactionRejected(t *testing.T, pm PaymentMessage, actual error, mp *mockPaymentTranasctionStorage, mk *mockKafkaProducer) {
+func assertTransactionRejected(t *testing.T, pm PaymentMessage, actual error, mp *mockPaymentTranasctionStorage) {
 	assert.Equal(t, pm.Reason, actual.Error())
 	assert.Equal(t, pm.Status, mp.Calls[0].Status)
 	assert.Equal(t, pm.Reason, mp.Calls[0].Reason)
-	assert.Equal(t, pm.Status, mk.Calls[0].Message.(PaymentMessage).Status)
-	assert.Equal(t, pm.Reason, mk.Calls[0].Message.(PaymentMessage).Reason)
+	assert.Equal(t, pm.Status, decodePaymentMessage(t, mp.Events[0]).Status)
+	assert.Equal(t, pm.Reason, decodePaymentMessage(t, mp.Events[0]).Reason)
+}
+
+func decodePaymentMessage(t *testing.T, e *storage.Outbox) PaymentMessage {
+	var pm PaymentMessage
+	if err := json.Unmarshal([]byte(e.Payload), &pm); err != nil {
+		t.Fatalf("Failed to decode outbox payload [%v]", err)
+	}
+	return pm
 }
@@ -0,0 +1,164 @@
+//go:build integration_test
+// +build integration_test
+
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/migration"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// sameCurrencyRates only converts a currency to itself.
+type sameCurrencyRates struct{}
+
+func (sameCurrencyRates) Rate(from, to money.Currency) (money.Rate, error) {
+	return money.One, nil
+}
+
+// setupStorageDB opens a migrated SQLite database, so the service runs
+// against the real storages and constraints.
+func setupStorageDB(t *testing.T) *gorm.DB {
+	db, err := storage.Open(storage.DriverSQLite, filepath.Join(t.TempDir(), "service.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite: %v", err)
+	}
+	m, err := migration.NewMigrator(db, clock.NewClock())
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestPaymentWithStorage(t *testing.T) {
+	var ctx context.Context
+	var db *gorm.DB
+	var s Service
+
+	setup := func() {
+		ctx = context.Background()
+		db = setupStorageDB(t)
+		s = NewService(storage.NewOrderStorage(db), storage.NewPaymentTranasctionStorage(db), clock.NewClock(), sameCurrencyRates{}, channel.NewSimulatorRegistry(channel.SimulatorConfig{}), PaymentConfig{})
+	}
+
+	count := func() (transactions int64, events int64) {
+		db.Model(&storage.PaymentTranasction{}).Count(&transactions)
+		db.Model(&storage.Outbox{}).Count(&events)
+		return
+	}
+
+	t.Run("unknown order should return order not found without saving transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.Payment(ctx, RequestPayment{OrderID: 404, Channel: constant.PaymentChannelDebit, Amount: money.MustFromInt(100)})
+
+		//Assert
+		assert.Equal(t, ErrOrderNotFound, err)
+		transactions, events := count()
+		assert.Equal(t, int64(0), transactions)
+		assert.Equal(t, int64(0), events)
+	})
+
+	t.Run("invalid request for unknown order should return validation error without saving transaction", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.Payment(ctx, RequestPayment{OrderID: 404, Channel: "Zebit", Amount: money.MustFromInt(100)})
+
+		//Assert
+		assert.Equal(t, ErrInvalidPaymentChannel, err)
+		transactions, events := count()
+		assert.Equal(t, int64(0), transactions)
+		assert.Equal(t, int64(0), events)
+	})
+}
+
+func TestCaptureWithStorage(t *testing.T) {
+	var ctx context.Context
+	var db *gorm.DB
+	var o *storage.Order
+
+	// start builds the service as the server does on boot, with simulators
+	// that know nothing of earlier authorizations
+	start := func() Service {
+		return NewService(storage.NewOrderStorage(db), storage.NewPaymentTranasctionStorage(db), clock.NewClock(), sameCurrencyRates{}, channel.NewSimulatorRegistry(channel.SimulatorConfig{}), PaymentConfig{})
+	}
+
+	setup := func() {
+		ctx = context.Background()
+		db = setupStorageDB(t)
+		o = &storage.Order{
+			Customer: storage.CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: storage.MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+		}
+		ot := storage.NewOrderStorage(db)
+		if err := ot.Save(ctx, o); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, ""); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	t.Run("capture after restart should return authorization not found without booking", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, err := start().Payment(ctx, RequestPayment{OrderID: o.ID, Channel: constant.PaymentChannelCredit, Amount: money.MustFromInt(400)})
+		if err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+
+		//Action
+		_, err = start().Capture(ctx, RequestCapture{PaymentID: p.TransactionID})
+
+		//Assert
+		assert.Equal(t, ErrAuthorizationNotFound, err)
+		var stored storage.PaymentTranasction
+		var c storage.CustomerProfile
+		db.First(&stored, p.TransactionID)
+		db.First(&c, o.CustomerID)
+		assert.Equal(t, constant.PaymentTranasctionStatusAuthorized, stored.Status)
+		assert.Equal(t, money.MustFromInt(1000), c.Amount)
+		assert.Equal(t, money.MustFromInt(400), c.HeldAmount)
+	})
+
+	t.Run("void after restart should still release hold", func(t *testing.T) {
+		//Arrange
+		setup()
+		p, err := start().Payment(ctx, RequestPayment{OrderID: o.ID, Channel: constant.PaymentChannelCredit, Amount: money.MustFromInt(400)})
+		if err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+
+		//Action
+		actual, err := start().Void(ctx, p.TransactionID)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusVoid, actual.Status)
+		var c storage.CustomerProfile
+		db.First(&c, o.CustomerID)
+		assert.Equal(t, money.Amount{}, c.HeldAmount)
+	})
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+// PaymentResult is the outcome a channel reports for a pending payment.
+type PaymentResult string
+
+const (
+	PaymentResultSuccess PaymentResult = "success"
+	PaymentResultFailed  PaymentResult = "failed"
+)
+
+// RequestCompletePayment is a channel telling us how a pending payment
+// ended. Channel comes from the webhook URL rather than the body.
+type RequestCompletePayment struct {
+	Channel       constant.PaymentChannel `json:"-"`
+	TransactionID uint                    `json:"transactionID"`
+	Result        PaymentResult           `json:"result"`
+	ProviderRef   string                  `json:"providerRef"`
+	Reason        string                  `json:"reason"`
+}
+
+func (r PaymentResult) status() constant.PaymentTranasctionStatus {
+	if r == PaymentResultSuccess {
+		return constant.PaymentTranasctionStatusConfirm
+	}
+	return constant.PaymentTranasctionStatusReject
+}
+
+// CompletePayment confirms or rejects a pending payment as reported by its
+// channel. Channels redeliver webhooks, so reporting a result the payment
+// already has succeeds without changing anything.
+func (s *service) CompletePayment(ctx context.Context, r RequestCompletePayment) (*PaymentResponse, error) {
+	if r.Result != PaymentResultSuccess && r.Result != PaymentResultFailed {
+		return nil, ErrInvalidRequest
+	}
+	t, err := s.p.GetByID(ctx, r.TransactionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != constant.PaymentTranasctionTypePayment || t.Channel != r.Channel {
+		return nil, ErrPaymentNotFound
+	}
+	if t.Status != constant.PaymentTranasctionStatusPending {
+		return s.completed(ctx, t, r)
+	}
+
+	n := s.c.Now()
+	if r.Result == PaymentResultFailed {
+		reason := r.Reason
+		if reason == "" {
+			reason = ErrPaymentDeclined.Message
+		}
+		if err := s.rejectPending(ctx, t, reason, n); err != nil {
+			return nil, err
+		}
+		return toPaymentResponse(t, ""), nil
+	}
+
+	o, err := s.o.GetOrder(ctx, t.OrderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.charge(ctx, o, t, n); err != nil {
+		return nil, err
+	}
+	t.UpdatedAt = n
+	t.Status = constant.PaymentTranasctionStatusConfirm
+	t.ProviderRef = r.ProviderRef
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return nil, err
+	}
+	err = s.p.ConfirmPending(ctx, o, t, e)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = ErrOrderNotFound
+	}
+	err = fromStorageError(err)
+	if err == nil {
+		return toPaymentResponse(t, ""), nil
+	}
+	if err == ErrPaymentNotPending {
+		// Completed meanwhile, e.g. rejected by the sweeper
+		t, err := s.p.GetByID(ctx, r.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		return s.completed(ctx, t, r)
+	}
+	var de *Error
+	if !errors.As(err, &de) {
+		return nil, err
+	}
+	// The order can no longer take this payment, e.g. another payment covered
+	// it first, so the transfer has to be returned to the customer.
+	if err := s.rejectPending(ctx, t, de.Message, n); err != nil {
+		return nil, err
+	}
+	s.reconcile(ctx, constant.ReconciliationKindTransferToReturn, t, de)
+	return toPaymentResponse(t, ""), nil
+}
+
+// completed answers a result reported for a payment that is no longer
+// pending. A success reported for a payment we rejected means the customer
+// transferred money we did not book, so the transfer is recorded to be
+// returned.
+func (s *service) completed(ctx context.Context, t *storage.PaymentTranasction, r RequestCompletePayment) (*PaymentResponse, error) {
+	if t.Status == r.Result.status() {
+		return toPaymentResponse(t, ""), nil
+	}
+	if r.Result != PaymentResultSuccess || t.Status != constant.PaymentTranasctionStatusReject {
+		return nil, ErrPaymentNotPending
+	}
+	t.ProviderRef = r.ProviderRef
+	s.reconcile(ctx, constant.ReconciliationKindTransferToReturn, t, fmt.Errorf("success reported for payment rejected: %s", t.Reason))
+	return toPaymentResponse(t, ""), nil
+}
+
+// ExpirePending rejects up to limit payments still pending since before and
+// returns how many it rejected. Payments completed in the meantime are skipped.
+func (s *service) ExpirePending(ctx context.Context, before time.Time, limit int) (int, error) {
+	rows, err := s.p.ListPendingBefore(ctx, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	n := s.c.Now()
+	expired := 0
+	for i := range rows {
+		err := s.rejectPending(ctx, &rows[i], ErrPaymentExpired.Message, n)
+		if err == ErrPaymentNotPending {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *service) rejectPending(ctx context.Context, t *storage.PaymentTranasction, reason string, n time.Time) error {
+	t.UpdatedAt = n
+	t.Status = constant.PaymentTranasctionStatusReject
+	t.Reason = reason
+	e, err := newPaymentOutbox(t, n)
+	if err != nil {
+		return err
+	}
+	return fromStorageError(s.p.RejectPending(ctx, t, e))
+}
@@ -0,0 +1,274 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPendingPaymentService(t *testing.T) {
+	var s Service
+	var m *mockOrderStorage
+	var mp *mockPaymentTranasctionStorage
+	var mt *mockClock
+	var p *storage.PaymentTranasction
+	var r RequestCompletePayment
+
+	setup := func() {
+		m = &mockOrderStorage{}
+		m.SetOrder(&storage.Order{Model: gorm.Model{ID: 7}, Amount: money.MustFromInt(100), Status: constant.OrderStatusRequestPayment}, nil)
+		mp = &mockPaymentTranasctionStorage{}
+		mt = &mockClock{}
+		mt.SetNow(time.Now().UTC())
+		s = NewService(m, mp, mt, &mockRateProvider{}, channel.NewRegistry(), PaymentConfig{})
+		p = &storage.PaymentTranasction{
+			Model:           gorm.Model{ID: 3},
+			OrderID:         7,
+			Type:            constant.PaymentTranasctionTypePayment,
+			Channel:         constant.PaymentChannelPromptPay,
+			Status:          constant.PaymentTranasctionStatusPending,
+			Amount:          money.MustFromInt(100),
+			Currency:        money.THB,
+			SettledAmount:   money.MustFromInt(100),
+			SettledCurrency: money.THB,
+			Rate:            money.One,
+		}
+		mp.SetByID(p, nil)
+		r = RequestCompletePayment{
+			Channel:       constant.PaymentChannelPromptPay,
+			TransactionID: 3,
+			Result:        PaymentResultSuccess,
+			ProviderRef:   "bank-123",
+		}
+	}
+
+	t.Run("success result should confirm pending payment and publish completed event", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, actual.Status)
+		assert.Equal(t, 1, len(mp.Confirmed))
+		assert.Equal(t, "bank-123", mp.Calls[0].ProviderRef)
+		assert.Equal(t, mt.t, mp.Calls[0].UpdatedAt)
+		pm := decodePaymentMessage(t, mp.Events[0])
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, pm.Status)
+		assert.Equal(t, uint(7), pm.OrderID)
+	})
+
+	t.Run("failed result should reject pending payment with reason", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Result = PaymentResultFailed
+		r.Reason = "insufficient funds"
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, actual.Status)
+		assert.Equal(t, "insufficient funds", actual.Reason)
+		assert.Equal(t, 0, len(mp.Confirmed))
+		assert.Equal(t, "insufficient funds", decodePaymentMessage(t, mp.Events[0]).Reason)
+	})
+
+	t.Run("redelivered result should succeed without changing payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		p.Status = constant.PaymentTranasctionStatusConfirm
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, actual.Status)
+		assert.Equal(t, 0, len(mp.Events))
+	})
+
+	t.Run("failed result for confirmed payment should return payment not pending", func(t *testing.T) {
+		//Arrange
+		setup()
+		p.Status = constant.PaymentTranasctionStatusConfirm
+		r.Result = PaymentResultFailed
+
+		//Action
+		_, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotPending, err)
+		assert.Equal(t, 0, len(mp.Reconciled))
+	})
+
+	t.Run("success result for rejected payment should record transfer to return", func(t *testing.T) {
+		//Arrange
+		setup()
+		p.Status = constant.PaymentTranasctionStatusReject
+		p.Reason = ErrPaymentExpired.Message
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, actual.Status)
+		assert.Equal(t, 0, len(mp.Events))
+		assert.Equal(t, 1, len(mp.Reconciled))
+		assert.Equal(t, constant.ReconciliationKindTransferToReturn, mp.Reconciled[0].Kind)
+		assert.Equal(t, "bank-123", mp.Reconciled[0].ProviderRef)
+		assert.Equal(t, money.MustFromInt(100), mp.Reconciled[0].Amount)
+		assert.Contains(t, mp.Reconciled[0].Reason, ErrPaymentExpired.Message)
+	})
+
+	t.Run("payment of another channel should return payment not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Channel = constant.PaymentChannelQRPayment
+
+		//Action
+		_, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotFound, err)
+	})
+
+	t.Run("unknown payment should return payment not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetByID(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotFound, err)
+	})
+
+	t.Run("unknown result should return invalid request", func(t *testing.T) {
+		//Arrange
+		setup()
+		r.Result = "maybe"
+
+		//Action
+		_, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Equal(t, ErrInvalidRequest, err)
+	})
+
+	t.Run("order no longer accepting payment should reject pending payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetConfirm(storage.ErrOrderNotRequestPayment)
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, actual.Status)
+		assert.Equal(t, ErrOrderNotRequestPayment.Message, mp.Rejected[0].Reason)
+		assert.Equal(t, 1, len(mp.Reconciled))
+		assert.Equal(t, constant.ReconciliationKindTransferToReturn, mp.Reconciled[0].Kind)
+		assert.Equal(t, "bank-123", mp.Reconciled[0].ProviderRef)
+		assert.Equal(t, ErrOrderNotRequestPayment.Error(), mp.Reconciled[0].Reason)
+	})
+
+	t.Run("payment confirmed concurrently should return confirmed payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		confirmed := *p
+		confirmed.Status = constant.PaymentTranasctionStatusConfirm
+		mp.QueueByID(p, &confirmed)
+		mp.SetConfirm(storage.ErrPaymentNotPending)
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, actual.Status)
+		assert.Equal(t, 0, len(mp.Rejected))
+		assert.Equal(t, 0, len(mp.Reconciled))
+	})
+
+	t.Run("payment expired concurrently should record transfer to return", func(t *testing.T) {
+		//Arrange
+		setup()
+		expired := *p
+		expired.Status = constant.PaymentTranasctionStatusReject
+		expired.Reason = ErrPaymentExpired.Message
+		mp.QueueByID(p, &expired)
+		mp.SetConfirm(storage.ErrPaymentNotPending)
+
+		//Action
+		actual, err := s.CompletePayment(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, actual.Status)
+		assert.Equal(t, 0, len(mp.Rejected))
+		assert.Equal(t, 1, len(mp.Reconciled))
+		assert.Equal(t, constant.ReconciliationKindTransferToReturn, mp.Reconciled[0].Kind)
+	})
+
+	t.Run("expire pending should reject payments pending before cut off", func(t *testing.T) {
+		//Arrange
+		setup()
+		before := mt.t.Add(-15 * time.Minute)
+		mp.SetPendingBefore([]storage.PaymentTranasction{*p, *p})
+
+		//Action
+		actual, err := s.ExpirePending(context.Background(), before, 10)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, actual)
+		assert.Equal(t, []time.Time{before}, mp.Before)
+		assert.Equal(t, ErrPaymentExpired.Message, mp.Rejected[0].Reason)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, decodePaymentMessage(t, mp.Events[1]).Status)
+	})
+
+	t.Run("expire pending should skip payments completed meanwhile", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetPendingBefore([]storage.PaymentTranasction{*p})
+		mp.SetRejectPending(storage.ErrPaymentNotPending)
+
+		//Action
+		actual, err := s.ExpirePending(context.Background(), mt.t, 10)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, actual)
+	})
+
+	t.Run("expire pending should stop on storage failure", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetPendingBefore([]storage.PaymentTranasction{*p})
+		mp.SetRejectPending(errors.New("connection reset"))
+
+		//Action
+		_, err := s.ExpirePending(context.Background(), mt.t, 10)
+
+		//Assert
+		assert.EqualError(t, err, "connection reset")
+	})
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+// RequestListPayments filters the transaction list. Zero fields do not
+// filter; Cursor continues from the NextCursor of a previous page.
+type RequestListPayments struct {
+	Status     constant.PaymentTranasctionStatus
+	Channel    constant.PaymentChannel
+	MerchantID uint
+	From       time.Time
+	To         time.Time
+	Cursor     string
+	Size       int
+}
+
+type PaymentTransactionResponse struct {
+	ID              uint                              `json:"id"`
+	OrderID         uint                              `json:"orderID"`
+	Type            constant.PaymentTranasctionType   `json:"type"`
+	ParentID        *uint                             `json:"parentID,omitempty"`
+	Channel         constant.PaymentChannel           `json:"channel"`
+	Status          constant.PaymentTranasctionStatus `json:"status"`
+	Amount          money.Amount                      `json:"amount"`
+	Currency        money.Currency                    `json:"currency"`
+	SettledAmount   money.Amount                      `json:"settledAmount"`
+	SettledCurrency money.Currency                    `json:"settledCurrency"`
+	Rate            money.Rate                        `json:"rate"`
+	FeeAmount       money.Amount                      `json:"feeAmount"`
+	NetAmount       money.Amount                      `json:"netAmount"`
+	Reason          string                            `json:"reason,omitempty"`
+	ProviderRef     string                            `json:"providerRef,omitempty"`
+	CreatedAt       time.Time                         `json:"createdAt"`
+	UpdatedAt       time.Time                         `json:"updatedAt"`
+}
+
+func toPaymentTransactionResponse(t *storage.PaymentTranasction) *PaymentTransactionResponse {
+	return &PaymentTransactionResponse{
+		ID:              t.ID,
+		OrderID:         t.OrderID,
+		Type:            t.Type,
+		ParentID:        t.ParentID,
+		Channel:         t.Channel,
+		Status:          t.Status,
+		Amount:          t.Amount,
+		Currency:        t.Currency,
+		SettledAmount:   t.SettledAmount,
+		SettledCurrency: t.SettledCurrency,
+		Rate:            t.Rate,
+		FeeAmount:       t.FeeAmount,
+		NetAmount:       t.NetAmount,
+		Reason:          t.Reason,
+		ProviderRef:     t.ProviderRef,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+	}
+}
+
+func (s *service) GetPayment(ctx context.Context, id uint) (*PaymentTransactionResponse, error) {
+	t, err := s.p.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentTransactionResponse(t), nil
+}
+
+func (s *service) ListOrderPayments(ctx context.Context, orderID uint) ([]PaymentTransactionResponse, error) {
+	rows, err := s.p.ListByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	res := []PaymentTransactionResponse{}
+	for i := range rows {
+		res = append(res, *toPaymentTransactionResponse(&rows[i]))
+	}
+	return res, nil
+}
+
+func (s *service) ListPayments(ctx context.Context, r RequestListPayments) (*CursorPageResponse[PaymentTransactionResponse], error) {
+	if r.Status != "" && !constant.IsValidPaymentTranasctionStatus(r.Status) {
+		return nil, ErrInvalidRequest
+	}
+	if r.Channel != "" && !constant.IsValidPaymentChannel(r.Channel) {
+		return nil, ErrInvalidPaymentChannel
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return nil, ErrInvalidRequest
+	}
+	var before uint64
+	if r.Cursor != "" {
+		var err error
+		before, err = strconv.ParseUint(r.Cursor, 10, 0)
+		if err != nil || before == 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+	size := RequestPage{Size: r.Size}.normalize().Size
+
+	// One extra row tells whether there is a next page.
+	rows, err := s.p.List(ctx, storage.PaymentTranasctionFilter{
+		Status:     r.Status,
+		Channel:    r.Channel,
+		MerchantID: r.MerchantID,
+		From:       r.From,
+		To:         r.To,
+	}, uint(before), size+1)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CursorPageResponse[PaymentTransactionResponse]{
+		Items: []PaymentTransactionResponse{},
+		Size:  size,
+	}
+	if len(rows) > size {
+		rows = rows[:size]
+		res.NextCursor = strconv.FormatUint(uint64(rows[size-1].ID), 10)
+	}
+	for i := range rows {
+		res.Items = append(res.Items, *toPaymentTransactionResponse(&rows[i]))
+	}
+	return res, nil
+}
@@ -0,0 +1,167 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestQueryService(t *testing.T) {
+	var s Service
+	var mp *mockPaymentTranasctionStorage
+
+	setup := func() {
+		mp = &mockPaymentTranasctionStorage{}
+		s = NewService(&mockOrderStorage{}, mp, &mockClock{}, &mockRateProvider{}, channel.NewRegistry(), PaymentConfig{})
+	}
+
+	rows := func(ids ...uint) []storage.PaymentTranasction {
+		var r []storage.PaymentTranasction
+		for _, id := range ids {
+			r = append(r, storage.PaymentTranasction{Model: gorm.Model{ID: id}, OrderID: 1})
+		}
+		return r
+	}
+
+	t.Run("get payment should return stored reason of rejection", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetByID(&storage.PaymentTranasction{
+			Model:   gorm.Model{ID: 3},
+			OrderID: 1,
+			Type:    constant.PaymentTranasctionTypePayment,
+			Channel: constant.PaymentChannelDebit,
+			Status:  constant.PaymentTranasctionStatusReject,
+			Reason:  "customer amount is not enough",
+			Amount:  money.MustFromInt(100),
+		}, nil)
+
+		//Action
+		actual, err := s.GetPayment(context.Background(), 3)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, uint(3), actual.ID)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, actual.Status)
+		assert.Equal(t, "customer amount is not enough", actual.Reason)
+	})
+
+	t.Run("get unknown payment should return payment not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetByID(nil, gorm.ErrRecordNotFound)
+
+		//Action
+		_, err := s.GetPayment(context.Background(), 3)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotFound, err)
+	})
+
+	t.Run("list order payments should return every transaction of order", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetList(rows(1, 2), nil)
+
+		//Action
+		actual, err := s.ListOrderPayments(context.Background(), 1)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(actual))
+	})
+
+	t.Run("list payments should pass filters and return next cursor when more rows exist", func(t *testing.T) {
+		//Arrange
+		setup()
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 0, 1)
+		mp.SetList(rows(9, 8, 7), nil)
+
+		//Action
+		actual, err := s.ListPayments(context.Background(), RequestListPayments{
+			Status:     constant.PaymentTranasctionStatusConfirm,
+			Channel:    constant.PaymentChannelDebit,
+			MerchantID: 4,
+			From:       from,
+			To:         to,
+			Cursor:     "10",
+			Size:       2,
+		})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []listCall{{
+			Filter: storage.PaymentTranasctionFilter{Status: constant.PaymentTranasctionStatusConfirm, Channel: constant.PaymentChannelDebit, MerchantID: 4, From: from, To: to},
+			Before: 10,
+			Limit:  3,
+		}}, mp.Filters)
+		assert.Equal(t, 2, len(actual.Items))
+		assert.Equal(t, "8", actual.NextCursor)
+	})
+
+	t.Run("last page should not return next cursor", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetList(rows(2, 1), nil)
+
+		//Action
+		actual, err := s.ListPayments(context.Background(), RequestListPayments{Size: 2})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(actual.Items))
+		assert.Equal(t, "", actual.NextCursor)
+		assert.Equal(t, uint(0), mp.Filters[0].Before)
+	})
+
+	t.Run("list payments should reject invalid request when", func(t *testing.T) {
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		data := []struct {
+			name     string
+			r        RequestListPayments
+			expected error
+		}{
+			{"unknown status", RequestListPayments{Status: "lost"}, ErrInvalidRequest},
+			{"unknown channel", RequestListPayments{Channel: "zebit"}, ErrInvalidPaymentChannel},
+			{"from is not before to", RequestListPayments{From: from, To: from}, ErrInvalidRequest},
+			{"cursor is not an id", RequestListPayments{Cursor: "abc"}, ErrInvalidCursor},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+
+				//Action
+				_, err := s.ListPayments(context.Background(), v.r)
+
+				//Assert
+				assert.Equal(t, v.expected, err)
+				assert.Equal(t, 0, len(mp.Filters))
+			})
+		}
+	})
+
+	t.Run("list payments should return storage failure", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetList(nil, errors.New("connection reset"))
+
+		//Action
+		_, err := s.ListPayments(context.Background(), RequestListPayments{})
+
+		//Assert
+		assert.EqualError(t, err, "connection reset")
+	})
+}
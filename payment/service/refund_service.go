@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+// RequestRefund refunds Amount of the payment PaymentID. A zero Amount refunds
+// whatever has not been refunded yet.
+type RequestRefund struct {
+	PaymentID uint         `json:"-"`
+	Amount    money.Amount `json:"amount"`
+	Reason    string       `json:"reason"`
+}
+
+type RefundMessage struct {
+	RefundID  uint                              `json:"refundID"`
+	PaymentID uint                              `json:"paymentID"`
+	OrderID   uint                              `json:"orderID"`
+	Status    constant.PaymentTranasctionStatus `json:"status"`
+	Amount    money.Amount                      `json:"amount"`
+	Reason    string                            `json:"reason"`
+	CreatedAt time.Time                         `json:"createdAt"`
+}
+
+func (s *service) Refund(ctx context.Context, r RequestRefund) (*RefundMessage, error) {
+	if r.Amount.IsNegative() {
+		return nil, ErrInvalidRefundAmount
+	}
+	n := s.c.Now()
+	t := &storage.PaymentTranasction{
+		Model: gorm.Model{
+			UpdatedAt: n,
+		},
+		ParentID: &r.PaymentID,
+		Type:     constant.PaymentTranasctionTypeRefund,
+		Amount:   r.Amount,
+		Reason:   r.Reason,
+	}
+
+	var l *RefundMessage
+	err := s.p.Refund(ctx, t, func(t *storage.PaymentTranasction) (*storage.Outbox, error) {
+		l = &RefundMessage{
+			RefundID:  t.ID,
+			PaymentID: r.PaymentID,
+			OrderID:   t.OrderID,
+			Status:    t.Status,
+			Amount:    t.Amount,
+			Reason:    t.Reason,
+			CreatedAt: n,
+		}
+		return newOutbox(constant.KafkaTopicPaymentRefund, strconv.FormatUint(uint64(t.OrderID), 10), l, n)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, fromStorageError(err)
+	}
+	return l, nil
+}
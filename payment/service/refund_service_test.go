@@ -0,0 +1,111 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/channel"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRefundService(t *testing.T) {
+	var s Service
+	var mp *mockPaymentTranasctionStorage
+	var mt *mockClock
+
+	setup := func() {
+		mp = &mockPaymentTranasctionStorage{}
+		mt = &mockClock{}
+		mt.SetNow(time.Now().UTC())
+		s = NewService(&mockOrderStorage{}, mp, mt, &mockRateProvider{}, channel.NewRegistry(), PaymentConfig{})
+	}
+
+	t.Run("partial refund should create linked refund and publish refund event", func(t *testing.T) {
+		//Arrange
+		setup()
+		r := RequestRefund{PaymentID: 1, Amount: money.MustFromInt(100), Reason: "damaged"}
+		expected := &RefundMessage{
+			RefundID:  99,
+			PaymentID: 1,
+			OrderID:   7,
+			Status:    constant.PaymentTranasctionStatusConfirm,
+			Amount:    money.MustFromInt(100),
+			Reason:    "damaged",
+			CreatedAt: mt.t,
+		}
+
+		//Action
+		actual, err := s.Refund(context.Background(), r)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, uint(1), *mp.Calls[0].ParentID)
+		assert.Equal(t, constant.PaymentTranasctionTypeRefund, mp.Calls[0].Type)
+		assert.Equal(t, constant.KafkaTopicPaymentRefund, mp.Events[0].Topic)
+		assert.Equal(t, "7", mp.Events[0].Key)
+		var l RefundMessage
+		json.Unmarshal([]byte(mp.Events[0].Payload), &l)
+		assert.Equal(t, *expected, l)
+	})
+
+	t.Run("refund without amount should refund remaining amount", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		actual, err := s.Refund(context.Background(), RequestRefund{PaymentID: 1})
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(300), actual.Amount)
+	})
+
+	t.Run("negative refund amount should return invalid refund amount", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.Refund(context.Background(), RequestRefund{PaymentID: 1, Amount: money.MustFromInt(-1)})
+
+		//Assert
+		assert.Equal(t, ErrInvalidRefundAmount, err)
+		assert.Equal(t, 0, len(mp.Calls))
+	})
+
+	t.Run("refund failure should return typed error when", func(t *testing.T) {
+		data := []struct {
+			err      error
+			expected error
+		}{
+			{gorm.ErrRecordNotFound, ErrPaymentNotFound},
+			{storage.ErrPaymentNotRefundable, ErrPaymentNotRefundable},
+			{storage.ErrRefundExceedsAmount, ErrRefundExceedsAmount},
+			{storage.ErrMerchantAmountNotEnough, ErrMerchantAmountNotEnough},
+			{errors.New("unknown error"), errors.New("unknown error")},
+		}
+		for _, v := range data {
+			t.Run(v.err.Error(), func(t *testing.T) {
+				//Arrange
+				setup()
+				mp.SetRefund(v.err)
+
+				//Action
+				_, err := s.Refund(context.Background(), RequestRefund{PaymentID: 1, Amount: money.MustFromInt(100)})
+
+				//Assert
+				assert.Equal(t, v.expected, err)
+			})
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"gorm.io/gorm"
+)
+
+type SettlementMessage struct {
+	SettlementID uint           `json:"settlementID"`
+	MerchantID   uint           `json:"merchantID"`
+	MerchantName string         `json:"merchantName,omitempty"`
+	WindowStart  time.Time      `json:"windowStart"`
+	WindowEnd    time.Time      `json:"windowEnd"`
+	Currency     money.Currency `json:"currency"`
+	PaymentCount int            `json:"paymentCount"`
+	RefundCount  int            `json:"refundCount"`
+	GrossAmount  money.Amount   `json:"grossAmount"`
+	FeeAmount    money.Amount   `json:"feeAmount"`
+	RefundAmount money.Amount   `json:"refundAmount"`
+	NetAmount    money.Amount   `json:"netAmount"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+type SettlementService interface {
+	SettleWindow(ctx context.Context, start, end time.Time) ([]SettlementMessage, error)
+}
+
+type settlementService struct {
+	st storage.SettlementStorage
+	c  clock.Clock
+}
+
+func NewSettlementService(st storage.SettlementStorage, c clock.Clock) SettlementService {
+	return &settlementService{
+		st: st,
+		c:  c,
+	}
+}
+
+func toSettlementMessage(st *storage.Settlement) SettlementMessage {
+	return SettlementMessage{
+		SettlementID: st.ID,
+		MerchantID:   st.MerchantID,
+		MerchantName: st.Merchant.Name,
+		WindowStart:  st.WindowStart,
+		WindowEnd:    st.WindowEnd,
+		Currency:     st.Currency,
+		PaymentCount: st.PaymentCount,
+		RefundCount:  st.RefundCount,
+		GrossAmount:  st.GrossAmount,
+		FeeAmount:    st.FeeAmount,
+		RefundAmount: st.RefundAmount,
+		NetAmount:    st.NetAmount,
+		CreatedAt:    st.CreatedAt,
+	}
+}
+
+// SettleWindow settles every merchant with unsettled transactions confirmed
+// from start up to end and returns all settlements of the window, including
+// the ones an earlier run of the same window made. A merchant that cannot be
+// settled is logged and left for a rerun of the window so it does not hold up
+// the others.
+func (s *settlementService) SettleWindow(ctx context.Context, start, end time.Time) ([]SettlementMessage, error) {
+	if !end.After(start) {
+		return nil, ErrInvalidSettlementWindow
+	}
+	ids, err := s.st.ListUnsettledMerchants(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		n := s.c.Now()
+		st := &storage.Settlement{
+			Model: gorm.Model{
+				CreatedAt: n,
+				UpdatedAt: n,
+			},
+			MerchantID:  id,
+			WindowStart: start,
+			WindowEnd:   end,
+		}
+		err := s.st.Settle(ctx, st, func(st *storage.Settlement) (*storage.Outbox, error) {
+			return newOutbox(constant.KafkaTopicMerchantSettlement, strconv.FormatUint(uint64(st.MerchantID), 10), toSettlementMessage(st), n)
+		})
+		if errors.Is(err, storage.ErrSettlementExists) {
+			continue
+		}
+		if errors.Is(err, storage.ErrMerchantAmountNotEnough) {
+			log.Printf("settle merchant %d: %v", id, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.st.ListSettlements(ctx, end)
+	if err != nil {
+		return nil, err
+	}
+	l := make([]SettlementMessage, 0, len(rows))
+	for i := range rows {
+		l = append(l, toSettlementMessage(&rows[i]))
+	}
+	return l, nil
+}
@@ -0,0 +1,177 @@
+//go:build unit_test
+// +build unit_test
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSettlementStorage struct {
+	Calls     []storage.Settlement
+	Events    []storage.Outbox
+	Start     time.Time
+	End       time.Time
+	merchants []uint
+	settle    map[uint]error
+	rows      []storage.Settlement
+	err       error
+}
+
+func (m *mockSettlementStorage) SetMerchants(ids []uint) {
+	m.merchants = ids
+}
+
+func (m *mockSettlementStorage) SetSettle(id uint, err error) {
+	if m.settle == nil {
+		m.settle = map[uint]error{}
+	}
+	m.settle[id] = err
+}
+
+func (m *mockSettlementStorage) SetSettlements(rows []storage.Settlement, err error) {
+	m.rows = rows
+	m.err = err
+}
+
+func (m *mockSettlementStorage) ListUnsettledMerchants(ctx context.Context, start, end time.Time) ([]uint, error) {
+	m.Start = start
+	m.End = end
+	return m.merchants, nil
+}
+
+func (m *mockSettlementStorage) Settle(ctx context.Context, st *storage.Settlement, event func(*storage.Settlement) (*storage.Outbox, error)) error {
+	if err := m.settle[st.MerchantID]; err != nil {
+		return err
+	}
+	st.ID = uint(len(m.Calls) + 1)
+	st.Currency = money.THB
+	st.PaymentCount = 2
+	st.GrossAmount = money.MustFromInt(300)
+	st.NetAmount = money.MustFromInt(300)
+	m.Calls = append(m.Calls, *st)
+	e, err := event(st)
+	if err != nil {
+		return err
+	}
+	m.Events = append(m.Events, *e)
+	return nil
+}
+
+func (m *mockSettlementStorage) ListSettlements(ctx context.Context, windowEnd time.Time) ([]storage.Settlement, error) {
+	return m.rows, m.err
+}
+
+func TestSettlementService(t *testing.T) {
+	var s SettlementService
+	var ms *mockSettlementStorage
+	var mt *mockClock
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+
+	setup := func() {
+		ms = &mockSettlementStorage{}
+		mt = &mockClock{}
+		mt.SetNow(end.Add(time.Minute))
+		s = NewSettlementService(ms, mt)
+	}
+
+	t.Run("settle window should settle each unsettled merchant and publish settlement event", func(t *testing.T) {
+		//Arrange
+		setup()
+		ms.SetMerchants([]uint{3, 5})
+
+		//Action
+		_, err := s.SettleWindow(context.Background(), start, end)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, start, ms.Start)
+		assert.Equal(t, end, ms.End)
+		assert.Equal(t, 2, len(ms.Calls))
+		assert.Equal(t, uint(3), ms.Calls[0].MerchantID)
+		assert.Equal(t, start, ms.Calls[0].WindowStart)
+		assert.Equal(t, end, ms.Calls[0].WindowEnd)
+		assert.Equal(t, mt.t, ms.Calls[0].CreatedAt)
+		assert.Equal(t, constant.KafkaTopicMerchantSettlement, ms.Events[1].Topic)
+		assert.Equal(t, "5", ms.Events[1].Key)
+		var l SettlementMessage
+		json.Unmarshal([]byte(ms.Events[1].Payload), &l)
+		assert.Equal(t, SettlementMessage{
+			SettlementID: 2,
+			MerchantID:   5,
+			WindowStart:  start,
+			WindowEnd:    end,
+			Currency:     money.THB,
+			PaymentCount: 2,
+			GrossAmount:  money.MustFromInt(300),
+			NetAmount:    money.MustFromInt(300),
+			CreatedAt:    mt.t,
+		}, l)
+	})
+
+	t.Run("settle window should return every settlement of the window", func(t *testing.T) {
+		//Arrange
+		setup()
+		ms.SetSettlements([]storage.Settlement{
+			{MerchantID: 3, Merchant: storage.MerchantProfile{Name: "Rabit Cart"}, NetAmount: money.MustFromInt(100)},
+		}, nil)
+
+		//Action
+		actual, err := s.SettleWindow(context.Background(), start, end)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []SettlementMessage{{MerchantID: 3, MerchantName: "Rabit Cart", NetAmount: money.MustFromInt(100)}}, actual)
+	})
+
+	t.Run("merchant already settled or short of balance should be skipped", func(t *testing.T) {
+		//Arrange
+		setup()
+		ms.SetMerchants([]uint{3, 5, 7})
+		ms.SetSettle(3, storage.ErrSettlementExists)
+		ms.SetSettle(5, storage.ErrMerchantAmountNotEnough)
+
+		//Action
+		_, err := s.SettleWindow(context.Background(), start, end)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(ms.Calls))
+		assert.Equal(t, uint(7), ms.Calls[0].MerchantID)
+	})
+
+	t.Run("storage failure should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		ms.SetMerchants([]uint{3, 5})
+		ms.SetSettle(3, errors.New("unknown error"))
+
+		//Action
+		_, err := s.SettleWindow(context.Background(), start, end)
+
+		//Assert
+		assert.Equal(t, errors.New("unknown error"), err)
+		assert.Equal(t, 0, len(ms.Calls))
+	})
+
+	t.Run("window not ending after it starts should return invalid settlement window", func(t *testing.T) {
+		//Arrange
+		setup()
+
+		//Action
+		_, err := s.SettleWindow(context.Background(), end, start)
+
+		//Assert
+		assert.Equal(t, ErrInvalidSettlementWindow, err)
+	})
+}
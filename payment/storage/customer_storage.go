@@ -1,13 +1,99 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"gorm.io/gorm"
 )
 
 type CustomerProfile struct {
 	gorm.Model
-	Name   string                  `gorm:"type:varchar(100);not null;"`
-	Status constant.CustomerStatus `gorm:"type:varchar(10);not null;"`
-	Amount float64                 `gorm:"not null"`
+	Name     string                  `gorm:"type:varchar(100);not null;"`
+	Status   constant.CustomerStatus `gorm:"type:varchar(10);not null;"`
+	Amount   money.Amount            `gorm:"type:decimal(19,4);not null"`
+	Currency money.Currency          `gorm:"type:varchar(3);not null;default:THB;"`
+	// Part of Amount held by open authorizations and not available to spend
+	HeldAmount money.Amount `gorm:"type:decimal(19,4);not null;default:0;"`
+}
+
+type CustomerStorage interface {
+	GetCustomer(ctx context.Context, id uint) (*CustomerProfile, error)
+	ListCustomers(ctx context.Context, offset, limit int) ([]CustomerProfile, int64, error)
+	CreateCustomer(ctx context.Context, c *CustomerProfile) error
+	UpdateCustomerStatus(ctx context.Context, id uint, status constant.CustomerStatus) error
+	TopUpCustomer(ctx context.Context, id uint, amount money.Amount) (*CustomerProfile, error)
+}
+
+type customerStorage struct {
+	db *gorm.DB
+}
+
+func NewCustomerStorage(db *gorm.DB) CustomerStorage {
+	return &customerStorage{
+		db: db,
+	}
+}
+
+func (s *customerStorage) GetCustomer(ctx context.Context, id uint) (*CustomerProfile, error) {
+	c := &CustomerProfile{}
+	r := s.db.WithContext(ctx).Debug().Where("ID = ?", id).First(c)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return c, nil
+}
+
+func (s *customerStorage) ListCustomers(ctx context.Context, offset, limit int) ([]CustomerProfile, int64, error) {
+	var c []CustomerProfile
+	var total int64
+	if r := s.db.WithContext(ctx).Debug().Model(&CustomerProfile{}).Count(&total); r.Error != nil {
+		return nil, 0, r.Error
+	}
+	r := s.db.WithContext(ctx).Debug().Order("id").Offset(offset).Limit(limit).Find(&c)
+	if r.Error != nil {
+		return nil, 0, r.Error
+	}
+	return c, total, nil
+}
+
+func (s *customerStorage) CreateCustomer(ctx context.Context, c *CustomerProfile) error {
+	r := s.db.WithContext(ctx).Debug().Create(c)
+	return r.Error
+}
+
+func (s *customerStorage) UpdateCustomerStatus(ctx context.Context, id uint, status constant.CustomerStatus) error {
+	r := s.db.WithContext(ctx).Debug().Model(&CustomerProfile{}).Where("id = ?", id).Update("status", status)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TopUpCustomer adds amount to the balance in a single statement so it never
+// overwrites a concurrent payment or refund, and posts it to the ledger.
+func (s *customerStorage) TopUpCustomer(ctx context.Context, id uint, amount money.Amount) (*CustomerProfile, error) {
+	c := &CustomerProfile{}
+	err := s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		r := tx.Model(&CustomerProfile{}).Where("id = ?", id).Update("amount", gorm.Expr("amount + ?", amount))
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if r := tx.First(c, id); r.Error != nil {
+			return r.Error
+		}
+		return post(tx, constant.JournalEntryKindTopUp, topUpReference("customer", id, c.UpdatedAt), c.UpdatedAt,
+			externalLegs(constant.LedgerAccountTypeCustomer, id, c.Currency, amount)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
 }
@@ -0,0 +1,91 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCustomerStorage(t *testing.T) {
+	var ctx context.Context
+	var cs CustomerStorage
+	var c *CustomerProfile
+	var teardown func()
+	var db *gorm.DB
+
+	setup := func() {
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		cs = NewCustomerStorage(db)
+		c = &CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)}
+		if err := cs.CreateCustomer(ctx, c); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	t.Run("top up should add amount to balance", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		actual, err := cs.TopUpCustomer(ctx, c.ID, money.MustParse("250.5"))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustParse("1250.5"), actual.Amount)
+	})
+
+	t.Run("top up unknown customer should return not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		_, err := cs.TopUpCustomer(ctx, c.ID+1, money.MustFromInt(1))
+
+		//Assert
+		assert.Equal(t, gorm.ErrRecordNotFound, err)
+	})
+
+	t.Run("list customers should return page and total", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		cs.CreateCustomer(ctx, &CustomerProfile{Name: "Second", Status: constant.CustomerStatusActive})
+
+		//Action
+		actual, total, err := cs.ListCustomers(ctx, 1, 1)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, 1, len(actual))
+		assert.Equal(t, "Second", actual[0].Name)
+	})
+
+	t.Run("update status should change status", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		err := cs.UpdateCustomerStatus(ctx, c.ID, constant.CustomerStatusInActive)
+
+		//Assert
+		assert.Nil(t, err)
+		actual, _ := cs.GetCustomer(ctx, c.ID)
+		assert.Equal(t, constant.CustomerStatusInActive, actual.Status)
+	})
+}
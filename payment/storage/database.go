@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Driver is the database the storage runs on. Queries are written in the SQL
+// all of them share; what differs between them is kept to this file. SQLite
+// has no decimal type, so money is compared with a column on one side, which
+// makes it convert the bound text, and sums are rounded to the money scale.
+type Driver string
+
+const (
+	DriverSQLServer Driver = "sqlserver"
+	DriverPostgres  Driver = "postgres"
+	// DriverSQLite is an embedded database for development and tests. It keeps
+	// decimals as floating point, so it is not meant for real money.
+	DriverSQLite Driver = "sqlite"
+)
+
+var Drivers = []Driver{DriverSQLServer, DriverPostgres, DriverSQLite}
+
+// sqlitePragmas are set on every SQLite connection. With the busy timeout and
+// transactions taking the write lock up front, concurrent writers wait for
+// each other like they would on a server instead of failing with SQLITE_BUSY.
+var sqlitePragmas = []string{"foreign_keys(1)", "busy_timeout(10000)", "journal_mode(WAL)"}
+
+// Open connects to the database of driver at dsn.
+func Open(driver Driver, dsn string) (*gorm.DB, error) {
+	c := &gorm.Config{TranslateError: true}
+	var d gorm.Dialector
+	switch driver {
+	case DriverSQLServer:
+		d = sqlserver.Open(dsn)
+	case DriverPostgres:
+		d = postgres.Open(dsn)
+	case DriverSQLite:
+		d = sqlite.Open(sqliteDSN(dsn))
+		// SQLite compares times as text, so they must all be in one zone.
+		c.NowFunc = func() time.Time { return time.Now().UTC() }
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", driver)
+	}
+	db, err := gorm.Open(d, c)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open %s: %w", driver, err)
+	}
+	return db, nil
+}
+
+func sqliteDSN(dsn string) string {
+	q := url.Values{}
+	for _, v := range sqlitePragmas {
+		q.Add("_pragma", v)
+	}
+	// No _time_format: the driver ignores _txlock after it, and already writes
+	// times in the SQLite format by default.
+	q.Set("_txlock", "immediate")
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + q.Encode()
+	}
+	return dsn + "?" + q.Encode()
+}
+
+// forUpdate locks the rows a query of model reads until the transaction of tx
+// ends. SQL Server takes a table hint rather than FOR UPDATE; SQLite ignores
+// both as its transactions take the write lock up front.
+func forUpdate(tx *gorm.DB, model any) *gorm.DB {
+	if Driver(tx.Dialector.Name()) != DriverSQLServer {
+		return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	return tx.Table(stmt.Schema.Table + " WITH (UPDLOCK, ROWLOCK)")
+}
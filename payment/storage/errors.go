@@ -0,0 +1,22 @@
+package storage
+
+import "errors"
+
+var (
+	ErrOrderAmountInvalid        = errors.New("order amount must be greater than zero")
+	ErrOrderStatusChanged        = errors.New("order status was changed concurrently")
+	ErrOrderNotRequestPayment    = errors.New("order status is not request payment")
+	ErrCustomerAmountNotEnough   = errors.New("customer amount is not enough")
+	ErrMerchantNotActive         = errors.New("merchant status is not active")
+	ErrPaymentExceedsOutstanding = errors.New("payment amount exceeds outstanding order amount")
+	ErrMerchantAmountNotEnough   = errors.New("merchant amount is not enough")
+	ErrPaymentNotRefundable      = errors.New("payment transaction is not refundable")
+	ErrRefundExceedsAmount       = errors.New("refund amount exceeds remaining amount")
+	ErrCurrencyMismatch          = errors.New("payment currency does not match order currency")
+	ErrPaymentNotPending         = errors.New("payment transaction is not pending")
+	ErrPaymentNotAuthorized      = errors.New("payment transaction is not authorized")
+	ErrHoldExpired               = errors.New("hold of authorized payment expired")
+	ErrHeldAmountNotEnough       = errors.New("customer held amount is less than hold")
+	ErrSettlementExists          = errors.New("merchant is already settled for the window")
+	ErrUnbalancedEntry           = errors.New("journal entry postings do not sum to zero")
+)
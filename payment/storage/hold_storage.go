@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"gorm.io/gorm"
+)
+
+// Hold reserves part of a customer's amount for an authorized payment until
+// it is captured, voided or expires.
+type Hold struct {
+	gorm.Model
+	PaymentTranasctionID uint                `gorm:"not null;uniqueIndex"`
+	CustomerID           uint                `gorm:"not null;index"`
+	Amount               money.Amount        `gorm:"type:decimal(19,4);not null;"`
+	Currency             money.Currency      `gorm:"type:varchar(3);not null;default:THB;"`
+	Status               constant.HoldStatus `gorm:"type:varchar(10);not null;index"`
+	ExpiresAt            time.Time           `gorm:"not null;index"`
+
+	// Relation
+	PaymentTranasction PaymentTranasction `gorm:"foreignKey:PaymentTranasctionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Customer           CustomerProfile    `gorm:"foreignKey:CustomerID"`
+}
+
+// Authorize stores the authorized payment and holds its settled amount on
+// the customer so it cannot be spent twice. The order is locked like for a
+// confirm so the authorization can never exceed the outstanding amount.
+func (s *paymentTranasctionStorage) Authorize(ctx context.Context, o *Order, p *PaymentTranasction, h *Hold, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		_, outstanding, err := lockOutstanding(tx, o, p)
+		if err != nil {
+			return err
+		}
+		if p.Amount.Cmp(outstanding) > 0 {
+			return ErrPaymentExceedsOutstanding
+		}
+
+		r := tx.Model(&CustomerProfile{}).
+			Where("id = ? AND amount >= held_amount + ?", o.CustomerID, h.Amount).
+			Updates(map[string]any{"held_amount": gorm.Expr("held_amount + ?", h.Amount), "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrCustomerAmountNotEnough
+		}
+
+		if r := tx.Save(p); r.Error != nil {
+			return r.Error
+		}
+		h.PaymentTranasctionID = p.ID
+		h.CustomerID = o.CustomerID
+		if r := tx.Create(h); r.Error != nil {
+			return r.Error
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// GetHold returns the hold of the authorized payment paymentID while it is
+// still held.
+func (s *paymentTranasctionStorage) GetHold(ctx context.Context, paymentID uint) (*Hold, error) {
+	h := &Hold{}
+	r := s.db.WithContext(ctx).Debug().
+		Where("payment_tranasction_id = ? AND status = ?", paymentID, constant.HoldStatusHeld).
+		First(h)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return h, nil
+}
+
+// Capture books an authorized payment for p.Amount, which may be less than
+// was authorized. The customer pays p.SettledAmount and the rest of the hold
+// is released. A hold that expired at p.UpdatedAt cannot be captured.
+func (s *paymentTranasctionStorage) Capture(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		if err := book(tx, o, p); err != nil {
+			return err
+		}
+
+		r := tx.Model(&PaymentTranasction{}).
+			Where("id = ? AND status = ?", p.ID, constant.PaymentTranasctionStatusAuthorized).
+			Updates(map[string]any{
+				"status":         constant.PaymentTranasctionStatusConfirm,
+				"amount":         p.Amount,
+				"settled_amount": p.SettledAmount,
+				"fee_amount":     p.FeeAmount,
+				"net_amount":     p.NetAmount,
+				"updated_at":     p.UpdatedAt,
+				"confirmed_at":   p.UpdatedAt,
+			})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrPaymentNotAuthorized
+		}
+		confirm(p)
+
+		h, err := releaseHold(tx, p, constant.HoldStatusCaptured)
+		if err != nil {
+			return err
+		}
+		r = tx.Model(&CustomerProfile{}).
+			Where("id = ? AND amount >= ? AND held_amount >= ?", h.CustomerID, p.SettledAmount, h.Amount).
+			Updates(map[string]any{
+				"amount":      gorm.Expr("amount - ?", p.SettledAmount),
+				"held_amount": gorm.Expr("held_amount - ?", h.Amount),
+				"updated_at":  p.UpdatedAt,
+			})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrCustomerAmountNotEnough
+		}
+
+		if err := creditMerchant(tx, o, p); err != nil {
+			return err
+		}
+		err = post(tx, constant.JournalEntryKindPayment, reference("payment", p.ID), p.UpdatedAt,
+			paymentLegs(constant.LedgerAccountTypeCustomer, h.CustomerID, o.MerchantID, p)...)
+		if err != nil {
+			return err
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// Void releases the hold of an authorized payment without moving any money.
+func (s *paymentTranasctionStorage) Void(ctx context.Context, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		r := tx.Model(&PaymentTranasction{}).
+			Where("id = ? AND status = ?", p.ID, constant.PaymentTranasctionStatusAuthorized).
+			Updates(map[string]any{"status": constant.PaymentTranasctionStatusVoid, "reason": p.Reason, "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrPaymentNotAuthorized
+		}
+		p.Status = constant.PaymentTranasctionStatusVoid
+
+		h, err := releaseHold(tx, p, constant.HoldStatusVoided)
+		if err != nil {
+			return err
+		}
+		r = tx.Model(&CustomerProfile{}).
+			Where("id = ? AND held_amount >= ?", h.CustomerID, h.Amount).
+			Updates(map[string]any{"held_amount": gorm.Expr("held_amount - ?", h.Amount), "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrHeldAmountNotEnough
+		}
+
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// ListExpiredHolds returns up to limit authorized payments whose hold expired
+// at now, oldest first.
+func (s *paymentTranasctionStorage) ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]PaymentTranasction, error) {
+	var rows []PaymentTranasction
+	r := s.db.WithContext(ctx).Debug().
+		Joins("JOIN holds ON holds.payment_tranasction_id = payment_tranasctions.id").
+		Where("payment_tranasctions.status = ? AND holds.status = ? AND holds.expires_at <= ?", constant.PaymentTranasctionStatusAuthorized, constant.HoldStatusHeld, now).
+		Order("holds.expires_at, payment_tranasctions.id").
+		Limit(limit).
+		Find(&rows)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return rows, nil
+}
+
+// releaseHold moves the hold of p from held to status to. A capture only
+// claims a hold that has not expired at p.UpdatedAt, a void releases it either
+// way.
+func releaseHold(tx *gorm.DB, p *PaymentTranasction, to constant.HoldStatus) (*Hold, error) {
+	h := &Hold{}
+	if r := tx.Where("payment_tranasction_id = ? AND status = ?", p.ID, constant.HoldStatusHeld).First(h); r.Error != nil {
+		return nil, r.Error
+	}
+	q := tx.Model(&Hold{}).Where("id = ? AND status = ?", h.ID, constant.HoldStatusHeld)
+	if to == constant.HoldStatusCaptured {
+		if !h.ExpiresAt.After(p.UpdatedAt) {
+			return nil, ErrHoldExpired
+		}
+		q = q.Where("expires_at > ?", p.UpdatedAt)
+	}
+	r := q.Updates(map[string]any{"status": to, "updated_at": p.UpdatedAt})
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	if r.RowsAffected == 0 {
+		return nil, ErrPaymentNotAuthorized
+	}
+	return h, nil
+}
@@ -0,0 +1,255 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestHoldStorage(t *testing.T) {
+	var ctx context.Context
+	var pt PaymentTranasctionStorage
+	var o *Order
+	var teardown func()
+	var db *gorm.DB
+	var cl clock.Clock
+
+	setup := func() {
+		cl = clock.NewClock()
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		pt = NewPaymentTranasctionStorage(db)
+		o = &Order{
+			Customer: CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+		}
+		ot := NewOrderStorage(db)
+		if err := ot.Save(ctx, o); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, ""); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	event := func() *Outbox {
+		return &Outbox{Topic: constant.KafkaTopicPaymentTransaction, Payload: "{}", Status: constant.OutboxStatusPending, NextAttemptAt: cl.Now()}
+	}
+
+	authorize := func(amount money.Amount) (*PaymentTranasction, error) {
+		n := cl.Now()
+		p := &PaymentTranasction{
+			Model:   gorm.Model{UpdatedAt: n},
+			OrderID: o.ID,
+			Type:    constant.PaymentTranasctionTypePayment,
+			Amount:  amount,
+			Channel: constant.PaymentChannelCredit,
+			Status:  constant.PaymentTranasctionStatusAuthorized,
+		}
+		h := &Hold{Amount: amount, Currency: money.THB, Status: constant.HoldStatusHeld, ExpiresAt: n.Add(time.Hour)}
+		return p, pt.Authorize(ctx, o, p, h, event())
+	}
+
+	customer := func() CustomerProfile {
+		var c CustomerProfile
+		db.First(&c, o.CustomerID)
+		return c
+	}
+
+	t.Run("authorize should hold amount without spending it", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		p, err := authorize(money.MustFromInt(400))
+
+		//Assert
+		assert.Nil(t, err)
+		c := customer()
+		assert.Equal(t, money.MustFromInt(1000), c.Amount)
+		assert.Equal(t, money.MustFromInt(400), c.HeldAmount)
+		var h Hold
+		db.Where("payment_tranasction_id = ?", p.ID).First(&h)
+		assert.Equal(t, constant.HoldStatusHeld, h.Status)
+	})
+
+	t.Run("authorize over available amount should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&CustomerProfile{}).Where("id = ?", o.CustomerID).Update("held_amount", money.MustFromInt(700))
+
+		//Action
+		_, err := authorize(money.MustFromInt(400))
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, err)
+	})
+
+	t.Run("partial capture should spend captured amount and release the rest", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		p.Amount = money.MustFromInt(150)
+		p.SettledAmount = money.MustFromInt(150)
+
+		//Action
+		err := pt.Capture(ctx, o, p, event())
+
+		//Assert
+		assert.Nil(t, err)
+		c := customer()
+		var m MerchantProfile
+		var stored PaymentTranasction
+		var h Hold
+		db.First(&m, o.MerchantID)
+		db.First(&stored, p.ID)
+		db.Where("payment_tranasction_id = ?", p.ID).First(&h)
+		assert.Equal(t, money.MustFromInt(850), c.Amount)
+		assert.Equal(t, money.Amount{}, c.HeldAmount)
+		assert.Equal(t, money.MustFromInt(250), m.Amount)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, stored.Status)
+		assert.Equal(t, money.MustFromInt(150), stored.Amount)
+		assert.Equal(t, constant.HoldStatusCaptured, h.Status)
+	})
+
+	t.Run("capture of expired hold should fail and keep hold", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		p.UpdatedAt = p.UpdatedAt.Add(time.Hour)
+		p.SettledAmount = p.Amount
+
+		//Action
+		err := pt.Capture(ctx, o, p, event())
+
+		//Assert
+		assert.Equal(t, ErrHoldExpired, err)
+		c := customer()
+		var stored PaymentTranasction
+		var h Hold
+		db.First(&stored, p.ID)
+		db.Where("payment_tranasction_id = ?", p.ID).First(&h)
+		assert.Equal(t, money.MustFromInt(1000), c.Amount)
+		assert.Equal(t, money.MustFromInt(400), c.HeldAmount)
+		assert.Equal(t, constant.PaymentTranasctionStatusAuthorized, stored.Status)
+		assert.Equal(t, constant.HoldStatusHeld, h.Status)
+	})
+
+	t.Run("void should release hold once", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		p.Reason = "authorization voided"
+
+		//Action
+		err1 := pt.Void(ctx, p, event())
+		err2 := pt.Void(ctx, p, event())
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Equal(t, ErrPaymentNotAuthorized, err2)
+		c := customer()
+		assert.Equal(t, money.MustFromInt(1000), c.Amount)
+		assert.Equal(t, money.Amount{}, c.HeldAmount)
+		assert.Equal(t, ErrPaymentNotAuthorized, pt.Capture(ctx, o, p, event()))
+	})
+
+	t.Run("void of hold missing from held amount should fail and keep hold", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		db.Model(&CustomerProfile{}).Where("id = ?", o.CustomerID).Update("held_amount", money.MustFromInt(100))
+
+		//Action
+		err := pt.Void(ctx, p, event())
+
+		//Assert
+		assert.Equal(t, ErrHeldAmountNotEnough, err)
+		var stored PaymentTranasction
+		var h Hold
+		db.First(&stored, p.ID)
+		db.Where("payment_tranasction_id = ?", p.ID).First(&h)
+		assert.Equal(t, money.MustFromInt(100), customer().HeldAmount)
+		assert.Equal(t, constant.PaymentTranasctionStatusAuthorized, stored.Status)
+		assert.Equal(t, constant.HoldStatusHeld, h.Status)
+	})
+
+	t.Run("list expired holds should return authorizations past expiry", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		var h Hold
+		db.Where("payment_tranasction_id = ?", p.ID).First(&h)
+
+		//Action
+		expired, err1 := pt.ListExpiredHolds(ctx, h.ExpiresAt, 10)
+		fresh, err2 := pt.ListExpiredHolds(ctx, h.ExpiresAt.Add(-1), 10)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, 1, len(expired))
+		assert.Equal(t, p.ID, expired[0].ID)
+		assert.Equal(t, 0, len(fresh))
+	})
+	t.Run("get hold should return held hold until it is released", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+
+		//Action
+		h, err1 := pt.GetHold(ctx, p.ID)
+		pt.Void(ctx, p, event())
+		_, err2 := pt.GetHold(ctx, p.ID)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Equal(t, money.MustFromInt(400), h.Amount)
+		assert.Equal(t, gorm.ErrRecordNotFound, err2)
+	})
+
+	t.Run("reconcile should save one open record of each kind for the payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, _ := authorize(money.MustFromInt(400))
+		r := &Reconciliation{PaymentTranasctionID: p.ID, Kind: constant.ReconciliationKindCaptureNotBooked, Channel: p.Channel, ProviderRef: "auth-1", Amount: money.MustFromInt(400), Currency: money.THB, Reason: "hold expired"}
+
+		//Action
+		err1 := pt.Reconcile(ctx, r)
+		err2 := pt.Reconcile(ctx, &Reconciliation{PaymentTranasctionID: p.ID, Kind: constant.ReconciliationKindCaptureNotBooked, Channel: p.Channel, Amount: money.MustFromInt(400), Currency: money.THB})
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		var stored []Reconciliation
+		db.Find(&stored)
+		assert.Equal(t, 1, len(stored))
+		assert.Equal(t, constant.ReconciliationStatusOpen, stored[0].Status)
+		assert.Equal(t, p.ID, stored[0].PaymentTranasctionID)
+		assert.Equal(t, money.MustFromInt(400), stored[0].Amount)
+		assert.Equal(t, "hold expired", stored[0].Reason)
+	})
+}
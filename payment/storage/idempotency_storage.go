@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IdempotencyKey struct {
+	Key         string `gorm:"type:varchar(255);primaryKey"`
+	Fingerprint string `gorm:"type:varchar(64);not null;"`
+	Completed   bool   `gorm:"not null;"`
+	StatusCode  int
+	ContentType string `gorm:"type:varchar(100);"`
+	Response    string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+var ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+type IdempotencyStorage interface {
+	Get(ctx context.Context, key string) (*IdempotencyKey, error)
+	Create(ctx context.Context, k *IdempotencyKey) error
+	TakeOver(ctx context.Context, k *IdempotencyKey, staleBefore time.Time) error
+	Complete(ctx context.Context, k *IdempotencyKey) error
+	Delete(ctx context.Context, k *IdempotencyKey) error
+}
+
+type idempotencyStorage struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyStorage(db *gorm.DB) IdempotencyStorage {
+	return &idempotencyStorage{
+		db: db,
+	}
+}
+
+func (s *idempotencyStorage) Get(ctx context.Context, key string) (*IdempotencyKey, error) {
+	k := &IdempotencyKey{}
+	r := s.db.WithContext(ctx).Debug().Where(&IdempotencyKey{Key: key}).First(k)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return k, nil
+}
+
+// Create claims the key for an in-flight request. It returns ErrIdempotencyKeyExists
+// when another request already claimed it, so only one of them reaches the service.
+// The duplicate check relies on gorm.Config.TranslateError being enabled.
+func (s *idempotencyStorage) Create(ctx context.Context, k *IdempotencyKey) error {
+	r := s.db.WithContext(ctx).Debug().Create(k)
+	if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+		return ErrIdempotencyKeyExists
+	}
+	return r.Error
+}
+
+// TakeOver claims a key that is still in progress but was created before
+// staleBefore, as when the request holding it died, for a request with the
+// same fingerprint. The key is created anew at k.CreatedAt. It returns
+// ErrIdempotencyKeyExists when the key was completed, released or taken over
+// in the meantime.
+func (s *idempotencyStorage) TakeOver(ctx context.Context, k *IdempotencyKey, staleBefore time.Time) error {
+	r := s.db.WithContext(ctx).Debug().Model(&IdempotencyKey{}).
+		Where(&IdempotencyKey{Key: k.Key, Fingerprint: k.Fingerprint}).
+		Where("completed = ? AND created_at < ?", false, staleBefore).
+		Updates(map[string]any{"created_at": k.CreatedAt, "updated_at": k.CreatedAt})
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+func (s *idempotencyStorage) Complete(ctx context.Context, k *IdempotencyKey) error {
+	r := s.db.WithContext(ctx).Debug().Model(k).Updates(map[string]any{
+		"completed":    true,
+		"status_code":  k.StatusCode,
+		"content_type": k.ContentType,
+		"response":     k.Response,
+	})
+	return r.Error
+}
+
+func (s *idempotencyStorage) Delete(ctx context.Context, k *IdempotencyKey) error {
+	r := s.db.WithContext(ctx).Debug().Unscoped().Delete(k)
+	return r.Error
+}
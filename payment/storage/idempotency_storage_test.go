@@ -0,0 +1,103 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestIdempotencyStorage(t *testing.T) {
+	var ctx context.Context
+	var s IdempotencyStorage
+	var teardown func()
+	var db *gorm.DB
+	var now time.Time
+
+	setup := func() {
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		s = NewIdempotencyStorage(db)
+		now = time.Now().UTC().Truncate(time.Second)
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	key := func(createdAt time.Time) *IdempotencyKey {
+		return &IdempotencyKey{Key: "key-1", Fingerprint: "f-1", CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+
+	t.Run("create duplicate key should return key exists", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		if err := s.Create(ctx, key(now)); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+
+		//Action
+		err := s.Create(ctx, key(now))
+
+		//Assert
+		assert.Equal(t, ErrIdempotencyKeyExists, err)
+	})
+
+	t.Run("take over key in progress past stale time should claim it anew", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		s.Create(ctx, key(now.Add(-time.Hour)))
+
+		//Action
+		err := s.TakeOver(ctx, key(now), now.Add(-time.Minute))
+
+		//Assert
+		assert.Nil(t, err)
+		k, _ := s.Get(ctx, "key-1")
+		assert.True(t, k.CreatedAt.Equal(now))
+		assert.Equal(t, ErrIdempotencyKeyExists, s.TakeOver(ctx, key(now), now.Add(-time.Minute)))
+	})
+
+	t.Run("take over should fail when key", func(t *testing.T) {
+		data := []struct {
+			name    string
+			arrange func()
+			k       func() *IdempotencyKey
+		}{
+			{"is still fresh", func() { s.Create(ctx, key(now)) }, func() *IdempotencyKey { return key(now) }},
+			{"is completed", func() {
+				k := key(now.Add(-time.Hour))
+				s.Create(ctx, k)
+				k.StatusCode = 200
+				s.Complete(ctx, k)
+			}, func() *IdempotencyKey { return key(now) }},
+			{"has another fingerprint", func() { s.Create(ctx, key(now.Add(-time.Hour))) }, func() *IdempotencyKey {
+				k := key(now)
+				k.Fingerprint = "f-2"
+				return k
+			}},
+			{"does not exist", func() {}, func() *IdempotencyKey { return key(now) }},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+				defer cleanup()
+				v.arrange()
+
+				//Action
+				err := s.TakeOver(ctx, v.k(), now.Add(-time.Minute))
+
+				//Assert
+				assert.Equal(t, ErrIdempotencyKeyExists, err)
+			})
+		}
+	})
+}
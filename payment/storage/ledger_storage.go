@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerAccount holds the money of one owner in one currency. The fee, fx
+// and external accounts belong to the platform and have no owner.
+type LedgerAccount struct {
+	gorm.Model
+	Type     constant.LedgerAccountType `gorm:"type:varchar(10);not null;uniqueIndex:idx_ledger_account;"`
+	OwnerID  uint                       `gorm:"not null;uniqueIndex:idx_ledger_account;"`
+	Currency money.Currency             `gorm:"type:varchar(3);not null;uniqueIndex:idx_ledger_account;"`
+}
+
+// JournalEntry is one movement of money between accounts. Its postings sum
+// to zero in every currency.
+type JournalEntry struct {
+	gorm.Model
+	Kind      constant.JournalEntryKind `gorm:"type:varchar(20);not null;"`
+	Reference string                    `gorm:"type:varchar(64);not null;index;"`
+
+	// Relation
+	Postings []Posting
+}
+
+// Posting changes the balance of an account by Amount, which is negative
+// when money leaves the account.
+type Posting struct {
+	gorm.Model
+	JournalEntryID uint           `gorm:"not null;index;"`
+	AccountID      uint           `gorm:"not null;index;"`
+	Amount         money.Amount   `gorm:"type:decimal(19,4);not null;"`
+	Currency       money.Currency `gorm:"type:varchar(3);not null;"`
+
+	// Relation
+	Account LedgerAccount `gorm:"foreignKey:AccountID"`
+}
+
+// LedgerDrift is a customer or merchant whose balance column no longer
+// matches the sum of its postings.
+type LedgerDrift struct {
+	AccountType   constant.LedgerAccountType
+	OwnerID       uint
+	Currency      money.Currency
+	ProfileAmount money.Amount
+	LedgerAmount  money.Amount
+}
+
+type LedgerStorage interface {
+	OpenAccounts(ctx context.Context, at time.Time) (int, error)
+	ListDrifts(ctx context.Context) ([]LedgerDrift, error)
+	ListUnbalancedEntries(ctx context.Context) ([]uint, error)
+}
+
+type ledgerStorage struct {
+	db *gorm.DB
+}
+
+func NewLedgerStorage(db *gorm.DB) LedgerStorage {
+	return &ledgerStorage{
+		db: db,
+	}
+}
+
+// OpenAccounts posts the opening balance of every customer and merchant that
+// holds money but has no ledger account yet, i.e. balances from before the
+// ledger existed, and returns how many accounts it opened.
+func (s *ledgerStorage) OpenAccounts(ctx context.Context, at time.Time) (int, error) {
+	opened := 0
+	err := s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		for _, v := range profileTables {
+			var rows []profileBalance
+			r := tx.Table(v.table).
+				Select("id, currency, amount").
+				Where("deleted_at IS NULL AND amount <> 0").
+				Where("NOT EXISTS (SELECT 1 FROM ledger_accounts a WHERE a.type = ? AND a.owner_id = "+v.table+".id AND a.deleted_at IS NULL)", v.typ).
+				Scan(&rows)
+			if r.Error != nil {
+				return r.Error
+			}
+			for _, p := range rows {
+				err := post(tx, constant.JournalEntryKindOpening, reference(string(v.typ), p.ID), at, externalLegs(v.typ, p.ID, p.Currency, p.Amount)...)
+				if err != nil {
+					return err
+				}
+				opened++
+			}
+		}
+		return nil
+	})
+	return opened, err
+}
+
+// ListDrifts returns the customers and merchants whose balance differs from
+// their ledger balance in the currency of the profile.
+func (s *ledgerStorage) ListDrifts(ctx context.Context) ([]LedgerDrift, error) {
+	var drifts []LedgerDrift
+	for _, v := range profileTables {
+		var rows []LedgerDrift
+		r := s.db.WithContext(ctx).Debug().Raw(`SELECT ? AS account_type, p.id AS owner_id, p.currency AS currency, p.amount AS profile_amount, COALESCE(SUM(ps.amount), 0) AS ledger_amount
+FROM `+v.table+` p
+LEFT JOIN ledger_accounts a ON a.type = ? AND a.owner_id = p.id AND a.currency = p.currency AND a.deleted_at IS NULL
+LEFT JOIN postings ps ON ps.account_id = a.id AND ps.deleted_at IS NULL
+WHERE p.deleted_at IS NULL
+GROUP BY p.id, p.currency, p.amount
+HAVING ROUND(p.amount, 4) <> ROUND(COALESCE(SUM(ps.amount), 0), 4)
+ORDER BY p.id`, v.typ, v.typ).Scan(&rows)
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		drifts = append(drifts, rows...)
+	}
+	return drifts, nil
+}
+
+// ListUnbalancedEntries returns the journal entries whose postings do not sum
+// to zero in some currency, which post never writes.
+func (s *ledgerStorage) ListUnbalancedEntries(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	r := s.db.WithContext(ctx).Debug().Model(&Posting{}).
+		Group("journal_entry_id, currency").
+		Having("ROUND(SUM(amount), 4) <> 0").
+		Order("journal_entry_id").
+		Pluck("journal_entry_id", &ids)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return ids, nil
+}
+
+type profileBalance struct {
+	ID       uint
+	Currency money.Currency
+	Amount   money.Amount
+}
+
+var profileTables = []struct {
+	table string
+	typ   constant.LedgerAccountType
+}{
+	{"customer_profiles", constant.LedgerAccountTypeCustomer},
+	{"merchant_profiles", constant.LedgerAccountTypeMerchant},
+}
+
+type leg struct {
+	typ      constant.LedgerAccountType
+	owner    uint
+	currency money.Currency
+	amount   money.Amount
+}
+
+type accountKey struct {
+	typ      constant.LedgerAccountType
+	owner    uint
+	currency money.Currency
+}
+
+// post writes a journal entry moving money between the accounts of legs,
+// opening accounts on first use. Legs of the same account are merged, and an
+// entry that does not balance in every currency is refused so money is never
+// created or lost.
+func post(tx *gorm.DB, kind constant.JournalEntryKind, ref string, at time.Time, legs ...leg) error {
+	var keys []accountKey
+	amounts := map[accountKey]money.Amount{}
+	sums := map[money.Currency]money.Amount{}
+	for _, l := range legs {
+		k := accountKey{l.typ, l.owner, l.currency}
+		if _, ok := amounts[k]; !ok {
+			keys = append(keys, k)
+		}
+		a, err := amounts[k].Add(l.amount)
+		if err != nil {
+			return err
+		}
+		sum, err := sums[l.currency].Add(l.amount)
+		if err != nil {
+			return err
+		}
+		amounts[k], sums[l.currency] = a, sum
+	}
+	for _, v := range sums {
+		if !v.IsZero() {
+			return ErrUnbalancedEntry
+		}
+	}
+
+	var postings []Posting
+	for _, k := range keys {
+		if amounts[k].IsZero() {
+			continue
+		}
+		a := &LedgerAccount{}
+		r := tx.Where("type = ? AND owner_id = ? AND currency = ?", k.typ, k.owner, k.currency).
+			Attrs(LedgerAccount{Type: k.typ, OwnerID: k.owner, Currency: k.currency}).
+			FirstOrCreate(a)
+		if r.Error != nil {
+			return r.Error
+		}
+		postings = append(postings, Posting{Model: gorm.Model{CreatedAt: at, UpdatedAt: at}, AccountID: a.ID, Amount: amounts[k], Currency: k.currency})
+	}
+	if len(postings) == 0 {
+		return nil
+	}
+	e := &JournalEntry{Model: gorm.Model{CreatedAt: at, UpdatedAt: at}, Kind: kind, Reference: ref}
+	if r := tx.Create(e); r.Error != nil {
+		return r.Error
+	}
+	for i := range postings {
+		postings[i].JournalEntryID = e.ID
+	}
+	if r := tx.Omit(clause.Associations).Create(&postings); r.Error != nil {
+		return r.Error
+	}
+	return nil
+}
+
+// paymentLegs moves p from the payer to the merchant and the fee account,
+// through fx when the payer paid in another currency than the order.
+func paymentLegs(payer constant.LedgerAccountType, payerID, merchantID uint, p *PaymentTranasction) []leg {
+	return []leg{
+		{payer, payerID, p.SettledCurrency, p.SettledAmount.Neg()},
+		{constant.LedgerAccountTypeFX, 0, p.SettledCurrency, p.SettledAmount},
+		{constant.LedgerAccountTypeFX, 0, p.Currency, p.Amount.Neg()},
+		{constant.LedgerAccountTypeMerchant, merchantID, p.Currency, p.NetAmount},
+		{constant.LedgerAccountTypeFee, 0, p.Currency, p.FeeAmount},
+	}
+}
+
+// refundLegs returns the refund p from the merchant to the customer at the
+// rate of the original payment. The fee is not returned.
+func refundLegs(customerID, merchantID uint, p *PaymentTranasction) []leg {
+	return []leg{
+		{constant.LedgerAccountTypeMerchant, merchantID, p.Currency, p.Amount.Neg()},
+		{constant.LedgerAccountTypeFX, 0, p.Currency, p.Amount},
+		{constant.LedgerAccountTypeFX, 0, p.SettledCurrency, p.SettledAmount.Neg()},
+		{constant.LedgerAccountTypeCustomer, customerID, p.SettledCurrency, p.SettledAmount},
+	}
+}
+
+// externalLegs moves amount between the outside world and an account, in
+// when amount is positive and out when negative.
+func externalLegs(typ constant.LedgerAccountType, owner uint, c money.Currency, amount money.Amount) []leg {
+	return []leg{
+		{constant.LedgerAccountTypeExternal, 0, c, amount.Neg()},
+		{typ, owner, c, amount},
+	}
+}
+
+func reference(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// topUpReference tells apart the top-ups of an account, and them from its
+// opening entry, by the time the balance changed.
+func topUpReference(kind string, id uint, at time.Time) string {
+	return fmt.Sprintf("topup:%s:%d:%d", kind, id, at.UnixNano())
+}
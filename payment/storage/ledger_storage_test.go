@@ -0,0 +1,225 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestLedgerStorage(t *testing.T) {
+	var ctx context.Context
+	var pt PaymentTranasctionStorage
+	var ls LedgerStorage
+	var o *Order
+	var teardown func()
+	var db *gorm.DB
+	var cl clock.Clock
+
+	setup := func() {
+		cl = clock.NewClock()
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		pt = NewPaymentTranasctionStorage(db)
+		ls = NewLedgerStorage(db)
+		o = &Order{
+			Customer: CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+		}
+		ot := NewOrderStorage(db)
+		if err := ot.Save(ctx, o); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, ""); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if _, err := ls.OpenAccounts(ctx, cl.Now()); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	event := func() *Outbox {
+		return &Outbox{Topic: constant.KafkaTopicPaymentTransaction, Payload: "{}", Status: constant.OutboxStatusPending, NextAttemptAt: cl.Now()}
+	}
+
+	balance := func(typ constant.LedgerAccountType, owner uint, c money.Currency) money.Amount {
+		var v money.Amount
+		db.Model(&Posting{}).
+			Select("COALESCE(SUM(postings.amount), 0)").
+			Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+			Where("ledger_accounts.type = ? AND ledger_accounts.owner_id = ? AND ledger_accounts.currency = ?", typ, owner, c).
+			Scan(&v)
+		return v
+	}
+
+	t.Run("open accounts should post opening balances once", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		n, err := ls.OpenAccounts(ctx, cl.Now())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, money.MustFromInt(1000), balance(constant.LedgerAccountTypeCustomer, o.CustomerID, money.THB))
+		assert.Equal(t, money.MustFromInt(100), balance(constant.LedgerAccountTypeMerchant, o.MerchantID, money.THB))
+		assert.Equal(t, money.MustFromInt(-1100), balance(constant.LedgerAccountTypeExternal, 0, money.THB))
+	})
+
+	t.Run("payment with fee should post balanced entry and keep balances reconciled", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p := &PaymentTranasction{
+			Model:     gorm.Model{UpdatedAt: cl.Now()},
+			OrderID:   o.ID,
+			Amount:    money.MustFromInt(400),
+			FeeAmount: money.MustFromInt(10),
+			Channel:   constant.PaymentChannelDebit,
+			Status:    constant.PaymentTranasctionStatusConfirm,
+		}
+
+		//Action
+		err := pt.Confirm(ctx, o, p, event())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(600), balance(constant.LedgerAccountTypeCustomer, o.CustomerID, money.THB))
+		assert.Equal(t, money.MustFromInt(490), balance(constant.LedgerAccountTypeMerchant, o.MerchantID, money.THB))
+		assert.Equal(t, money.MustFromInt(10), balance(constant.LedgerAccountTypeFee, 0, money.THB))
+		assert.Equal(t, money.Amount{}, balance(constant.LedgerAccountTypeFX, 0, money.THB))
+		var e JournalEntry
+		db.Where("reference = ?", reference("payment", p.ID)).First(&e)
+		assert.Equal(t, constant.JournalEntryKindPayment, e.Kind)
+		drifts, _ := ls.ListDrifts(ctx)
+		unbalanced, _ := ls.ListUnbalancedEntries(ctx)
+		assert.Equal(t, 0, len(drifts))
+		assert.Equal(t, 0, len(unbalanced))
+	})
+
+	t.Run("converted payment and refund should pass through fx", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&Order{}).Where("id = ?", o.ID).Update("currency", money.USD)
+		db.Model(&MerchantProfile{}).Where("id = ?", o.MerchantID).Update("currency", money.USD)
+		ls.OpenAccounts(ctx, cl.Now())
+		p := &PaymentTranasction{
+			Model:           gorm.Model{UpdatedAt: cl.Now()},
+			OrderID:         o.ID,
+			Amount:          money.MustFromInt(10),
+			Currency:        money.USD,
+			SettledAmount:   money.MustParse("362.5"),
+			SettledCurrency: money.THB,
+			Rate:            money.MustParseRate("36.25"),
+			Channel:         constant.PaymentChannelDebit,
+			Status:          constant.PaymentTranasctionStatusConfirm,
+		}
+		pt.Confirm(ctx, o, p, event())
+		parent := p.ID
+		r := &PaymentTranasction{Model: gorm.Model{UpdatedAt: cl.Now()}, ParentID: &parent}
+
+		//Action
+		err := pt.Refund(ctx, r, func(*PaymentTranasction) (*Outbox, error) { return event(), nil })
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(1000), balance(constant.LedgerAccountTypeCustomer, o.CustomerID, money.THB))
+		assert.Equal(t, money.Amount{}, balance(constant.LedgerAccountTypeFX, 0, money.THB))
+		assert.Equal(t, money.Amount{}, balance(constant.LedgerAccountTypeFX, 0, money.USD))
+		unbalanced, _ := ls.ListUnbalancedEntries(ctx)
+		assert.Equal(t, 0, len(unbalanced))
+	})
+
+	t.Run("top up should post from external account", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		_, err := NewCustomerStorage(db).TopUpCustomer(ctx, o.CustomerID, money.MustFromInt(50))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(1050), balance(constant.LedgerAccountTypeCustomer, o.CustomerID, money.THB))
+		drifts, _ := ls.ListDrifts(ctx)
+		assert.Equal(t, 0, len(drifts))
+	})
+
+	t.Run("top ups should each post under own reference", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		cs, ms := NewCustomerStorage(db), NewMerchantStorage(db)
+
+		//Action
+		_, err1 := cs.TopUpCustomer(ctx, o.CustomerID, money.MustFromInt(50))
+		_, err2 := cs.TopUpCustomer(ctx, o.CustomerID, money.MustFromInt(50))
+		_, err3 := ms.TopUpMerchant(ctx, o.MerchantID, money.MustFromInt(50))
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Nil(t, err3)
+		var refs []string
+		db.Model(&JournalEntry{}).Where("kind = ?", constant.JournalEntryKindTopUp).Order("id").Pluck("reference", &refs)
+		assert.Equal(t, 3, len(refs))
+		assert.NotEqual(t, refs[0], refs[1])
+		assert.Regexp(t, `^topup:customer:\d+:\d+$`, refs[0])
+		assert.Regexp(t, `^topup:merchant:\d+:\d+$`, refs[2])
+		var n int64
+		db.Model(&JournalEntry{}).Where("reference IN ?", refs).Count(&n)
+		assert.Equal(t, int64(3), n)
+	})
+
+	t.Run("balance changed outside ledger should be reported as drift", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&MerchantProfile{}).Where("id = ?", o.MerchantID).Update("amount", money.MustFromInt(150))
+
+		//Action
+		actual, err := ls.ListDrifts(ctx)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []LedgerDrift{{
+			AccountType:   constant.LedgerAccountTypeMerchant,
+			OwnerID:       o.MerchantID,
+			Currency:      money.THB,
+			ProfileAmount: money.MustFromInt(150),
+			LedgerAmount:  money.MustFromInt(100),
+		}}, actual)
+	})
+
+	t.Run("unbalanced entry should be refused", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return post(tx, constant.JournalEntryKindTopUp, "test:1", cl.Now(),
+				leg{constant.LedgerAccountTypeCustomer, o.CustomerID, money.THB, money.MustFromInt(10)},
+				leg{constant.LedgerAccountTypeExternal, 0, money.THB, money.MustFromInt(-9)},
+			)
+		})
+
+		//Assert
+		assert.Equal(t, ErrUnbalancedEntry, err)
+	})
+}
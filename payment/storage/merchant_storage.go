@@ -1,13 +1,99 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"gorm.io/gorm"
 )
 
 type MerchantProfile struct {
 	gorm.Model
-	Name   string                  `gorm:"type:varchar(100);not null;"`
-	Status constant.MerchantStatus `gorm:"type:varchar(10);not null;"`
-	Amount float64                 `gorm:"not null"`
+	Name     string                  `gorm:"type:varchar(100);not null;"`
+	Status   constant.MerchantStatus `gorm:"type:varchar(10);not null;"`
+	Amount   money.Amount            `gorm:"type:decimal(19,4);not null"`
+	Currency money.Currency          `gorm:"type:varchar(3);not null;default:THB;"`
+	// PromptPay ID or biller ID QR payments are made out to
+	PromptPayID string `gorm:"type:varchar(20);"`
+}
+
+type MerchantStorage interface {
+	GetMerchant(ctx context.Context, id uint) (*MerchantProfile, error)
+	ListMerchants(ctx context.Context, offset, limit int) ([]MerchantProfile, int64, error)
+	CreateMerchant(ctx context.Context, m *MerchantProfile) error
+	UpdateMerchantStatus(ctx context.Context, id uint, status constant.MerchantStatus) error
+	TopUpMerchant(ctx context.Context, id uint, amount money.Amount) (*MerchantProfile, error)
+}
+
+type merchantStorage struct {
+	db *gorm.DB
+}
+
+func NewMerchantStorage(db *gorm.DB) MerchantStorage {
+	return &merchantStorage{
+		db: db,
+	}
+}
+
+func (s *merchantStorage) GetMerchant(ctx context.Context, id uint) (*MerchantProfile, error) {
+	m := &MerchantProfile{}
+	r := s.db.WithContext(ctx).Debug().Where("ID = ?", id).First(m)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return m, nil
+}
+
+func (s *merchantStorage) ListMerchants(ctx context.Context, offset, limit int) ([]MerchantProfile, int64, error) {
+	var m []MerchantProfile
+	var total int64
+	if r := s.db.WithContext(ctx).Debug().Model(&MerchantProfile{}).Count(&total); r.Error != nil {
+		return nil, 0, r.Error
+	}
+	r := s.db.WithContext(ctx).Debug().Order("id").Offset(offset).Limit(limit).Find(&m)
+	if r.Error != nil {
+		return nil, 0, r.Error
+	}
+	return m, total, nil
+}
+
+func (s *merchantStorage) CreateMerchant(ctx context.Context, m *MerchantProfile) error {
+	r := s.db.WithContext(ctx).Debug().Create(m)
+	return r.Error
+}
+
+func (s *merchantStorage) UpdateMerchantStatus(ctx context.Context, id uint, status constant.MerchantStatus) error {
+	r := s.db.WithContext(ctx).Debug().Model(&MerchantProfile{}).Where("id = ?", id).Update("status", status)
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TopUpMerchant adds amount to the balance in a single statement so it never
+// overwrites a concurrent payment or refund, and posts it to the ledger.
+func (s *merchantStorage) TopUpMerchant(ctx context.Context, id uint, amount money.Amount) (*MerchantProfile, error) {
+	m := &MerchantProfile{}
+	err := s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		r := tx.Model(&MerchantProfile{}).Where("id = ?", id).Update("amount", gorm.Expr("amount + ?", amount))
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if r := tx.First(m, id); r.Error != nil {
+			return r.Error
+		}
+		return post(tx, constant.JournalEntryKindTopUp, topUpReference("merchant", id, m.UpdatedAt), m.UpdatedAt,
+			externalLegs(constant.LedgerAccountTypeMerchant, id, m.Currency, amount)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
 }
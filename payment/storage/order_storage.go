@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"gorm.io/gorm"
 )
 
@@ -9,7 +12,8 @@ type Order struct {
 	gorm.Model
 	CustomerID uint                 `gorm:"not null"` // Foreign Key to CustomerProfile
 	MerchantID uint                 `gorm:"not null"` // Foreign Key to MerchantProfile
-	Amount     float64              `gorm:"not null"`
+	Amount     money.Amount         `gorm:"type:decimal(19,4);not null"`
+	Currency   money.Currency       `gorm:"type:varchar(3);not null;default:THB;"`
 	Status     constant.OrderStatus `gorm:"type:varchar(20);not null;"`
 
 	// Relations
@@ -17,9 +21,30 @@ type Order struct {
 	Merchant MerchantProfile `gorm:"foreignKey:MerchantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;saveAssociation:true"`
 }
 
+// OrderStatusHistory records every status change an order went through.
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID uint                 `gorm:"not null;index"`
+	From    constant.OrderStatus `gorm:"type:varchar(20);"`
+	To      constant.OrderStatus `gorm:"type:varchar(20);not null;"`
+	Reason  string               `gorm:"type:varchar(255);"`
+}
+
+// orderGuards hold extra conditions an order must meet to enter a status.
+var orderGuards = map[constant.OrderStatus]func(o *Order) error{
+	constant.OrderStatusRequestPayment: func(o *Order) error {
+		if !o.Amount.IsPositive() {
+			return ErrOrderAmountInvalid
+		}
+		return nil
+	},
+}
+
 type OrderStorage interface {
-	GetOrder(id uint) (*Order, error)
-	Save(*Order) error
+	GetOrder(ctx context.Context, id uint) (*Order, error)
+	Save(ctx context.Context, o *Order) error
+	Transit(ctx context.Context, id uint, to constant.OrderStatus, reason string) error
+	History(ctx context.Context, id uint) ([]OrderStatusHistory, error)
 }
 
 type orderStorage struct {
@@ -32,17 +57,87 @@ func NewOrderStorage(db *gorm.DB) OrderStorage {
 	}
 }
 
-func (s *orderStorage) Save(o *Order) error {
-	r := s.db.Debug().Save(o)
+// Save creates or updates the order. A status change goes through the order
+// state machine and is recorded in the history; an illegal one returns a
+// *constant.OrderTransitionError and nothing is written.
+func (s *orderStorage) Save(ctx context.Context, o *Order) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		if o.ID == 0 {
+			if o.Status == "" {
+				o.Status = constant.OrderStatusOpen
+			}
+			if !constant.IsInitialOrderStatus(o.Status) {
+				return &constant.OrderTransitionError{To: o.Status}
+			}
+			if r := tx.Save(o); r.Error != nil {
+				return r.Error
+			}
+			return tx.Create(&OrderStatusHistory{OrderID: o.ID, To: o.Status}).Error
+		}
+
+		cur := &Order{}
+		if r := tx.First(cur, o.ID); r.Error != nil {
+			return r.Error
+		}
+		if cur.Status != o.Status {
+			if err := transitOrder(tx, cur, o.Status, ""); err != nil {
+				return err
+			}
+		}
+		if r := tx.Save(o); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+func (s *orderStorage) Transit(ctx context.Context, id uint, to constant.OrderStatus, reason string) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		cur := &Order{}
+		if r := tx.First(cur, id); r.Error != nil {
+			return r.Error
+		}
+		return transitOrder(tx, cur, to, reason)
+	})
+}
+
+func (s *orderStorage) History(ctx context.Context, id uint) ([]OrderStatusHistory, error) {
+	var h []OrderStatusHistory
+	r := s.db.WithContext(ctx).Debug().Where("order_id = ?", id).Order("id").Find(&h)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return h, nil
+}
+
+// transitOrder moves cur to status to when the state machine and guards allow
+// it. The update is conditional on the status cur was read with, so a
+// concurrent change makes it fail with ErrOrderStatusChanged instead of
+// overwriting it.
+func transitOrder(tx *gorm.DB, cur *Order, to constant.OrderStatus, reason string) error {
+	if err := constant.TransitOrder(cur.Status, to); err != nil {
+		return err
+	}
+	if g, ok := orderGuards[to]; ok {
+		if err := g(cur); err != nil {
+			return err
+		}
+	}
+	r := tx.Model(&Order{}).
+		Where("id = ? AND status = ?", cur.ID, cur.Status).
+		Update("status", to)
 	if r.Error != nil {
 		return r.Error
 	}
-	return nil
+	if r.RowsAffected == 0 {
+		return ErrOrderStatusChanged
+	}
+	return tx.Create(&OrderStatusHistory{OrderID: cur.ID, From: cur.Status, To: to, Reason: reason}).Error
 }
 
-func (s *orderStorage) GetOrder(id uint) (*Order, error) {
+func (s *orderStorage) GetOrder(ctx context.Context, id uint) (*Order, error) {
 	o := &Order{}
-	r := s.db.Debug().Preload("Customer").Preload("Merchant").Where("ID = ?", id).First(o)
+	r := s.db.WithContext(ctx).Debug().Preload("Customer").Preload("Merchant").Where("ID = ?", id).First(o)
 	if r.Error != nil {
 		return nil, r.Error
 	}
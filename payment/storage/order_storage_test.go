@@ -11,8 +11,8 @@ import (
 
 	"github.com/kaweel/workshop-tdd/payment/clock"
 	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"github.com/stretchr/testify/assert"
-	"github.com/testcontainers/testcontainers-go/modules/mssql"
 	"gorm.io/gorm"
 )
 
@@ -22,7 +22,7 @@ func TestOrderStorage(t *testing.T) {
 	var c CustomerProfile
 	var m MerchantProfile
 	var o *Order
-	var container *mssql.MSSQLServerContainer
+	var teardown func()
 	var db *gorm.DB
 	var cl clock.Clock
 	var tn time.Time
@@ -31,8 +31,7 @@ func TestOrderStorage(t *testing.T) {
 		cl = clock.NewClock()
 		tn = cl.Now()
 		ctx = context.Background()
-		container, db = SetupMSSQL(ctx, t)
-		db.Debug().AutoMigrate(&CustomerProfile{}, &MerchantProfile{}, &Order{})
+		db, teardown = SetupDB(ctx, t)
 		ot = NewOrderStorage(db)
 		c = CustomerProfile{
 			Model: gorm.Model{
@@ -40,7 +39,7 @@ func TestOrderStorage(t *testing.T) {
 			},
 			Name:   "Madmax Drinkcola",
 			Status: constant.CustomerStatusActive,
-			Amount: 1000,
+			Amount: money.MustFromInt(1000),
 		}
 		m = MerchantProfile{
 			Model: gorm.Model{
@@ -48,7 +47,7 @@ func TestOrderStorage(t *testing.T) {
 			},
 			Name:   "Rabit Cart",
 			Status: constant.MerchantStatusActive,
-			Amount: 1100,
+			Amount: money.MustFromInt(1100),
 		}
 		o = &Order{
 			Model: gorm.Model{
@@ -56,16 +55,16 @@ func TestOrderStorage(t *testing.T) {
 			},
 			Customer: c,
 			Merchant: m,
-			Amount:   1200,
+			Amount:   money.MustFromInt(1200),
 		}
-		err := ot.Save(o)
+		err := ot.Save(ctx, o)
 		if err != nil {
 			t.Fatalf("Failed to setup data [%v]", err.Error())
 		}
 	}
 
 	cleanup := func() {
-		defer CleanUpMSSQL(container, ctx, t)
+		teardown()
 	}
 
 	t.Run("get order by id not found should return error", func(t *testing.T) {
@@ -74,7 +73,7 @@ func TestOrderStorage(t *testing.T) {
 		defer cleanup()
 
 		//Action
-		_, err := ot.GetOrder(2)
+		_, err := ot.GetOrder(ctx, 2)
 
 		//Assert
 		assert.Equal(t, err, gorm.ErrRecordNotFound)
@@ -86,7 +85,7 @@ func TestOrderStorage(t *testing.T) {
 		defer cleanup()
 
 		//Action
-		expected, err := ot.GetOrder(o.ID)
+		expected, err := ot.GetOrder(ctx, o.ID)
 
 		//Assert
 		assert.Nil(t, err)
@@ -106,4 +105,53 @@ func TestOrderStorage(t *testing.T) {
 		assert.Equal(t, expected.Merchant.Amount, o.Merchant.Amount)
 		assert.Equal(t, expected.Merchant.Status, o.Merchant.Status)
 	})
+
+	t.Run("new order should start open and record history", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		h, err := ot.History(ctx, o.ID)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, constant.OrderStatusOpen, o.Status)
+		assert.Equal(t, 1, len(h))
+		assert.Equal(t, constant.OrderStatusOpen, h[0].To)
+	})
+
+	t.Run("legal transition should change status and record history", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+
+		//Action
+		err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, "checkout")
+
+		//Assert
+		assert.Nil(t, err)
+		actual, _ := ot.GetOrder(ctx, o.ID)
+		h, _ := ot.History(ctx, o.ID)
+		assert.Equal(t, constant.OrderStatusRequestPayment, actual.Status)
+		assert.Equal(t, 2, len(h))
+		assert.Equal(t, constant.OrderStatusOpen, h[1].From)
+		assert.Equal(t, constant.OrderStatusRequestPayment, h[1].To)
+		assert.Equal(t, "checkout", h[1].Reason)
+	})
+
+	t.Run("illegal transition on save should return transition error and keep status", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		o.Status = constant.OrderStatusConfirm
+
+		//Action
+		err := ot.Save(ctx, o)
+
+		//Assert
+		assert.Equal(t, &constant.OrderTransitionError{From: constant.OrderStatusOpen, To: constant.OrderStatusConfirm}, err)
+		actual, _ := ot.GetOrder(ctx, o.ID)
+		assert.Equal(t, constant.OrderStatusOpen, actual.Status)
+	})
 }
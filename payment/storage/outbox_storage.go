@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Outbox struct {
+	gorm.Model
+	Topic         string                `gorm:"type:varchar(100);not null;"`
+	Key           string                `gorm:"type:varchar(100);"`
+	Payload       string                `gorm:"not null;"`
+	Status        constant.OutboxStatus `gorm:"type:varchar(10);not null;index;"`
+	Attempts      int                   `gorm:"not null;"`
+	LastError     string                `gorm:"type:varchar(255);"`
+	NextAttemptAt time.Time             `gorm:"not null;index;"`
+	SentAt        *time.Time
+}
+
+type OutboxStorage interface {
+	ListPending(ctx context.Context, now time.Time, limit int) ([]Outbox, error)
+	MarkSent(ctx context.Context, id uint, sentAt time.Time) error
+	MarkRetry(ctx context.Context, id uint, attempts int, reason string, next time.Time) error
+	MarkFailed(ctx context.Context, id uint, attempts int, reason string) error
+}
+
+type outboxStorage struct {
+	db *gorm.DB
+}
+
+func NewOutboxStorage(db *gorm.DB) OutboxStorage {
+	return &outboxStorage{
+		db: db,
+	}
+}
+
+// ListPending returns up to limit events due at now, oldest first. An event
+// waits while an older one with the same key is failed or not yet due, so
+// the events of a key are only ever published in order. Events without a
+// key are never held back.
+func (s *outboxStorage) ListPending(ctx context.Context, now time.Time, limit int) ([]Outbox, error) {
+	key := clause.Column{Table: "outboxes", Name: "key"}
+	older := s.db.Table("outboxes AS older").
+		Select("1").
+		Where("? = ? AND older.id < outboxes.id AND older.deleted_at IS NULL", clause.Column{Table: "older", Name: "key"}, key).
+		Where("(older.status = ? OR (older.status = ? AND older.next_attempt_at > ?))", constant.OutboxStatusFailed, constant.OutboxStatusPending, now)
+
+	var o []Outbox
+	r := s.db.WithContext(ctx).Debug().
+		Where("status = ? AND next_attempt_at <= ?", constant.OutboxStatusPending, now).
+		Where("(? IS NULL OR ? = '' OR NOT EXISTS (?))", key, key, older).
+		Order("id").
+		Limit(limit).
+		Find(&o)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return o, nil
+}
+
+func (s *outboxStorage) MarkSent(ctx context.Context, id uint, sentAt time.Time) error {
+	r := s.db.WithContext(ctx).Debug().Model(&Outbox{}).Where("id = ?", id).Updates(map[string]any{
+		"status":  constant.OutboxStatusSent,
+		"sent_at": sentAt,
+	})
+	return r.Error
+}
+
+func (s *outboxStorage) MarkRetry(ctx context.Context, id uint, attempts int, reason string, next time.Time) error {
+	r := s.db.WithContext(ctx).Debug().Model(&Outbox{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":        attempts,
+		"last_error":      truncate(reason, 255),
+		"next_attempt_at": next,
+	})
+	return r.Error
+}
+
+func (s *outboxStorage) MarkFailed(ctx context.Context, id uint, attempts int, reason string) error {
+	r := s.db.WithContext(ctx).Debug().Model(&Outbox{}).Where("id = ?", id).Updates(map[string]any{
+		"status":     constant.OutboxStatusFailed,
+		"attempts":   attempts,
+		"last_error": truncate(reason, 255),
+	})
+	return r.Error
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
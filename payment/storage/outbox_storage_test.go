@@ -0,0 +1,96 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestOutboxStorage(t *testing.T) {
+	var ctx context.Context
+	var s OutboxStorage
+	var teardown func()
+	var db *gorm.DB
+	var now time.Time
+
+	setup := func() {
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		s = NewOutboxStorage(db)
+		now = time.Now().UTC().Truncate(time.Second)
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	add := func(key string, status constant.OutboxStatus, next time.Time) uint {
+		e := &Outbox{Topic: constant.KafkaTopicPaymentTransaction, Key: key, Payload: "{}", Status: status, NextAttemptAt: next}
+		if r := db.Create(e); r.Error != nil {
+			t.Fatalf("Failed to setup data [%v]", r.Error.Error())
+		}
+		return e.ID
+	}
+
+	ids := func(rows []Outbox) []uint {
+		v := []uint{}
+		for _, e := range rows {
+			v = append(v, e.ID)
+		}
+		return v
+	}
+
+	t.Run("list pending should return due events oldest first", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		a1 := add("order-1", constant.OutboxStatusPending, now)
+		add("order-2", constant.OutboxStatusSent, now)
+		b1 := add("order-2", constant.OutboxStatusPending, now)
+		a2 := add("order-1", constant.OutboxStatusPending, now)
+		add("order-3", constant.OutboxStatusPending, now.Add(time.Minute))
+
+		//Action
+		rows, err := s.ListPending(ctx, now, 10)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, []uint{a1, b1, a2}, ids(rows))
+	})
+
+	t.Run("list pending should hold events behind an older event of the same key that is", func(t *testing.T) {
+		data := []struct {
+			name   string
+			status constant.OutboxStatus
+			next   time.Duration
+		}{
+			{"waiting for retry", constant.OutboxStatusPending, time.Minute},
+			{"failed", constant.OutboxStatusFailed, 0},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup()
+				defer cleanup()
+				add("order-1", v.status, now.Add(v.next))
+				add("order-1", constant.OutboxStatusPending, now)
+				other := add("order-2", constant.OutboxStatusPending, now)
+				keyless := add("", constant.OutboxStatusPending, now)
+
+				//Action
+				rows, err := s.ListPending(ctx, now, 10)
+
+				//Assert
+				assert.Nil(t, err)
+				assert.Equal(t, []uint{other, keyless}, ids(rows))
+			})
+		}
+	})
+}
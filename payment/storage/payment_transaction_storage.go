@@ -1,23 +1,71 @@
 package storage
 
 import (
+	"context"
+	"time"
+
 	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
 	"gorm.io/gorm"
 )
 
 type PaymentTranasction struct {
 	gorm.Model
-	OrderID uint                              `gorm:"not null"`
-	Channel constant.PaymentChannel           `gorm:"type:varchar(10);not null;"`
-	Amount  float64                           `gorm:"not null;"`
-	Status  constant.PaymentTranasctionStatus `gorm:"type:varchar(30);not null;"`
-	Reason  string                            `gorm:"type:varchar(255);"`
+	OrderID  uint                              `gorm:"not null"`
+	Type     constant.PaymentTranasctionType   `gorm:"type:varchar(10);not null;default:payment;"`
+	ParentID *uint                             `gorm:"index"` // Refunds point at the payment they return
+	Channel  constant.PaymentChannel           `gorm:"type:varchar(10);not null;"`
+	Amount   money.Amount                      `gorm:"type:decimal(19,4);not null;"`
+	Currency money.Currency                    `gorm:"type:varchar(3);not null;default:THB;"`
+	Status   constant.PaymentTranasctionStatus `gorm:"type:varchar(30);not null;"`
+	Reason   string                            `gorm:"type:varchar(255);"`
+	// Authorization ID the channel provider gave the payment
+	ProviderRef string `gorm:"type:varchar(64);index"`
+
+	// Amount converted at Rate into the customer wallet currency
+	SettledAmount   money.Amount   `gorm:"type:decimal(19,4);not null;default:0;"`
+	SettledCurrency money.Currency `gorm:"type:varchar(3);not null;default:THB;"`
+	Rate            money.Rate     `gorm:"type:decimal(19,8);not null;default:1;"`
+	// Amount is gross; the merchant is credited NetAmount after FeeAmount
+	FeeAmount money.Amount `gorm:"type:decimal(19,4);not null;default:0;"`
+	NetAmount money.Amount `gorm:"type:decimal(19,4);not null;default:0;"`
+	// Settlement that paid the transaction out to the merchant
+	SettlementID *uint `gorm:"index"`
+	// When the transaction was confirmed. Unlike UpdatedAt it never changes
+	// afterwards, so it is what settlement windows are cut on.
+	ConfirmedAt *time.Time `gorm:"index"`
 
 	// Relation
 	Order Order `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 type PaymentTranasctionStorage interface {
-	Save(p *PaymentTranasction) error
+	Save(ctx context.Context, p *PaymentTranasction, e *Outbox) error
+	Confirm(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error
+	Refund(ctx context.Context, p *PaymentTranasction, event func(*PaymentTranasction) (*Outbox, error)) error
+	GetPending(ctx context.Context, orderID uint) (*PaymentTranasction, error)
+	GetByID(ctx context.Context, id uint) (*PaymentTranasction, error)
+	ConfirmPending(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error
+	RejectPending(ctx context.Context, p *PaymentTranasction, e *Outbox) error
+	ListPendingBefore(ctx context.Context, before time.Time, limit int) ([]PaymentTranasction, error)
+	Authorize(ctx context.Context, o *Order, p *PaymentTranasction, h *Hold, e *Outbox) error
+	GetHold(ctx context.Context, paymentID uint) (*Hold, error)
+	Capture(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error
+	Void(ctx context.Context, p *PaymentTranasction, e *Outbox) error
+	ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]PaymentTranasction, error)
+	ListByOrder(ctx context.Context, orderID uint) ([]PaymentTranasction, error)
+	List(ctx context.Context, f PaymentTranasctionFilter, before uint, limit int) ([]PaymentTranasction, error)
+	MerchantVolume(ctx context.Context, merchantID uint, since time.Time) (money.Amount, error)
+	Reconcile(ctx context.Context, r *Reconciliation) error
+}
+
+// PaymentTranasctionFilter narrows List down. Zero fields do not filter.
+type PaymentTranasctionFilter struct {
+	Status     constant.PaymentTranasctionStatus
+	Channel    constant.PaymentChannel
+	MerchantID uint
+	// CreatedAt range, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
 }
 
 type paymentTranasctionStorage struct {
@@ -30,10 +78,410 @@ func NewPaymentTranasctionStorage(db *gorm.DB) PaymentTranasctionStorage {
 	}
 }
 
-func (s *paymentTranasctionStorage) Save(p *PaymentTranasction) error {
-	r := s.db.Debug().Save(p)
+// Save stores the transaction together with its outbox event so the event
+// is never lost or emitted for a transaction that was rolled back.
+func (s *paymentTranasctionStorage) Save(ctx context.Context, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		if r := tx.Save(p); r.Error != nil {
+			return r.Error
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// Confirm moves the payment amount from the customer to the merchant and
+// stores the transaction with its event in one database transaction. The
+// order row is locked first so payments of the same order are serialized, and
+// once confirmed payments cover the order amount the order moves to confirm
+// through the order state machine. Every balance update is conditional so
+// concurrent payments can never overdraw the customer.
+func (s *paymentTranasctionStorage) Confirm(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		if err := book(tx, o, p); err != nil {
+			return err
+		}
+
+		r := tx.Model(&CustomerProfile{}).
+			Where("id = ? AND amount >= held_amount + ?", o.CustomerID, p.SettledAmount).
+			Updates(map[string]any{"amount": gorm.Expr("amount - ?", p.SettledAmount), "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrCustomerAmountNotEnough
+		}
+
+		if err := creditMerchant(tx, o, p); err != nil {
+			return err
+		}
+		confirm(p)
+		if r := tx.Save(p); r.Error != nil {
+			return r.Error
+		}
+		err := post(tx, constant.JournalEntryKindPayment, reference("payment", p.ID), p.UpdatedAt,
+			paymentLegs(constant.LedgerAccountTypeCustomer, o.CustomerID, o.MerchantID, p)...)
+		if err != nil {
+			return err
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// ConfirmPending books a pending payment the customer completed outside the
+// wallet, e.g. a QR transfer from their bank, so only the merchant is
+// credited. The status update is conditional so a payment confirmed by a
+// redelivered webhook or rejected by the timeout sweeper is never booked twice.
+func (s *paymentTranasctionStorage) ConfirmPending(ctx context.Context, o *Order, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		if err := book(tx, o, p); err != nil {
+			return err
+		}
+
+		r := tx.Model(&PaymentTranasction{}).
+			Where("id = ? AND status = ?", p.ID, constant.PaymentTranasctionStatusPending).
+			Updates(map[string]any{
+				"status":       constant.PaymentTranasctionStatusConfirm,
+				"provider_ref": p.ProviderRef,
+				"fee_amount":   p.FeeAmount,
+				"net_amount":   p.NetAmount,
+				"updated_at":   p.UpdatedAt,
+				"confirmed_at": p.UpdatedAt,
+			})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrPaymentNotPending
+		}
+		confirm(p)
+
+		if err := creditMerchant(tx, o, p); err != nil {
+			return err
+		}
+		// The customer paid from their bank, so the money comes from outside.
+		err := post(tx, constant.JournalEntryKindPayment, reference("payment", p.ID), p.UpdatedAt,
+			paymentLegs(constant.LedgerAccountTypeExternal, 0, o.MerchantID, p)...)
+		if err != nil {
+			return err
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// RejectPending rejects a payment that is still pending and stores its event.
+func (s *paymentTranasctionStorage) RejectPending(ctx context.Context, p *PaymentTranasction, e *Outbox) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		r := tx.Model(&PaymentTranasction{}).
+			Where("id = ? AND status = ?", p.ID, constant.PaymentTranasctionStatusPending).
+			Updates(map[string]any{"status": constant.PaymentTranasctionStatusReject, "reason": p.Reason, "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrPaymentNotPending
+		}
+		p.Status = constant.PaymentTranasctionStatusReject
+
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// book locks the order, checks p against the amount still outstanding and
+// moves the order to confirm once p covers it.
+func book(tx *gorm.DB, o *Order, p *PaymentTranasction) error {
+	cur, outstanding, err := lockOutstanding(tx, o, p)
+	if err != nil {
+		return err
+	}
+	if p.Amount.Cmp(outstanding) > 0 {
+		return ErrPaymentExceedsOutstanding
+	}
+	if p.Amount == outstanding {
+		return transitOrder(tx, cur, constant.OrderStatusConfirm, "payment confirmed")
+	}
+	return nil
+}
+
+// lockOutstanding locks the order while it still requests payment and
+// returns it with the amount confirmed payments have not covered yet.
+func lockOutstanding(tx *gorm.DB, o *Order, p *PaymentTranasction) (*Order, money.Amount, error) {
+	r := tx.Model(&Order{}).
+		Where("id = ? AND status = ?", o.ID, constant.OrderStatusRequestPayment).
+		Update("updated_at", p.UpdatedAt)
+	if r.Error != nil {
+		return nil, money.Amount{}, r.Error
+	}
+	if r.RowsAffected == 0 {
+		return nil, money.Amount{}, ErrOrderNotRequestPayment
+	}
+	cur := &Order{}
+	if r := tx.First(cur, o.ID); r.Error != nil {
+		return nil, money.Amount{}, r.Error
+	}
+	if err := settle(p, cur); err != nil {
+		return nil, money.Amount{}, err
+	}
+
+	var paid money.Amount
+	r = tx.Model(&PaymentTranasction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("order_id = ? AND type = ? AND status = ?", o.ID, constant.PaymentTranasctionTypePayment, constant.PaymentTranasctionStatusConfirm).
+		Scan(&paid)
+	if r.Error != nil {
+		return nil, money.Amount{}, r.Error
+	}
+	outstanding, err := cur.Amount.Sub(paid)
+	if err != nil {
+		return nil, money.Amount{}, err
+	}
+	return cur, outstanding, nil
+}
+
+func creditMerchant(tx *gorm.DB, o *Order, p *PaymentTranasction) error {
+	r := tx.Model(&MerchantProfile{}).
+		Where("id = ? AND status = ?", o.MerchantID, constant.MerchantStatusActive).
+		Updates(map[string]any{"amount": gorm.Expr("amount + ?", p.NetAmount), "updated_at": p.UpdatedAt})
 	if r.Error != nil {
 		return r.Error
 	}
+	if r.RowsAffected == 0 {
+		return ErrMerchantNotActive
+	}
+	return nil
+}
+
+// settle fills in the order currency, for a payment made without
+// conversion a settled amount equal to the amount at rate one, and the net
+// amount the merchant is credited.
+func settle(p *PaymentTranasction, o *Order) error {
+	if p.Currency == "" {
+		p.Currency = o.Currency
+	}
+	if p.Currency != o.Currency {
+		return ErrCurrencyMismatch
+	}
+	if p.Rate.IsZero() {
+		p.Rate = money.One
+		p.SettledAmount = p.Amount
+		p.SettledCurrency = p.Currency
+	}
+	net, err := p.Amount.Sub(p.FeeAmount)
+	if err != nil {
+		return err
+	}
+	p.NetAmount = net
 	return nil
 }
+
+// confirm marks p confirmed at p.UpdatedAt.
+func confirm(p *PaymentTranasction) {
+	t := p.UpdatedAt
+	p.Status = constant.PaymentTranasctionStatusConfirm
+	p.ConfirmedAt = &t
+}
+
+// Refund returns p.Amount of the confirmed payment p.ParentID from the merchant
+// to the customer, or everything not yet refunded when p.Amount is zero. The
+// original payment row is locked first so concurrent refunds are serialized
+// and their total can never exceed the original amount. The event is built
+// once the refund has its ID and final amount.
+func (s *paymentTranasctionStorage) Refund(ctx context.Context, p *PaymentTranasction, event func(*PaymentTranasction) (*Outbox, error)) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		// Locking the original payment makes concurrent refunds of it wait
+		// for each other without touching it, as its updated_at places it in
+		// a settlement window.
+		orig := &PaymentTranasction{}
+		r := forUpdate(tx, orig).Where("id = ? AND type = ?", p.ParentID, constant.PaymentTranasctionTypePayment).First(orig)
+		if r.Error != nil {
+			return r.Error
+		}
+		if orig.Status != constant.PaymentTranasctionStatusConfirm {
+			return ErrPaymentNotRefundable
+		}
+
+		var refunded struct {
+			Amount        money.Amount
+			SettledAmount money.Amount
+		}
+		r = tx.Model(&PaymentTranasction{}).
+			Select("COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(settled_amount), 0) AS settled_amount").
+			Where("parent_id = ? AND type = ? AND status = ?", orig.ID, constant.PaymentTranasctionTypeRefund, constant.PaymentTranasctionStatusConfirm).
+			Scan(&refunded)
+		if r.Error != nil {
+			return r.Error
+		}
+		remaining, err := orig.Amount.Sub(refunded.Amount)
+		if err != nil {
+			return err
+		}
+		if p.Amount.IsZero() {
+			p.Amount = remaining
+		}
+		if !p.Amount.IsPositive() || p.Amount.Cmp(remaining) > 0 {
+			return ErrRefundExceedsAmount
+		}
+		// The customer gets back what was debited at the original rate; the
+		// last refund takes the remainder so rounding never leaks.
+		p.Currency = orig.Currency
+		p.Rate = orig.Rate
+		p.SettledCurrency = orig.SettledCurrency
+		if p.Amount == remaining {
+			p.SettledAmount, err = orig.SettledAmount.Sub(refunded.SettledAmount)
+		} else {
+			p.SettledAmount, err = p.Amount.Convert(orig.Rate, orig.SettledCurrency)
+		}
+		if err != nil {
+			return err
+		}
+
+		o := &Order{}
+		if r := tx.First(o, orig.OrderID); r.Error != nil {
+			return r.Error
+		}
+
+		r = tx.Model(&MerchantProfile{}).
+			Where("id = ? AND amount >= ?", o.MerchantID, p.Amount).
+			Updates(map[string]any{"amount": gorm.Expr("amount - ?", p.Amount), "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return ErrMerchantAmountNotEnough
+		}
+
+		r = tx.Model(&CustomerProfile{}).
+			Where("id = ?", o.CustomerID).
+			Updates(map[string]any{"amount": gorm.Expr("amount + ?", p.SettledAmount), "updated_at": p.UpdatedAt})
+		if r.Error != nil {
+			return r.Error
+		}
+
+		p.OrderID = orig.OrderID
+		p.Channel = orig.Channel
+		p.Type = constant.PaymentTranasctionTypeRefund
+		confirm(p)
+		if r := tx.Save(p); r.Error != nil {
+			return r.Error
+		}
+		err = post(tx, constant.JournalEntryKindRefund, reference("refund", p.ID), p.UpdatedAt, refundLegs(o.CustomerID, o.MerchantID, p)...)
+		if err != nil {
+			return err
+		}
+		e, err := event(p)
+		if err != nil {
+			return err
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// GetPending returns the latest payment of the order still waiting for the
+// customer, e.g. to scan its QR code.
+func (s *paymentTranasctionStorage) GetPending(ctx context.Context, orderID uint) (*PaymentTranasction, error) {
+	p := &PaymentTranasction{}
+	r := s.db.WithContext(ctx).Debug().
+		Where("order_id = ? AND type = ? AND status = ?", orderID, constant.PaymentTranasctionTypePayment, constant.PaymentTranasctionStatusPending).
+		Order("id DESC").
+		First(p)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return p, nil
+}
+
+func (s *paymentTranasctionStorage) GetByID(ctx context.Context, id uint) (*PaymentTranasction, error) {
+	p := &PaymentTranasction{}
+	r := s.db.WithContext(ctx).Debug().Where("id = ?", id).First(p)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return p, nil
+}
+
+// ListPendingBefore returns up to limit pending payments created before
+// before, oldest first.
+func (s *paymentTranasctionStorage) ListPendingBefore(ctx context.Context, before time.Time, limit int) ([]PaymentTranasction, error) {
+	var rows []PaymentTranasction
+	r := s.db.WithContext(ctx).Debug().
+		Where("type = ? AND status = ? AND created_at < ?", constant.PaymentTranasctionTypePayment, constant.PaymentTranasctionStatusPending, before).
+		Order("created_at, id").
+		Limit(limit).
+		Find(&rows)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return rows, nil
+}
+
+// ListByOrder returns every payment and refund of the order, oldest first.
+func (s *paymentTranasctionStorage) ListByOrder(ctx context.Context, orderID uint) ([]PaymentTranasction, error) {
+	var rows []PaymentTranasction
+	r := s.db.WithContext(ctx).Debug().Where("order_id = ?", orderID).Order("id").Find(&rows)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return rows, nil
+}
+
+// List returns up to limit transactions matching f, newest first. A non-zero
+// before continues a previous page with the transactions older than that ID.
+func (s *paymentTranasctionStorage) List(ctx context.Context, f PaymentTranasctionFilter, before uint, limit int) ([]PaymentTranasction, error) {
+	q := s.db.WithContext(ctx).Debug().Model(&PaymentTranasction{})
+	if f.Status != "" {
+		q = q.Where("payment_tranasctions.status = ?", f.Status)
+	}
+	if f.Channel != "" {
+		q = q.Where("payment_tranasctions.channel = ?", f.Channel)
+	}
+	if f.MerchantID != 0 {
+		q = q.Joins("JOIN orders ON orders.id = payment_tranasctions.order_id").
+			Where("orders.merchant_id = ?", f.MerchantID)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("payment_tranasctions.created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("payment_tranasctions.created_at < ?", f.To)
+	}
+	if before != 0 {
+		q = q.Where("payment_tranasctions.id < ?", before)
+	}
+
+	var rows []PaymentTranasction
+	r := q.Order("payment_tranasctions.id DESC").Limit(limit).Find(&rows)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return rows, nil
+}
+
+// MerchantVolume returns the total of the merchant's confirmed payments
+// created since since.
+func (s *paymentTranasctionStorage) MerchantVolume(ctx context.Context, merchantID uint, since time.Time) (money.Amount, error) {
+	var v money.Amount
+	r := s.db.WithContext(ctx).Debug().Model(&PaymentTranasction{}).
+		Select("COALESCE(SUM(payment_tranasctions.amount), 0)").
+		Joins("JOIN orders ON orders.id = payment_tranasctions.order_id").
+		Where("orders.merchant_id = ? AND payment_tranasctions.type = ? AND payment_tranasctions.status = ? AND payment_tranasctions.created_at >= ?",
+			merchantID, constant.PaymentTranasctionTypePayment, constant.PaymentTranasctionStatusConfirm, since).
+		Scan(&v)
+	if r.Error != nil {
+		return money.Amount{}, r.Error
+	}
+	return v, nil
+}
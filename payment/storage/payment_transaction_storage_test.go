@@ -0,0 +1,546 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPaymentTranasctionStorage(t *testing.T) {
+	var ctx context.Context
+	var pt PaymentTranasctionStorage
+	var o *Order
+	var teardown func()
+	var db *gorm.DB
+	var cl clock.Clock
+
+	setup := func() {
+		cl = clock.NewClock()
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		pt = NewPaymentTranasctionStorage(db)
+		o = &Order{
+			Customer: CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+		}
+		ot := NewOrderStorage(db)
+		if err := ot.Save(ctx, o); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, ""); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	newTxn := func() (*PaymentTranasction, *Outbox) {
+		n := cl.Now()
+		p := &PaymentTranasction{
+			Model:   gorm.Model{UpdatedAt: n},
+			OrderID: o.ID,
+			Amount:  o.Amount,
+			Channel: constant.PaymentChannelDebit,
+			Status:  constant.PaymentTranasctionStatusConfirm,
+		}
+		e := &Outbox{Topic: constant.KafkaTopicPaymentTransaction, Payload: "{}", Status: constant.OutboxStatusPending, NextAttemptAt: n}
+		return p, e
+	}
+
+	t.Run("confirm should move amount from customer to merchant and confirm order", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+
+		//Action
+		err := pt.Confirm(ctx, o, p, e)
+
+		//Assert
+		assert.Nil(t, err)
+		var c CustomerProfile
+		var m MerchantProfile
+		var actual Order
+		db.First(&c, o.CustomerID)
+		db.First(&m, o.MerchantID)
+		db.First(&actual, o.ID)
+		assert.Equal(t, money.MustFromInt(600), c.Amount)
+		assert.Equal(t, money.MustFromInt(500), m.Amount)
+		assert.Equal(t, constant.OrderStatusConfirm, actual.Status)
+		assert.NotZero(t, p.ID)
+		assert.NotZero(t, e.ID)
+	})
+
+	t.Run("confirm with fee should credit merchant net amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		p.FeeAmount = money.MustFromInt(12)
+
+		//Action
+		err := pt.Confirm(ctx, o, p, e)
+
+		//Assert
+		assert.Nil(t, err)
+		var m MerchantProfile
+		var stored PaymentTranasction
+		db.First(&m, o.MerchantID)
+		db.First(&stored, p.ID)
+		assert.Equal(t, money.MustFromInt(488), m.Amount)
+		assert.Equal(t, money.MustFromInt(12), stored.FeeAmount)
+		assert.Equal(t, money.MustFromInt(388), stored.NetAmount)
+	})
+
+	t.Run("merchant volume should sum confirmed payments since", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		since := cl.Now().Add(-time.Minute)
+		p1, e1 := newTxn()
+		p1.Amount = money.MustFromInt(150)
+		pt.Confirm(ctx, o, p1, e1)
+		p2, e2 := newTxn()
+		p2.Status = constant.PaymentTranasctionStatusReject
+		pt.Save(ctx, p2, e2)
+
+		//Action
+		actual, err := pt.MerchantVolume(ctx, o.MerchantID, since)
+		later, _ := pt.MerchantVolume(ctx, o.MerchantID, cl.Now().Add(time.Minute))
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(150), actual)
+		assert.Equal(t, money.Amount{}, later)
+	})
+
+	t.Run("partial payments should confirm order once order amount is covered", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p1, e1 := newTxn()
+		p1.Amount = money.MustFromInt(150)
+		p2, e2 := newTxn()
+		p2.Amount = money.MustFromInt(250)
+
+		//Action
+		err1 := pt.Confirm(ctx, o, p1, e1)
+		var afterFirst Order
+		db.First(&afterFirst, o.ID)
+		err2 := pt.Confirm(ctx, o, p2, e2)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, constant.OrderStatusRequestPayment, afterFirst.Status)
+		var actual Order
+		var c CustomerProfile
+		db.First(&actual, o.ID)
+		db.First(&c, o.CustomerID)
+		assert.Equal(t, constant.OrderStatusConfirm, actual.Status)
+		assert.Equal(t, money.MustFromInt(600), c.Amount)
+	})
+
+	t.Run("partial payment over outstanding amount should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p1, e1 := newTxn()
+		p1.Amount = money.MustFromInt(300)
+		pt.Confirm(ctx, o, p1, e1)
+		p2, e2 := newTxn()
+		p2.Amount = money.MustParse("100.01")
+
+		//Action
+		err := pt.Confirm(ctx, o, p2, e2)
+
+		//Assert
+		assert.Equal(t, ErrPaymentExceedsOutstanding, err)
+	})
+
+	t.Run("confirm customer amount not enough should rollback everything", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&CustomerProfile{}).Where("id = ?", o.CustomerID).Update("amount", 100)
+		p, e := newTxn()
+
+		//Action
+		err := pt.Confirm(ctx, o, p, e)
+
+		//Assert
+		assert.Equal(t, ErrCustomerAmountNotEnough, err)
+		var actual Order
+		var count int64
+		db.First(&actual, o.ID)
+		db.Model(&PaymentTranasction{}).Count(&count)
+		assert.Equal(t, constant.OrderStatusRequestPayment, actual.Status)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("concurrent confirm of same order should only move amount once", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		errs := make([]error, 5)
+		var wg sync.WaitGroup
+
+		//Action
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				p, e := newTxn()
+				errs[i] = pt.Confirm(ctx, o, p, e)
+			}(i)
+		}
+		wg.Wait()
+
+		//Assert
+		ok := 0
+		for _, err := range errs {
+			if err == nil {
+				ok++
+			}
+		}
+		var c CustomerProfile
+		db.First(&c, o.CustomerID)
+		assert.Equal(t, 1, ok)
+		assert.Equal(t, money.MustFromInt(600), c.Amount)
+	})
+
+	refundTxn := func(parentID uint, amount money.Amount) *PaymentTranasction {
+		return &PaymentTranasction{
+			Model:    gorm.Model{UpdatedAt: cl.Now()},
+			ParentID: &parentID,
+			Amount:   amount,
+		}
+	}
+
+	event := func(p *PaymentTranasction) (*Outbox, error) {
+		return &Outbox{Topic: constant.KafkaTopicPaymentRefund, Payload: "{}", Status: constant.OutboxStatusPending, NextAttemptAt: cl.Now()}, nil
+	}
+
+	t.Run("partial refund should return amount from merchant to customer", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		pt.Confirm(ctx, o, p, e)
+		var before PaymentTranasction
+		db.First(&before, p.ID)
+		rf := refundTxn(p.ID, money.MustFromInt(100))
+		rf.UpdatedAt = before.UpdatedAt.Add(time.Hour)
+
+		//Action
+		err := pt.Refund(ctx, rf, event)
+
+		//Assert
+		assert.Nil(t, err)
+		var c CustomerProfile
+		var m MerchantProfile
+		var after PaymentTranasction
+		db.First(&c, o.CustomerID)
+		db.First(&m, o.MerchantID)
+		db.First(&after, p.ID)
+		assert.Equal(t, money.MustFromInt(700), c.Amount)
+		assert.Equal(t, money.MustFromInt(400), m.Amount)
+		assert.Equal(t, constant.PaymentTranasctionTypeRefund, rf.Type)
+		assert.Equal(t, o.ID, rf.OrderID)
+		assert.True(t, before.UpdatedAt.Equal(after.UpdatedAt))
+	})
+
+	t.Run("refund more than remaining amount should fail and keep balances", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		pt.Confirm(ctx, o, p, e)
+		pt.Refund(ctx, refundTxn(p.ID, money.MustFromInt(300)), event)
+
+		//Action
+		err := pt.Refund(ctx, refundTxn(p.ID, money.MustFromInt(101)), event)
+
+		//Assert
+		assert.Equal(t, ErrRefundExceedsAmount, err)
+		var c CustomerProfile
+		db.First(&c, o.CustomerID)
+		assert.Equal(t, money.MustFromInt(900), c.Amount)
+	})
+
+	t.Run("full refund should refund remaining amount", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		pt.Confirm(ctx, o, p, e)
+		pt.Refund(ctx, refundTxn(p.ID, money.MustFromInt(150)), event)
+		rf := refundTxn(p.ID, money.Amount{})
+
+		//Action
+		err := pt.Refund(ctx, rf, event)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, money.MustFromInt(250), rf.Amount)
+		assert.Equal(t, ErrRefundExceedsAmount, pt.Refund(ctx, refundTxn(p.ID, money.Amount{}), event))
+	})
+
+	t.Run("converted payment should debit settled amount and refund at original rate", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&Order{}).Where("id = ?", o.ID).Updates(map[string]any{"currency": money.USD, "amount": money.MustFromInt(100)})
+		db.Model(&CustomerProfile{}).Where("id = ?", o.CustomerID).Update("amount", money.MustFromInt(10000))
+		o.Currency = money.USD
+		p, e := newTxn()
+		p.Amount = money.MustFromInt(100)
+		p.Currency = money.USD
+		p.Rate = money.MustParseRate("36.25")
+		p.SettledAmount = money.MustFromInt(3625)
+		p.SettledCurrency = money.THB
+
+		//Action
+		err := pt.Confirm(ctx, o, p, e)
+		var afterPayment CustomerProfile
+		db.First(&afterPayment, o.CustomerID)
+		rf1 := refundTxn(p.ID, money.MustFromInt(30))
+		err1 := pt.Refund(ctx, rf1, event)
+		rf2 := refundTxn(p.ID, money.Amount{})
+		err2 := pt.Refund(ctx, rf2, event)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, money.MustFromInt(6375), afterPayment.Amount)
+		assert.Equal(t, money.MustParse("1087.5"), rf1.SettledAmount)
+		assert.Equal(t, money.MustParse("2537.5"), rf2.SettledAmount)
+		assert.Equal(t, money.MustParseRate("36.25"), rf2.Rate)
+		var c CustomerProfile
+		var m MerchantProfile
+		db.First(&c, o.CustomerID)
+		db.First(&m, o.MerchantID)
+		assert.Equal(t, money.MustFromInt(10000), c.Amount)
+		assert.Equal(t, money.MustFromInt(100), m.Amount)
+	})
+
+	t.Run("payment in another currency than order should fail", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		p.Currency = money.USD
+
+		//Action
+		err := pt.Confirm(ctx, o, p, e)
+
+		//Assert
+		assert.Equal(t, ErrCurrencyMismatch, err)
+	})
+
+	t.Run("get pending should return latest pending payment of order", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p1, e1 := newTxn()
+		p1.Channel = constant.PaymentChannelPromptPay
+		p1.Status = constant.PaymentTranasctionStatusPending
+		p1.Type = constant.PaymentTranasctionTypePayment
+		pt.Save(ctx, p1, e1)
+		p2, e2 := newTxn()
+		p2.Channel = constant.PaymentChannelPromptPay
+		p2.Status = constant.PaymentTranasctionStatusPending
+		p2.Type = constant.PaymentTranasctionTypePayment
+		pt.Save(ctx, p2, e2)
+
+		//Action
+		actual, err := pt.GetPending(ctx, o.ID)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, p2.ID, actual.ID)
+	})
+
+	t.Run("get pending without pending payment should return record not found", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		pt.Confirm(ctx, o, p, e)
+
+		//Action
+		_, err := pt.GetPending(ctx, o.ID)
+
+		//Assert
+		assert.Equal(t, gorm.ErrRecordNotFound, err)
+	})
+
+	pendingTxn := func() *PaymentTranasction {
+		p, e := newTxn()
+		p.Type = constant.PaymentTranasctionTypePayment
+		p.Channel = constant.PaymentChannelPromptPay
+		p.Status = constant.PaymentTranasctionStatusPending
+		if err := pt.Save(ctx, p, e); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		return p
+	}
+
+	t.Run("confirm pending should credit merchant only and confirm order", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p := pendingTxn()
+		p.ProviderRef = "bank-123"
+		_, e := newTxn()
+
+		//Action
+		err := pt.ConfirmPending(ctx, o, p, e)
+
+		//Assert
+		assert.Nil(t, err)
+		var c CustomerProfile
+		var m MerchantProfile
+		var actual Order
+		var stored PaymentTranasction
+		db.First(&c, o.CustomerID)
+		db.First(&m, o.MerchantID)
+		db.First(&actual, o.ID)
+		db.First(&stored, p.ID)
+		assert.Equal(t, money.MustFromInt(1000), c.Amount)
+		assert.Equal(t, money.MustFromInt(500), m.Amount)
+		assert.Equal(t, constant.OrderStatusConfirm, actual.Status)
+		assert.Equal(t, constant.PaymentTranasctionStatusConfirm, stored.Status)
+		assert.Equal(t, "bank-123", stored.ProviderRef)
+	})
+
+	t.Run("confirm pending twice should book payment once", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		db.Model(&Order{}).Where("id = ?", o.ID).Update("amount", money.MustFromInt(800))
+		p := pendingTxn()
+		_, e1 := newTxn()
+		_, e2 := newTxn()
+		pt.ConfirmPending(ctx, o, p, e1)
+
+		//Action
+		err := pt.ConfirmPending(ctx, o, p, e2)
+
+		//Assert
+		assert.Equal(t, ErrPaymentNotPending, err)
+		var m MerchantProfile
+		db.First(&m, o.MerchantID)
+		assert.Equal(t, money.MustFromInt(500), m.Amount)
+	})
+
+	t.Run("reject pending should reject only pending payment", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p := pendingTxn()
+		p.Reason = "payment was not completed in time"
+		_, e1 := newTxn()
+		_, e2 := newTxn()
+
+		//Action
+		err1 := pt.RejectPending(ctx, p, e1)
+		err2 := pt.RejectPending(ctx, p, e2)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Equal(t, ErrPaymentNotPending, err2)
+		var stored PaymentTranasction
+		db.First(&stored, p.ID)
+		assert.Equal(t, constant.PaymentTranasctionStatusReject, stored.Status)
+		assert.Equal(t, "payment was not completed in time", stored.Reason)
+	})
+
+	t.Run("list pending before should return pending payments created before cut off", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p := pendingTxn()
+		c, ce := newTxn()
+		pt.Confirm(ctx, o, c, ce)
+
+		//Action
+		expired, err1 := pt.ListPendingBefore(ctx, p.CreatedAt.Add(time.Second), 10)
+		fresh, err2 := pt.ListPendingBefore(ctx, p.CreatedAt, 10)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, 1, len(expired))
+		assert.Equal(t, p.ID, expired[0].ID)
+		assert.Equal(t, 0, len(fresh))
+	})
+
+	t.Run("list by order should return payments and refunds of order oldest first", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p, e := newTxn()
+		pt.Confirm(ctx, o, p, e)
+		rf := refundTxn(p.ID, money.MustFromInt(100))
+		pt.Refund(ctx, rf, event)
+
+		//Action
+		actual, err := pt.ListByOrder(ctx, o.ID)
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(actual))
+		assert.Equal(t, p.ID, actual[0].ID)
+		assert.Equal(t, rf.ID, actual[1].ID)
+	})
+
+	t.Run("list should filter and page newest first", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		var ids []uint
+		for i := 0; i < 3; i++ {
+			p, e := newTxn()
+			p.Status = constant.PaymentTranasctionStatusReject
+			pt.Save(ctx, p, e)
+			ids = append(ids, p.ID)
+		}
+		other, e := newTxn()
+		other.Channel = constant.PaymentChannelCredit
+		other.Status = constant.PaymentTranasctionStatusReject
+		pt.Save(ctx, other, e)
+		f := PaymentTranasctionFilter{Status: constant.PaymentTranasctionStatusReject, Channel: constant.PaymentChannelDebit, MerchantID: o.MerchantID}
+
+		//Action
+		first, err1 := pt.List(ctx, f, 0, 2)
+		second, err2 := pt.List(ctx, f, first[1].ID, 2)
+		none, err3 := pt.List(ctx, PaymentTranasctionFilter{MerchantID: o.MerchantID + 1}, 0, 2)
+		future, err4 := pt.List(ctx, PaymentTranasctionFilter{From: cl.Now().Add(time.Hour)}, 0, 2)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Nil(t, err3)
+		assert.Nil(t, err4)
+		assert.Equal(t, []uint{ids[2], ids[1]}, []uint{first[0].ID, first[1].ID})
+		assert.Equal(t, 1, len(second))
+		assert.Equal(t, ids[0], second[0].ID)
+		assert.Equal(t, 0, len(none))
+		assert.Equal(t, 0, len(future))
+	})
+}
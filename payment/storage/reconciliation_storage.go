@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"gorm.io/gorm"
+)
+
+// Reconciliation records money a channel moved that our books do not show,
+// or the other way round, until an operator settles it by hand.
+type Reconciliation struct {
+	gorm.Model
+	PaymentTranasctionID uint                          `gorm:"not null;index"`
+	Kind                 constant.ReconciliationKind   `gorm:"type:varchar(30);not null"`
+	Channel              constant.PaymentChannel       `gorm:"type:varchar(10);not null"`
+	ProviderRef          string                        `gorm:"type:varchar(64)"`
+	Amount               money.Amount                  `gorm:"type:decimal(19,4);not null;"`
+	Currency             money.Currency                `gorm:"type:varchar(3);not null;default:THB;"`
+	Reason               string                        `gorm:"type:varchar(255)"`
+	Status               constant.ReconciliationStatus `gorm:"type:varchar(10);not null;index"`
+
+	// Relation
+	PaymentTranasction PaymentTranasction `gorm:"foreignKey:PaymentTranasctionID"`
+}
+
+// Reconcile stores r as open unless the payment already has a record of the
+// same kind, as when a channel redelivers a webhook. It is written on its own,
+// outside the transaction that failed and made it necessary.
+func (s *paymentTranasctionStorage) Reconcile(ctx context.Context, r *Reconciliation) error {
+	r.Status = constant.ReconciliationStatusOpen
+	r.Reason = truncate(r.Reason, 255)
+	return s.db.WithContext(ctx).Debug().
+		Omit("PaymentTranasction").
+		Where(&Reconciliation{PaymentTranasctionID: r.PaymentTranasctionID, Kind: r.Kind}).
+		FirstOrCreate(r).Error
+}
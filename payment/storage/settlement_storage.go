@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"gorm.io/gorm"
+)
+
+// Settlement pays out to a merchant what its confirmed payments earned, less
+// their fees and confirmed refunds, in the window ending at WindowEnd.
+type Settlement struct {
+	gorm.Model
+	MerchantID   uint           `gorm:"not null;uniqueIndex:idx_settlement_merchant_window;"`
+	WindowStart  time.Time      `gorm:"not null;"`
+	WindowEnd    time.Time      `gorm:"not null;uniqueIndex:idx_settlement_merchant_window;"`
+	Currency     money.Currency `gorm:"type:varchar(3);not null;default:THB;"`
+	PaymentCount int            `gorm:"not null;"`
+	RefundCount  int            `gorm:"not null;"`
+	GrossAmount  money.Amount   `gorm:"type:decimal(19,4);not null;"`
+	FeeAmount    money.Amount   `gorm:"type:decimal(19,4);not null;default:0;"`
+	RefundAmount money.Amount   `gorm:"type:decimal(19,4);not null;"`
+	NetAmount    money.Amount   `gorm:"type:decimal(19,4);not null;"`
+
+	// Relation
+	Merchant MerchantProfile `gorm:"foreignKey:MerchantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type SettlementStorage interface {
+	ListUnsettledMerchants(ctx context.Context, start, end time.Time) ([]uint, error)
+	Settle(ctx context.Context, st *Settlement, event func(*Settlement) (*Outbox, error)) error
+	ListSettlements(ctx context.Context, windowEnd time.Time) ([]Settlement, error)
+}
+
+type settlementStorage struct {
+	db *gorm.DB
+}
+
+func NewSettlementStorage(db *gorm.DB) SettlementStorage {
+	return &settlementStorage{
+		db: db,
+	}
+}
+
+// ListUnsettledMerchants returns the merchants with transactions confirmed
+// from start up to end that no settlement paid out yet.
+func (s *settlementStorage) ListUnsettledMerchants(ctx context.Context, start, end time.Time) ([]uint, error) {
+	var ids []uint
+	r := s.db.WithContext(ctx).Debug().Model(&PaymentTranasction{}).
+		Joins("JOIN orders ON orders.id = payment_tranasctions.order_id").
+		Where("payment_tranasctions.status = ? AND payment_tranasctions.settlement_id IS NULL", constant.PaymentTranasctionStatusConfirm).
+		Where("payment_tranasctions.confirmed_at >= ? AND payment_tranasctions.confirmed_at < ?", start, end).
+		Distinct().
+		Order("orders.merchant_id").
+		Pluck("orders.merchant_id", &ids)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return ids, nil
+}
+
+// Settle claims every unsettled transaction of st.MerchantID confirmed from
+// st.WindowStart up to st.WindowEnd, totals them into st and debits the net
+// amount from the merchant balance, together with the event built from the
+// final totals. A transaction belongs to the one window its confirmation
+// falls in, however it is updated later. It returns ErrSettlementExists when
+// the merchant was already settled for the window, so rerunning a window
+// never pays out twice. The duplicate check relies on
+// gorm.Config.TranslateError being enabled.
+func (s *settlementStorage) Settle(ctx context.Context, st *Settlement, event func(*Settlement) (*Outbox, error)) error {
+	return s.db.WithContext(ctx).Debug().Transaction(func(tx *gorm.DB) error {
+		m := &MerchantProfile{}
+		if r := tx.First(m, st.MerchantID); r.Error != nil {
+			return r.Error
+		}
+		st.Currency = m.Currency
+		r := tx.Create(st)
+		if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+			return ErrSettlementExists
+		}
+		if r.Error != nil {
+			return r.Error
+		}
+
+		r = tx.Model(&PaymentTranasction{}).
+			Where("status = ? AND settlement_id IS NULL", constant.PaymentTranasctionStatusConfirm).
+			Where("confirmed_at >= ? AND confirmed_at < ?", st.WindowStart, st.WindowEnd).
+			Where("order_id IN (?)", tx.Model(&Order{}).Select("id").Where("merchant_id = ?", st.MerchantID)).
+			UpdateColumn("settlement_id", st.ID)
+		if r.Error != nil {
+			return r.Error
+		}
+
+		var totals []struct {
+			Type      constant.PaymentTranasctionType
+			Count     int
+			Amount    money.Amount
+			FeeAmount money.Amount
+		}
+		r = tx.Model(&PaymentTranasction{}).
+			Select("type, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(fee_amount), 0) AS fee_amount").
+			Where("settlement_id = ?", st.ID).
+			Group("type").
+			Scan(&totals)
+		if r.Error != nil {
+			return r.Error
+		}
+		for _, v := range totals {
+			switch v.Type {
+			case constant.PaymentTranasctionTypePayment:
+				st.PaymentCount, st.GrossAmount, st.FeeAmount = v.Count, v.Amount, v.FeeAmount
+			case constant.PaymentTranasctionTypeRefund:
+				st.RefundCount, st.RefundAmount = v.Count, v.Amount
+			}
+		}
+		net, err := st.GrossAmount.Sub(st.FeeAmount)
+		if err != nil {
+			return err
+		}
+		if st.NetAmount, err = net.Sub(st.RefundAmount); err != nil {
+			return err
+		}
+		if r := tx.Save(st); r.Error != nil {
+			return r.Error
+		}
+
+		// Refunds were already taken from the balance when they were made, so
+		// a window with more refunds than payments has nothing to pay out.
+		if st.NetAmount.IsPositive() {
+			r = tx.Model(&MerchantProfile{}).
+				Where("id = ? AND amount >= ?", st.MerchantID, st.NetAmount).
+				Updates(map[string]any{"amount": gorm.Expr("amount - ?", st.NetAmount), "updated_at": st.UpdatedAt})
+			if r.Error != nil {
+				return r.Error
+			}
+			if r.RowsAffected == 0 {
+				return ErrMerchantAmountNotEnough
+			}
+			err := post(tx, constant.JournalEntryKindSettlement, reference("settlement", st.ID), st.UpdatedAt,
+				externalLegs(constant.LedgerAccountTypeMerchant, st.MerchantID, st.Currency, st.NetAmount.Neg())...)
+			if err != nil {
+				return err
+			}
+		}
+
+		e, err := event(st)
+		if err != nil {
+			return err
+		}
+		if r := tx.Create(e); r.Error != nil {
+			return r.Error
+		}
+		return nil
+	})
+}
+
+// ListSettlements returns the settlements of the window ending at windowEnd
+// with their merchants, ordered by merchant.
+func (s *settlementStorage) ListSettlements(ctx context.Context, windowEnd time.Time) ([]Settlement, error) {
+	var rows []Settlement
+	r := s.db.WithContext(ctx).Debug().Preload("Merchant").Where("window_end = ?", windowEnd).Order("merchant_id").Find(&rows)
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	return rows, nil
+}
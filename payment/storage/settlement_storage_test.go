@@ -0,0 +1,192 @@
+//go:build integration_test
+// +build integration_test
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestSettlementStorage(t *testing.T) {
+	var ctx context.Context
+	var pt PaymentTranasctionStorage
+	var ss SettlementStorage
+	var o *Order
+	var teardown func()
+	var db *gorm.DB
+	var cl clock.Clock
+
+	setup := func() {
+		cl = clock.NewClock()
+		ctx = context.Background()
+		db, teardown = SetupDB(ctx, t)
+		pt = NewPaymentTranasctionStorage(db)
+		ss = NewSettlementStorage(db)
+		o = &Order{
+			Customer: CustomerProfile{Name: "Madmax Drinkcola", Status: constant.CustomerStatusActive, Amount: money.MustFromInt(1000)},
+			Merchant: MerchantProfile{Name: "Rabit Cart", Status: constant.MerchantStatusActive, Amount: money.MustFromInt(100)},
+			Amount:   money.MustFromInt(400),
+		}
+		ot := NewOrderStorage(db)
+		if err := ot.Save(ctx, o); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		if err := ot.Transit(ctx, o.ID, constant.OrderStatusRequestPayment, ""); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+	}
+
+	cleanup := func() {
+		teardown()
+	}
+
+	event := func() *Outbox {
+		return &Outbox{Topic: constant.KafkaTopicMerchantSettlement, Payload: "{}", Status: constant.OutboxStatusPending, NextAttemptAt: cl.Now()}
+	}
+
+	payAt := func(amount money.Amount, at time.Time) *PaymentTranasction {
+		p := &PaymentTranasction{
+			Model:   gorm.Model{UpdatedAt: at},
+			OrderID: o.ID,
+			Type:    constant.PaymentTranasctionTypePayment,
+			Amount:  amount,
+			Channel: constant.PaymentChannelDebit,
+			Status:  constant.PaymentTranasctionStatusConfirm,
+		}
+		if err := pt.Confirm(ctx, o, p, event()); err != nil {
+			t.Fatalf("Failed to setup data [%v]", err.Error())
+		}
+		return p
+	}
+
+	pay := func(amount money.Amount) *PaymentTranasction {
+		return payAt(amount, cl.Now())
+	}
+
+	settle := func(end time.Time) (*Settlement, error) {
+		st := &Settlement{MerchantID: o.MerchantID, WindowStart: end.AddDate(0, 0, -1), WindowEnd: end}
+		return st, ss.Settle(ctx, st, func(*Settlement) (*Outbox, error) { return event(), nil })
+	}
+
+	merchant := func() MerchantProfile {
+		var m MerchantProfile
+		db.First(&m, o.MerchantID)
+		return m
+	}
+
+	t.Run("settle should pay out payments less refunds and claim them", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		p := pay(money.MustFromInt(400))
+		parent := p.ID
+		r := &PaymentTranasction{Model: gorm.Model{UpdatedAt: cl.Now()}, ParentID: &parent, Amount: money.MustFromInt(150)}
+		pt.Refund(ctx, r, func(*PaymentTranasction) (*Outbox, error) { return event(), nil })
+		end := cl.Now().Add(time.Minute)
+
+		//Action
+		ids, err1 := ss.ListUnsettledMerchants(ctx, end.AddDate(0, 0, -1), end)
+		st, err2 := settle(end)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, []uint{o.MerchantID}, ids)
+		assert.Equal(t, 1, st.PaymentCount)
+		assert.Equal(t, 1, st.RefundCount)
+		assert.Equal(t, money.MustFromInt(400), st.GrossAmount)
+		assert.Equal(t, money.MustFromInt(150), st.RefundAmount)
+		assert.Equal(t, money.MustFromInt(250), st.NetAmount)
+		assert.Equal(t, money.MustFromInt(100), merchant().Amount)
+		var stored PaymentTranasction
+		db.First(&stored, p.ID)
+		assert.Equal(t, st.ID, *stored.SettlementID)
+		ids, _ = ss.ListUnsettledMerchants(ctx, end.AddDate(0, 0, -1), end)
+		assert.Equal(t, 0, len(ids))
+	})
+
+	t.Run("settle same window again should return settlement exists", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		pay(money.MustFromInt(400))
+		end := cl.Now().Add(time.Minute)
+		settle(end)
+
+		//Action
+		_, err := settle(end)
+
+		//Assert
+		assert.Equal(t, ErrSettlementExists, err)
+		assert.Equal(t, money.MustFromInt(100), merchant().Amount)
+		rows, _ := ss.ListSettlements(ctx, end)
+		assert.Equal(t, 1, len(rows))
+		assert.Equal(t, "Rabit Cart", rows[0].Merchant.Name)
+	})
+
+	t.Run("payment confirmed after cut-off should roll into next window", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		end := cl.Now()
+		pay(money.MustFromInt(400))
+
+		//Action
+		ids, err1 := ss.ListUnsettledMerchants(ctx, end.AddDate(0, 0, -1), end)
+		st, err2 := settle(end.Add(time.Minute))
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, 0, len(ids))
+		assert.Equal(t, money.MustFromInt(400), st.NetAmount)
+	})
+	t.Run("window should only take payments confirmed from its start up to its end", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		end := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+		start := end.AddDate(0, 0, -1)
+		payAt(money.MustFromInt(100), start.Add(-time.Second))
+		payAt(money.MustFromInt(150), start)
+		payAt(money.MustFromInt(50), end)
+
+		//Action
+		ids, err1 := ss.ListUnsettledMerchants(ctx, start, end)
+		st, err2 := settle(end)
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, []uint{o.MerchantID}, ids)
+		assert.Equal(t, 1, st.PaymentCount)
+		assert.Equal(t, money.MustFromInt(150), st.NetAmount)
+	})
+
+	t.Run("payment updated after confirmation should stay in window it was confirmed in", func(t *testing.T) {
+		//Arrange
+		setup()
+		defer cleanup()
+		end := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+		p := payAt(money.MustFromInt(400), end.Add(-time.Hour))
+		db.Model(&PaymentTranasction{}).Where("id = ?", p.ID).UpdateColumn("updated_at", end.Add(time.Hour))
+
+		//Action
+		st, err1 := settle(end)
+		next, err2 := settle(end.AddDate(0, 0, 1))
+
+		//Assert
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, money.MustFromInt(400), st.NetAmount)
+		assert.Equal(t, 0, next.PaymentCount)
+	})
+}
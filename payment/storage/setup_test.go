@@ -2,15 +2,90 @@ package storage
 
 import (
 	"context"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/migration"
+	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/mssql"
-	"gorm.io/driver/sqlserver"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
 	"gorm.io/gorm"
 )
 
+// SetupDB opens a database of the driver named by STORAGE_TEST_DRIVER, an
+// embedded SQLite file when it is not set, migrates it and returns it with
+// the func that tears it down. SQL Server and PostgreSQL run in Docker.
+func SetupDB(ctx context.Context, t *testing.T) (*gorm.DB, func()) {
+	var db *gorm.DB
+	teardown := func() {}
+	switch Driver(os.Getenv("STORAGE_TEST_DRIVER")) {
+	case DriverSQLServer:
+		var container *mssql.MSSQLServerContainer
+		container, db = SetupMSSQL(ctx, t)
+		teardown = func() { CleanUpMSSQL(container, ctx, t) }
+	case DriverPostgres:
+		db, teardown = SetupPostgres(ctx, t)
+	default:
+		db = SetupSQLite(t)
+	}
+
+	m, err := migration.NewMigrator(db, clock.NewClock())
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		teardown()
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return db, teardown
+}
+
+func SetupSQLite(t *testing.T) *gorm.DB {
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func SetupPostgres(ctx context.Context, t *testing.T) (*gorm.DB, func()) {
+	container, err := postgres.Run(ctx,
+		"postgres:16-alpine",
+		postgres.WithDatabase("tdd-workshop"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("SuperStrong@Passw0rd"),
+		testcontainers.WithWaitStrategy(wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	connStr, err := container.ConnectionString(ctx, "sslmode=disable", "TimeZone=UTC")
+	if err != nil {
+		t.Fatalf("Failed to create connection string: %v", err)
+	}
+
+	db, err := Open(DriverPostgres, connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect PostgreSQL: %v", err)
+	}
+	return db, func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}
+}
+
 func SetupMSSQL(ctx context.Context, t *testing.T) (*mssql.MSSQLServerContainer, *gorm.DB) {
 	container, err := mssql.Run(ctx,
 		"mcr.microsoft.com/azure-sql-edge",
@@ -29,7 +104,7 @@ func SetupMSSQL(ctx context.Context, t *testing.T) (*mssql.MSSQLServerContainer,
 		t.Fatalf("Failed to create connection string: %v", err)
 	}
 
-	db, err := gorm.Open(sqlserver.Open(connStr), &gorm.Config{})
+	db, err := Open(DriverSQLServer, connStr)
 	if err != nil {
 		t.Fatalf("Failed to connect MSSQL: %v", err)
 	}
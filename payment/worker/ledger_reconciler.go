@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type LedgerReconcilerConfig struct {
+	Interval time.Duration
+}
+
+type LedgerReconciler interface {
+	Run(ctx context.Context)
+	ReconcileOnce(ctx context.Context) (*service.LedgerReport, error)
+}
+
+type ledgerReconciler struct {
+	l   service.LedgerService
+	cfg LedgerReconcilerConfig
+}
+
+func NewLedgerReconciler(l service.LedgerService, cfg LedgerReconcilerConfig) LedgerReconciler {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+	return &ledgerReconciler{
+		l:   l,
+		cfg: cfg,
+	}
+}
+
+func (s *ledgerReconciler) Run(ctx context.Context) {
+	t := time.NewTicker(s.cfg.Interval)
+	defer t.Stop()
+	for {
+		if _, err := s.ReconcileOnce(ctx); err != nil {
+			log.Printf("ledger reconciler: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ReconcileOnce checks the ledger and logs every balance that drifted from
+// it and every entry that does not balance.
+func (s *ledgerReconciler) ReconcileOnce(ctx context.Context) (*service.LedgerReport, error) {
+	r, err := s.l.Reconcile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range r.Drifts {
+		log.Printf("ledger drift: %s %d balance %s %s but ledger %s", d.AccountType, d.OwnerID, d.ProfileAmount, d.Currency, d.LedgerAmount)
+	}
+	for _, id := range r.UnbalancedEntries {
+		log.Printf("ledger drift: journal entry %d does not balance", id)
+	}
+	return r, nil
+}
@@ -0,0 +1,73 @@
+//go:build unit_test
+// +build unit_test
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLedgerService struct {
+	Calls  int
+	report *service.LedgerReport
+	err    error
+}
+
+func (m *mockLedgerService) SetReconcile(r *service.LedgerReport, err error) {
+	m.report = r
+	m.err = err
+}
+
+func (m *mockLedgerService) OpenAccounts(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockLedgerService) Reconcile(ctx context.Context) (*service.LedgerReport, error) {
+	m.Calls++
+	return m.report, m.err
+}
+
+func TestLedgerReconciler(t *testing.T) {
+	var ml *mockLedgerService
+	var s LedgerReconciler
+
+	setup := func() {
+		ml = &mockLedgerService{}
+		s = NewLedgerReconciler(ml, LedgerReconcilerConfig{})
+	}
+
+	t.Run("reconcile should return report of drifts", func(t *testing.T) {
+		//Arrange
+		setup()
+		expected := &service.LedgerReport{
+			Drifts:            []service.LedgerDriftResponse{{OwnerID: 3}},
+			UnbalancedEntries: []uint{9},
+		}
+		ml.SetReconcile(expected, nil)
+
+		//Action
+		actual, err := s.ReconcileOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, 1, ml.Calls)
+	})
+
+	t.Run("reconcile failure should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		ml.SetReconcile(nil, errors.New("unknown error"))
+
+		//Action
+		_, err := s.ReconcileOnce(context.Background())
+
+		//Assert
+		assert.Equal(t, errors.New("unknown error"), err)
+	})
+}
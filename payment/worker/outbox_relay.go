@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/messaging"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+)
+
+type OutboxRelayConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type OutboxRelay interface {
+	Run(ctx context.Context)
+	RelayOnce(ctx context.Context) (int, error)
+}
+
+type outboxRelay struct {
+	o   storage.OutboxStorage
+	m   messaging.KafkaProducer
+	c   clock.Clock
+	cfg OutboxRelayConfig
+}
+
+func NewOutboxRelay(o storage.OutboxStorage, m messaging.KafkaProducer, c clock.Clock, cfg OutboxRelayConfig) OutboxRelay {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = time.Second
+	}
+	return &outboxRelay{
+		o:   o,
+		m:   m,
+		c:   c,
+		cfg: cfg,
+	}
+}
+
+func (s *outboxRelay) Run(ctx context.Context) {
+	t := time.NewTicker(s.cfg.Interval)
+	defer t.Stop()
+	for {
+		if _, err := s.RelayOnce(ctx); err != nil {
+			log.Printf("outbox relay: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of pending events and returns how many were sent.
+// Once an event for a key fails, later events with the same key in the batch
+// are skipped, and ListPending holds them back in later rounds until it is
+// sent, so consumers keep seeing them in order. Events without a key have no
+// order to keep, so one failing holds back no other.
+func (s *outboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	n := s.c.Now()
+	rows, err := s.o.ListPending(ctx, n, s.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	blocked := map[string]bool{}
+	for _, e := range rows {
+		if blocked[e.Key] {
+			continue
+		}
+		err := s.m.Publish(ctx, messaging.RequestPublish{
+			Topic:   e.Topic,
+			Key:     e.Key,
+			Message: json.RawMessage(e.Payload),
+		})
+		if ctx.Err() != nil {
+			// Stopped mid-publish; the event stays pending without using an attempt
+			return sent, ctx.Err()
+		}
+		if err != nil {
+			if e.Key != "" {
+				blocked[e.Key] = true
+			}
+			if err := s.retry(ctx, e, n, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		// The event went out, so record it even when stopped meanwhile
+		if err := s.o.MarkSent(context.WithoutCancel(ctx), e.ID, n); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (s *outboxRelay) retry(ctx context.Context, e storage.Outbox, n time.Time, cause error) error {
+	attempts := e.Attempts + 1
+	if attempts >= s.cfg.MaxAttempts {
+		return s.o.MarkFailed(ctx, e.ID, attempts, cause.Error())
+	}
+	return s.o.MarkRetry(ctx, e.ID, attempts, cause.Error(), n.Add(s.cfg.Backoff<<(attempts-1)))
+}
@@ -0,0 +1,216 @@
+//go:build unit_test
+// +build unit_test
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/constant"
+	"github.com/kaweel/workshop-tdd/payment/messaging"
+	"github.com/kaweel/workshop-tdd/payment/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type outboxUpdate struct {
+	ID       uint
+	Status   constant.OutboxStatus
+	Attempts int
+	Reason   string
+	At       time.Time
+}
+
+type mockOutboxStorage struct {
+	rows    []storage.Outbox
+	err     error
+	Updates []outboxUpdate
+}
+
+func (m *mockOutboxStorage) SetListPending(rows []storage.Outbox, err error) {
+	m.rows = rows
+	m.err = err
+}
+
+func (m *mockOutboxStorage) ListPending(ctx context.Context, now time.Time, limit int) ([]storage.Outbox, error) {
+	return m.rows, m.err
+}
+
+func (m *mockOutboxStorage) MarkSent(ctx context.Context, id uint, sentAt time.Time) error {
+	m.Updates = append(m.Updates, outboxUpdate{ID: id, Status: constant.OutboxStatusSent, At: sentAt})
+	return nil
+}
+
+func (m *mockOutboxStorage) MarkRetry(ctx context.Context, id uint, attempts int, reason string, next time.Time) error {
+	m.Updates = append(m.Updates, outboxUpdate{ID: id, Status: constant.OutboxStatusPending, Attempts: attempts, Reason: reason, At: next})
+	return nil
+}
+
+func (m *mockOutboxStorage) MarkFailed(ctx context.Context, id uint, attempts int, reason string) error {
+	m.Updates = append(m.Updates, outboxUpdate{ID: id, Status: constant.OutboxStatusFailed, Attempts: attempts, Reason: reason})
+	return nil
+}
+
+type mockKafkaProducer struct {
+	Calls []messaging.RequestPublish
+	errs  map[string]error
+}
+
+func (m *mockKafkaProducer) SetPublish(key string, err error) {
+	m.errs[key] = err
+}
+
+func (m *mockKafkaProducer) Publish(ctx context.Context, r messaging.RequestPublish) error {
+	m.Calls = append(m.Calls, r)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.errs[r.Key]
+}
+
+func (m *mockKafkaProducer) Close() error {
+	return nil
+}
+
+type mockClock struct {
+	t time.Time
+}
+
+func (m *mockClock) Now() time.Time {
+	return m.t
+}
+
+func TestOutboxRelay(t *testing.T) {
+	var s OutboxRelay
+	var mo *mockOutboxStorage
+	var mk *mockKafkaProducer
+	var mt *mockClock
+
+	setup := func() {
+		mo = &mockOutboxStorage{}
+		mk = &mockKafkaProducer{errs: map[string]error{}}
+		mt = &mockClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+		s = NewOutboxRelay(mo, mk, mt, OutboxRelayConfig{MaxAttempts: 3, Backoff: time.Second})
+	}
+
+	row := func(id uint, key string, attempts int) storage.Outbox {
+		return storage.Outbox{
+			Model:    gorm.Model{ID: id},
+			Topic:    constant.KafkaTopicPaymentTransaction,
+			Key:      key,
+			Payload:  `{"orderID":1}`,
+			Status:   constant.OutboxStatusPending,
+			Attempts: attempts,
+		}
+	}
+
+	t.Run("pending events should be published and marked sent", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending([]storage.Outbox{row(1, "1", 0), row(2, "2", 0)}, nil)
+
+		//Action
+		sent, err := s.RelayOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 2, sent)
+		assert.Equal(t, 2, len(mk.Calls))
+		assert.Equal(t, constant.KafkaTopicPaymentTransaction, mk.Calls[0].Topic)
+		assert.Equal(t, "1", mk.Calls[0].Key)
+		assert.Equal(t, json.RawMessage(`{"orderID":1}`), mk.Calls[0].Message)
+		assert.Equal(t, []outboxUpdate{
+			{ID: 1, Status: constant.OutboxStatusSent, At: mt.t},
+			{ID: 2, Status: constant.OutboxStatusSent, At: mt.t},
+		}, mo.Updates)
+	})
+
+	t.Run("publish fail should schedule retry with backoff and hold later events of same key", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending([]storage.Outbox{row(1, "1", 1), row(2, "1", 0), row(3, "3", 0)}, nil)
+		mk.SetPublish("1", errors.New("broker down"))
+
+		//Action
+		sent, err := s.RelayOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, 2, len(mk.Calls))
+		assert.Equal(t, []outboxUpdate{
+			{ID: 1, Status: constant.OutboxStatusPending, Attempts: 2, Reason: "broker down", At: mt.t.Add(2 * time.Second)},
+			{ID: 3, Status: constant.OutboxStatusSent, At: mt.t},
+		}, mo.Updates)
+	})
+
+	t.Run("publish fail of event without key should not hold other events without key", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending([]storage.Outbox{row(1, "", 0), row(2, "", 0)}, nil)
+		mk.SetPublish("", errors.New("broker down"))
+
+		//Action
+		sent, err := s.RelayOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Equal(t, 2, len(mk.Calls))
+		assert.Equal(t, []outboxUpdate{
+			{ID: 1, Status: constant.OutboxStatusPending, Attempts: 1, Reason: "broker down", At: mt.t.Add(time.Second)},
+			{ID: 2, Status: constant.OutboxStatusPending, Attempts: 1, Reason: "broker down", At: mt.t.Add(time.Second)},
+		}, mo.Updates)
+	})
+
+	t.Run("publish fail on last attempt should mark event failed", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending([]storage.Outbox{row(1, "1", 2)}, nil)
+		mk.SetPublish("1", errors.New("broker down"))
+
+		//Action
+		sent, err := s.RelayOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Equal(t, []outboxUpdate{
+			{ID: 1, Status: constant.OutboxStatusFailed, Attempts: 3, Reason: "broker down"},
+		}, mo.Updates)
+	})
+
+	t.Run("stopped relay should leave events pending without using an attempt", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending([]storage.Outbox{row(1, "1", 0), row(2, "2", 0)}, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		//Action
+		sent, err := s.RelayOnce(ctx)
+
+		//Assert
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, sent)
+		assert.Equal(t, 1, len(mk.Calls))
+		assert.Equal(t, 0, len(mo.Updates))
+	})
+
+	t.Run("list pending fail should return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		mo.SetListPending(nil, errors.New("db down"))
+
+		//Action
+		_, err := s.RelayOnce(context.Background())
+
+		//Assert
+		assert.EqualError(t, err, "db down")
+		assert.Equal(t, 0, len(mk.Calls))
+	})
+}
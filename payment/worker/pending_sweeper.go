@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+)
+
+type PendingSweeperConfig struct {
+	Interval time.Duration
+	// Timeout is how long a payment may stay pending before it is rejected.
+	Timeout   time.Duration
+	BatchSize int
+}
+
+// PendingExpirer rejects payments that stayed pending for too long and
+// voids authorizations whose hold expired.
+type PendingExpirer interface {
+	ExpirePending(ctx context.Context, before time.Time, limit int) (int, error)
+	ExpireAuthorizations(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+type PendingSweeper interface {
+	Run(ctx context.Context)
+	SweepOnce(ctx context.Context) (int, error)
+}
+
+type pendingSweeper struct {
+	p   PendingExpirer
+	c   clock.Clock
+	cfg PendingSweeperConfig
+}
+
+func NewPendingSweeper(p PendingExpirer, c clock.Clock, cfg PendingSweeperConfig) PendingSweeper {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 15 * time.Minute
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	return &pendingSweeper{
+		p:   p,
+		c:   c,
+		cfg: cfg,
+	}
+}
+
+func (s *pendingSweeper) Run(ctx context.Context) {
+	t := time.NewTicker(s.cfg.Interval)
+	defer t.Stop()
+	for {
+		if _, err := s.SweepOnce(ctx); err != nil {
+			log.Printf("pending sweeper: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// SweepOnce rejects the payments pending for longer than the timeout and
+// voids expired authorizations, a batch at a time until none are left, and
+// returns how many payments it expired.
+func (s *pendingSweeper) SweepOnce(ctx context.Context) (int, error) {
+	now := s.c.Now()
+	pending, err := s.drain(func(limit int) (int, error) {
+		return s.p.ExpirePending(ctx, now.Add(-s.cfg.Timeout), limit)
+	})
+	if err != nil {
+		return pending, err
+	}
+	authorized, err := s.drain(func(limit int) (int, error) {
+		return s.p.ExpireAuthorizations(ctx, now, limit)
+	})
+	return pending + authorized, err
+}
+
+func (s *pendingSweeper) drain(expire func(limit int) (int, error)) (int, error) {
+	total := 0
+	for {
+		n, err := expire(s.cfg.BatchSize)
+		total += n
+		if err != nil || n < s.cfg.BatchSize {
+			return total, err
+		}
+	}
+}
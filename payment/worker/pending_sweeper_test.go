@@ -0,0 +1,120 @@
+//go:build unit_test
+// +build unit_test
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type expireCall struct {
+	Before time.Time
+	Limit  int
+}
+
+type mockPendingExpirer struct {
+	Calls          []expireCall
+	Authorizations []expireCall
+	results        []int
+	err            error
+	authorizations int
+}
+
+func (m *mockPendingExpirer) SetExpireAuthorizations(n int) {
+	m.authorizations = n
+}
+
+func (m *mockPendingExpirer) ExpireAuthorizations(ctx context.Context, now time.Time, limit int) (int, error) {
+	m.Authorizations = append(m.Authorizations, expireCall{Before: now, Limit: limit})
+	n := m.authorizations
+	m.authorizations = 0
+	return n, nil
+}
+
+func (m *mockPendingExpirer) SetExpirePending(results []int, err error) {
+	m.results = results
+	m.err = err
+}
+
+func (m *mockPendingExpirer) ExpirePending(ctx context.Context, before time.Time, limit int) (int, error) {
+	m.Calls = append(m.Calls, expireCall{Before: before, Limit: limit})
+	if len(m.results) == 0 {
+		return 0, m.err
+	}
+	n := m.results[0]
+	m.results = m.results[1:]
+	return n, nil
+}
+
+func TestPendingSweeper(t *testing.T) {
+	var mp *mockPendingExpirer
+	var mc *mockClock
+	var s PendingSweeper
+
+	setup := func() {
+		mp = &mockPendingExpirer{}
+		mc = &mockClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		s = NewPendingSweeper(mp, mc, PendingSweeperConfig{Timeout: 10 * time.Minute, BatchSize: 2})
+	}
+
+	t.Run("sweep should expire payments pending longer than timeout", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpirePending([]int{1}, nil)
+
+		//Action
+		actual, err := s.SweepOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, actual)
+		assert.Equal(t, []expireCall{{Before: time.Date(2024, 1, 1, 11, 50, 0, 0, time.UTC), Limit: 2}}, mp.Calls)
+	})
+
+	t.Run("sweep should void authorizations whose hold expired by now", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpireAuthorizations(1)
+
+		//Action
+		actual, err := s.SweepOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 1, actual)
+		assert.Equal(t, []expireCall{{Before: mc.t, Limit: 2}}, mp.Authorizations)
+	})
+
+	t.Run("full batch should sweep again until batch is not full", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpirePending([]int{2, 2, 1}, nil)
+
+		//Action
+		actual, err := s.SweepOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		assert.Equal(t, 5, actual)
+		assert.Equal(t, 3, len(mp.Calls))
+	})
+
+	t.Run("expire failure should stop sweep and return error", func(t *testing.T) {
+		//Arrange
+		setup()
+		mp.SetExpirePending([]int{2}, errors.New("connection reset"))
+
+		//Action
+		actual, err := s.SweepOnce(context.Background())
+
+		//Assert
+		assert.EqualError(t, err, "connection reset")
+		assert.Equal(t, 2, actual)
+		assert.Equal(t, 0, len(mp.Authorizations))
+	})
+}
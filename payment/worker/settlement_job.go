@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/clock"
+	"github.com/kaweel/workshop-tdd/payment/service"
+)
+
+type SettlementJobConfig struct {
+	// CutOff is the time of day in Location a daily settlement window ends.
+	CutOff    time.Duration
+	Location  *time.Location
+	ReportDir string
+}
+
+type SettlementJob interface {
+	Run(ctx context.Context)
+	SettleOnce(ctx context.Context) ([]service.SettlementMessage, error)
+}
+
+type settlementJob struct {
+	s   service.SettlementService
+	c   clock.Clock
+	cfg SettlementJobConfig
+}
+
+func NewSettlementJob(s service.SettlementService, c clock.Clock, cfg SettlementJobConfig) SettlementJob {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.ReportDir == "" {
+		cfg.ReportDir = "settlements"
+	}
+	return &settlementJob{
+		s:   s,
+		c:   c,
+		cfg: cfg,
+	}
+}
+
+// Run settles the last completed window right away, so a window missed while
+// the service was down is caught up, and then once a day at the cut-off.
+func (s *settlementJob) Run(ctx context.Context) {
+	for {
+		if _, err := s.SettleOnce(ctx); err != nil {
+			log.Printf("settlement job: %v", err)
+		}
+		_, end := s.window(s.c.Now())
+		t := time.NewTimer(end.AddDate(0, 0, 1).Sub(s.c.Now()))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// SettleOnce settles the last window that ended before now and writes its
+// report. Running it again for the same window settles nothing twice and
+// rewrites the same report.
+func (s *settlementJob) SettleOnce(ctx context.Context) ([]service.SettlementMessage, error) {
+	start, end := s.window(s.c.Now())
+	l, err := s.s.SettleWindow(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	name := "settlement-" + start.In(s.cfg.Location).Format("20060102") + ".csv"
+	if err := s.writeReport(filepath.Join(s.cfg.ReportDir, name), l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// window returns the day long window ending at the latest cut-off at or
+// before now.
+func (s *settlementJob) window(now time.Time) (time.Time, time.Time) {
+	l := now.In(s.cfg.Location)
+	end := time.Date(l.Year(), l.Month(), l.Day(), 0, 0, 0, 0, s.cfg.Location).Add(s.cfg.CutOff)
+	if end.After(l) {
+		end = end.AddDate(0, 0, -1)
+	}
+	return end.AddDate(0, 0, -1).UTC(), end.UTC()
+}
+
+// writeReport writes the report next to its final path and renames it into
+// place so a reader never sees a half written file.
+func (s *settlementJob) writeReport(path string, l []service.SettlementMessage) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"settlement_id", "merchant_id", "merchant_name", "window_start", "window_end", "currency", "payment_count", "refund_count", "gross_amount", "fee_amount", "refund_amount", "net_amount"})
+	for _, v := range l {
+		w.Write([]string{
+			strconv.FormatUint(uint64(v.SettlementID), 10),
+			strconv.FormatUint(uint64(v.MerchantID), 10),
+			v.MerchantName,
+			v.WindowStart.Format(time.RFC3339),
+			v.WindowEnd.Format(time.RFC3339),
+			string(v.Currency),
+			strconv.Itoa(v.PaymentCount),
+			strconv.Itoa(v.RefundCount),
+			v.GrossAmount.String(),
+			v.FeeAmount.String(),
+			v.RefundAmount.String(),
+			v.NetAmount.String(),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,167 @@
+//go:build unit_test
+// +build unit_test
+
+package worker
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kaweel/workshop-tdd/payment/money"
+	"github.com/kaweel/workshop-tdd/payment/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type settleCall struct {
+	Start time.Time
+	End   time.Time
+}
+
+type mockSettlementService struct {
+	Calls []settleCall
+	rows  []service.SettlementMessage
+	err   error
+}
+
+func (m *mockSettlementService) SetSettleWindow(rows []service.SettlementMessage, err error) {
+	m.rows = rows
+	m.err = err
+}
+
+func (m *mockSettlementService) SettleWindow(ctx context.Context, start, end time.Time) ([]service.SettlementMessage, error) {
+	m.Calls = append(m.Calls, settleCall{Start: start, End: end})
+	return m.rows, m.err
+}
+
+func TestSettlementJob(t *testing.T) {
+	var ms *mockSettlementService
+	var mc *mockClock
+	var s SettlementJob
+	var dir string
+	bangkok := time.FixedZone("Asia/Bangkok", 7*60*60)
+
+	setup := func(now time.Time, cutOff time.Duration) {
+		ms = &mockSettlementService{}
+		mc = &mockClock{t: now}
+		dir = t.TempDir()
+		s = NewSettlementJob(ms, mc, SettlementJobConfig{CutOff: cutOff, Location: bangkok, ReportDir: dir})
+	}
+
+	t.Run("settle should settle the day before the last cut-off", func(t *testing.T) {
+		data := []struct {
+			name     string
+			now      time.Time
+			cutOff   time.Duration
+			expected settleCall
+		}{
+			{
+				"after midnight",
+				time.Date(2024, 1, 2, 1, 0, 0, 0, bangkok),
+				0,
+				settleCall{time.Date(2024, 1, 1, 0, 0, 0, 0, bangkok).UTC(), time.Date(2024, 1, 2, 0, 0, 0, 0, bangkok).UTC()},
+			},
+			{
+				"before cut-off",
+				time.Date(2024, 1, 2, 1, 0, 0, 0, bangkok),
+				2 * time.Hour,
+				settleCall{time.Date(2023, 12, 31, 2, 0, 0, 0, bangkok).UTC(), time.Date(2024, 1, 1, 2, 0, 0, 0, bangkok).UTC()},
+			},
+			{
+				"at cut-off",
+				time.Date(2024, 1, 2, 2, 0, 0, 0, bangkok),
+				2 * time.Hour,
+				settleCall{time.Date(2024, 1, 1, 2, 0, 0, 0, bangkok).UTC(), time.Date(2024, 1, 2, 2, 0, 0, 0, bangkok).UTC()},
+			},
+			{
+				"clock in utc",
+				time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC),
+				0,
+				settleCall{time.Date(2024, 1, 1, 0, 0, 0, 0, bangkok).UTC(), time.Date(2024, 1, 2, 0, 0, 0, 0, bangkok).UTC()},
+			},
+		}
+		for _, v := range data {
+			t.Run(v.name, func(t *testing.T) {
+				//Arrange
+				setup(v.now, v.cutOff)
+
+				//Action
+				_, err := s.SettleOnce(context.Background())
+
+				//Assert
+				assert.Nil(t, err)
+				assert.Equal(t, []settleCall{v.expected}, ms.Calls)
+			})
+		}
+	})
+
+	t.Run("settle should write csv report of the window", func(t *testing.T) {
+		//Arrange
+		setup(time.Date(2024, 1, 2, 1, 0, 0, 0, bangkok), 0)
+		start := time.Date(2023, 12, 31, 17, 0, 0, 0, time.UTC)
+		ms.SetSettleWindow([]service.SettlementMessage{
+			{
+				SettlementID: 1,
+				MerchantID:   3,
+				MerchantName: "Rabit Cart",
+				WindowStart:  start,
+				WindowEnd:    start.AddDate(0, 0, 1),
+				Currency:     money.THB,
+				PaymentCount: 2,
+				RefundCount:  1,
+				GrossAmount:  money.MustFromInt(300),
+				FeeAmount:    money.MustFromInt(9),
+				RefundAmount: money.MustParse("50.5"),
+				NetAmount:    money.MustParse("240.5"),
+			},
+		}, nil)
+
+		//Action
+		_, err := s.SettleOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		f, err := os.Open(filepath.Join(dir, "settlement-20240101.csv"))
+		assert.Nil(t, err)
+		defer f.Close()
+		actual, err := csv.NewReader(f).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{
+			{"settlement_id", "merchant_id", "merchant_name", "window_start", "window_end", "currency", "payment_count", "refund_count", "gross_amount", "fee_amount", "refund_amount", "net_amount"},
+			{"1", "3", "Rabit Cart", "2023-12-31T17:00:00Z", "2024-01-01T17:00:00Z", "THB", "2", "1", "300", "9", "50.5", "240.5"},
+		}, actual)
+	})
+
+	t.Run("rerun should rewrite the same report", func(t *testing.T) {
+		//Arrange
+		setup(time.Date(2024, 1, 2, 1, 0, 0, 0, bangkok), 0)
+		s.SettleOnce(context.Background())
+
+		//Action
+		_, err := s.SettleOnce(context.Background())
+
+		//Assert
+		assert.Nil(t, err)
+		files, _ := os.ReadDir(dir)
+		assert.Equal(t, 1, len(files))
+		assert.Equal(t, ms.Calls[0], ms.Calls[1])
+	})
+
+	t.Run("settle failure should return error without report", func(t *testing.T) {
+		//Arrange
+		setup(time.Date(2024, 1, 2, 1, 0, 0, 0, bangkok), 0)
+		ms.SetSettleWindow(nil, errors.New("unknown error"))
+
+		//Action
+		_, err := s.SettleOnce(context.Background())
+
+		//Assert
+		assert.Equal(t, errors.New("unknown error"), err)
+		files, _ := os.ReadDir(dir)
+		assert.Equal(t, 0, len(files))
+	})
+}